@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"io"
+	"log"
 	"os"
 	"path"
 	"time"
@@ -20,6 +20,8 @@ type Win struct {
 	tag  string
 	c    *lsp.Client
 	f    *outline.File
+
+	version int // version of the document sent to the server lastly
 }
 
 func OpenFile(id int, file string, c *lsp.Client) (*Win, error) {
@@ -91,30 +93,47 @@ func (w *Win) DocumentID() lsp.TextDocumentIdentifier {
 }
 
 func (w *Win) didOpenFile(body []byte) error {
+	w.version = 1
 	return w.c.DidOpenTextDocument(&lsp.DidOpenTextDocumentParams{
 		TextDocument: lsp.TextDocumentItem{
 			URI:        w.c.URL(w.file),
 			LanguageID: "go",
-			Version:    1,
+			Version:    w.version,
 			Text:       string(body),
 		},
 	})
 }
 
+// nextVersion returns the version for a new change of the document.
+func (w *Win) nextVersion() *int {
+	w.version++
+	v := w.version
+	return &v
+}
+
 func (w *Win) Reload() error {
 	// TODO(lufia): reload file content
 	return nil
 }
 
 func (w *Win) didSave() error {
-	return w.c.DidSaveTextDocument(&lsp.DidSaveTextDocumentParams{
+	body, err := w.acme.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	return w.c.DidSave(&lsp.DidSaveTextDocumentParams{
 		TextDocument: w.DocumentID(),
+		Text:         string(body),
 	})
 }
 
 func (w *Win) watch() {
 	for e := range w.acme.EventChan() {
 		if err := w.handleEvent(e); err != nil {
+			if xerrors.Is(err, lsp.ErrUnsupported) {
+				w.acme.Errf("%s: not supported by this server", e.Text)
+				continue
+			}
 			w.acme.Errf("%v", err)
 			continue
 		}
@@ -142,7 +161,18 @@ func (w *Win) handleEvent(e *acme.Event) error {
 }
 
 func (w *Win) updateBody(p0, p1 outline.Pos, s string) error {
-	params, err := w.makeContentChangeEvent(p0, p1, s)
+	var (
+		params *lsp.DidChangeTextDocumentParams
+		err    error
+	)
+	switch w.c.SyncKind() {
+	case lsp.TextDocumentSyncKindNone:
+		return w.f.Update(p0, p1, s)
+	case lsp.TextDocumentSyncKindFull:
+		params, err = w.makeFullContentChangeEvent()
+	default:
+		params, err = w.makeContentChangeEvent(p0, p1, s)
+	}
 	if err != nil {
 		return err
 	}
@@ -152,6 +182,22 @@ func (w *Win) updateBody(p0, p1 outline.Pos, s string) error {
 	return w.f.Update(p0, p1, s)
 }
 
+func (w *Win) makeFullContentChangeEvent() (*lsp.DidChangeTextDocumentParams, error) {
+	body, err := w.acme.ReadAll("body")
+	if err != nil {
+		return nil, err
+	}
+	return &lsp.DidChangeTextDocumentParams{
+		TextDocument: lsp.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: w.DocumentID(),
+			Version:                w.nextVersion(),
+		},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{
+			{Text: string(body)},
+		},
+	}, nil
+}
+
 func (w *Win) makeContentChangeEvent(p0, p1 outline.Pos, s string) (*lsp.DidChangeTextDocumentParams, error) {
 	a0, err := w.f.Addr(p0)
 	if err != nil {
@@ -164,11 +210,11 @@ func (w *Win) makeContentChangeEvent(p0, p1 outline.Pos, s string) (*lsp.DidChan
 	return &lsp.DidChangeTextDocumentParams{
 		TextDocument: lsp.VersionedTextDocumentIdentifier{
 			TextDocumentIdentifier: w.DocumentID(),
-			Version:                nil, // TODO(lufia): implement
+			Version:                w.nextVersion(),
 		},
 		ContentChanges: []lsp.TextDocumentContentChangeEvent{
 			{
-				Range: lsp.Range{
+				Range: &lsp.Range{
 					Start: lsp.Position{
 						Line:      int(a0.Line),
 						Character: int(a0.Col),
@@ -193,6 +239,8 @@ func (w *Win) execute(e *acme.Event) error {
 		return w.ExecRef()
 	case "Doc":
 		return w.ExecDoc()
+	case "Imports":
+		return w.ExecImports()
 	case "Test":
 		return xerrors.New("not implement")
 	default:
@@ -334,6 +382,30 @@ func (w *Win) ExecDoc() error {
 	return nil
 }
 
+// ExecImports organizes imports of the body.
+func (w *Win) ExecImports() error {
+	edits, err := w.c.OrganizeImports(w.c.URL(w.file))
+	if err != nil {
+		return err
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	body, err := w.acme.ReadAll("body")
+	if err != nil {
+		return err
+	}
+	s, err := lsp.ApplyEdits(string(body), edits)
+	if err != nil {
+		return err
+	}
+	if err := w.acme.Addr(","); err != nil {
+		return err
+	}
+	_, err = w.acme.Write("data", []byte(s))
+	return err
+}
+
 func rangeToPos(file string, r *lsp.Range) (q0, q1 int, err error) {
 	fin, err := os.Open(file)
 	if err != nil {
@@ -377,30 +449,41 @@ func (w *Win) Close() {
 }
 
 func start(c *lsp.Client) error {
+	go func() {
+		<-c.Done()
+		if err := c.Err(); err != lsp.ErrServerExited && err != lsp.ErrClosed {
+			log.Fatalf("lsp: %v", err)
+		}
+	}()
 	go func() {
 		for msg := range c.Event {
-			switch msg.Method {
-			case "textDocument/publishDiagnostics":
-				if !*debugFlag {
-					continue
-				}
-				var params lsp.PublishDiagnosticsParams
-				err := json.Unmarshal([]byte(msg.Params), &params)
+			acme.Errf(".", "lsp: %s: %s", msg.Method, msg.Params)
+		}
+	}()
+	go func() {
+		for params := range c.Diagnostics {
+			if !*debugFlag {
+				continue
+			}
+			file := params.URI.String()
+			for _, v := range params.Diagnostics {
+				q0, q1, err := rangeToPos(file, &v.Range)
 				if err != nil {
-					acme.Errf(".", "lsp: %s: %s", msg.Method, msg.Params)
+					acme.Errf(file, "lsp: %s: %v", file, err)
 					continue
 				}
-				file := params.URI.String()
-				for _, v := range params.Diagnostics {
-					q0, q1, err := rangeToPos(file, &v.Range)
-					if err != nil {
-						acme.Errf(file, "lsp: %s: %s", msg.Method, msg.Params)
-						continue
-					}
-					acme.Errf(file, "%s:#%d,#%d %s", path.Base(file), q0, q1, v.Message)
+				msg := v.Message
+				if v.HasTag(lsp.DiagnosticTagDeprecated) {
+					msg = "deprecated: " + msg
+				}
+				acme.Errf(file, "%s:#%d,#%d %s", path.Base(file), q0, q1, msg)
+				if v.CodeDescription != nil {
+					acme.Errf(file, "\t%s", v.CodeDescription.Href)
+				}
+				for _, info := range v.RelatedInformation {
+					loc := info.Location
+					acme.Errf(file, "\t%s:%d %s", loc.URI.String(), loc.Range.Start.Line+1, info.Message)
 				}
-			default:
-				acme.Errf(".", "lsp: %s: %s", msg.Method, msg.Params)
 			}
 		}
 	}()
@@ -1,8 +1,8 @@
 module github.com/lufia/acme-lsp
 
-go 1.12
+go 1.18
 
 require (
 	9fans.net/go v0.0.2
-	golang.org/x/xerrors v0.0.0-20190513163551-3ee3066db522
+	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da
 )
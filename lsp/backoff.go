@@ -0,0 +1,166 @@
+package lsp
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrGaveUp is returned by Reconnect when all attempts failed.
+// It is wrapped with the number of attempts and the last error.
+var ErrGaveUp = xerrors.New("lsp: gave up connecting to the server")
+
+// Backoff controls delays between attempts of Reconnect and RetryInitialize.
+// The delay before the n-th retry is Initial * Multiplier^(n-1), bounded by Max,
+// and is shortened by a random fraction up to Jitter of itself.
+// Zero fields are replaced by the values of DefaultBackoff; a negative Jitter disables randomization.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64 // at most 1
+	MaxRetries int     // number of retries after the first attempt
+}
+
+// DefaultBackoff is the backoff used by Reconnect if b is nil.
+var DefaultBackoff = Backoff{
+	Initial:    100 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+	MaxRetries: 5,
+}
+
+func (b *Backoff) withDefaults() Backoff {
+	v := DefaultBackoff
+	if b == nil {
+		return v
+	}
+	if b.Initial > 0 {
+		v.Initial = b.Initial
+	}
+	if b.Max > 0 {
+		v.Max = b.Max
+	}
+	if b.Multiplier >= 1 {
+		v.Multiplier = b.Multiplier
+	}
+	switch {
+	case b.Jitter < 0:
+		v.Jitter = 0
+	case b.Jitter > 0 && b.Jitter <= 1:
+		v.Jitter = b.Jitter
+	}
+	if b.MaxRetries > 0 {
+		v.MaxRetries = b.MaxRetries
+	}
+	return v
+}
+
+// Delay returns the delay before the n-th retry, with n starting at 1.
+func (b *Backoff) Delay(n int) time.Duration {
+	v := b.withDefaults()
+	return v.delay(n)
+}
+
+func (b *Backoff) delay(n int) time.Duration {
+	d := float64(b.Initial)
+	for i := 1; i < n && d < float64(b.Max); i++ {
+		d *= b.Multiplier
+	}
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	d -= d * b.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// Reconnect calls dial until it succeeds, waiting for delays of b between attempts.
+// If b is nil, DefaultBackoff is used. After b.MaxRetries retries fail,
+// Reconnect returns ErrGaveUp wrapped with the last error of dial.
+// It returns ctx.Err() if ctx is done while waiting.
+func Reconnect(ctx context.Context, b *Backoff, dial func() (*Client, error)) (*Client, error) {
+	v := b.withDefaults()
+	var err error
+	for n := 0; n <= v.MaxRetries; n++ {
+		if n > 0 {
+			t := time.NewTimer(v.delay(n))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		var c *Client
+		c, err = dial()
+		if err == nil {
+			return c, nil
+		}
+	}
+	return nil, xerrors.Errorf("%w after %d attempts: %v", ErrGaveUp, v.MaxRetries+1, err)
+}
+
+// RetryInitialize returns an option to retry the initialize request, waiting for delays of b,
+// when it times out or the server cancels it. It helps servers that are slow to start,
+// such as gopls with a cold cache. The initialize request is idempotent until initialized is sent.
+// If b is nil, DefaultBackoff is used. The timeout of an attempt is set by MethodTimeouts.
+func RetryInitialize(b *Backoff) Option {
+	v := b.withDefaults()
+	return func(c *Client) {
+		c.initRetry = &v
+	}
+}
+
+// callInitialize calls initialize with retries configured by RetryInitialize.
+func (c *Client) callInitialize(params *InitializeParams, reply interface{}) *Call {
+	const method = "initialize"
+	b := c.initRetry
+	if b == nil {
+		return c.Call(method, params, reply)
+	}
+	call := &Call{
+		Method: method,
+		Args:   params,
+		Reply:  reply,
+		done:   make(chan *Call, 1),
+	}
+	go func() {
+		var err error
+		for n := 0; ; n++ {
+			err = c.Call(method, params, reply).Wait()
+			if !isRetryableInitialize(err) {
+				break
+			}
+			if n == b.MaxRetries {
+				err = xerrors.Errorf("%w (after %d attempts)", err, n+1)
+				break
+			}
+			// if c is closed, the next attempt fails with ErrClosed.
+			t := time.NewTimer(b.delay(n + 1))
+			select {
+			case <-t.C:
+			case <-c.quit:
+				t.Stop()
+			}
+			c.debugf("retry initialize (%d/%d)\n", n+1, b.MaxRetries)
+		}
+		call.Error = err
+		call.done <- call
+	}()
+	return call
+}
+
+// isRetryableInitialize reports whether initialize that failed with err should be retried.
+func isRetryableInitialize(err error) bool {
+	if xerrors.Is(err, ErrTimeout) {
+		return true
+	}
+	var e *ResponseError
+	if !xerrors.As(err, &e) {
+		return false
+	}
+	return e.Code == CodeRequestCancelled || e.Code == CodeContentModified
+}
@@ -0,0 +1,158 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := &Backoff{
+		Initial:    10 * time.Millisecond,
+		Max:        50 * time.Millisecond,
+		Multiplier: 2,
+		Jitter:     -1,
+	}
+	want := []time.Duration{10, 20, 40, 50, 50}
+	for i, w := range want {
+		if d := b.Delay(i + 1); d != w*time.Millisecond {
+			t.Errorf("Delay(%d) = %v; want %v", i+1, d, w*time.Millisecond)
+		}
+	}
+
+	b.Jitter = 0.5
+	for n := 1; n <= 5; n++ {
+		d := b.Delay(n)
+		if max := want[n-1] * time.Millisecond; d > max || d < max/2 {
+			t.Errorf("Delay(%d) = %v; want in [%v, %v]", n, d, max/2, max)
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	b := &Backoff{Initial: time.Millisecond, MaxRetries: 3}
+	errDial := errors.New("crashed")
+
+	n := 0
+	c, err := Reconnect(context.Background(), b, func() (*Client, error) {
+		n++
+		if n < 3 {
+			return nil, errDial
+		}
+		return &Client{}, nil
+	})
+	if err != nil || c == nil {
+		t.Errorf("Reconnect = %v, %v; want a client", c, err)
+	}
+
+	n = 0
+	_, err = Reconnect(context.Background(), b, func() (*Client, error) {
+		n++
+		return nil, errDial
+	})
+	if !xerrors.Is(err, ErrGaveUp) {
+		t.Errorf("Reconnect = %v; want %v", err, ErrGaveUp)
+	}
+	if n != 4 {
+		t.Errorf("dial is called %d times; want 4", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Reconnect(ctx, &Backoff{Initial: time.Hour}, func() (*Client, error) {
+		return nil, errDial
+	})
+	if err != context.Canceled {
+		t.Errorf("Reconnect = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestClientRetryInitialize(t *testing.T) {
+	b := &Backoff{Initial: time.Millisecond, Jitter: -1, MaxRetries: 2}
+	c, s := newPipeClient(t, RetryInitialize(b), MethodTimeouts(0, map[string]time.Duration{
+		"initialize": 50 * time.Millisecond,
+	}))
+	defer c.Close()
+	defer s.Close()
+
+	r := c.Initialize(&InitializeParams{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.Wait()
+	}()
+	// the first attempt times out.
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := s.read(); err != nil {
+		t.Fatal(err)
+	} else if msg.Method != "$/cancelRequest" {
+		t.Fatalf("method = %q; want $/cancelRequest", msg.Method)
+	}
+	// the second attempt is cancelled by the server.
+	msg, err = s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "initialize" {
+		t.Fatalf("method = %q; want initialize", msg.Method)
+	}
+	err = s.write(&Message{ID: msg.ID, Error: &ResponseError{Code: CodeRequestCancelled, Message: "busy"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err = s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "initialize" {
+		t.Fatalf("method = %q; want initialize", msg.Method)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`{"capabilities":{"hoverProvider":true}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := s.read(); err != nil {
+		t.Fatal(err)
+	} else if msg.Method != "initialized" {
+		t.Fatalf("method = %q; want initialized", msg.Method)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if !r.Capabilities.HoverProvider {
+		t.Errorf("Capabilities = %+v; want the result of the last attempt", r.Capabilities)
+	}
+}
+
+func TestClientRetryInitializeGiveUp(t *testing.T) {
+	b := &Backoff{Initial: time.Millisecond, Jitter: -1, MaxRetries: 1}
+	c, s := newPipeClient(t, RetryInitialize(b))
+	defer c.Close()
+	defer s.Close()
+
+	r := c.Initialize(&InitializeParams{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.Wait()
+	}()
+	for i := 0; i < 2; i++ {
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.write(&Message{ID: msg.ID, Error: &ResponseError{Code: CodeContentModified, Message: "busy"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := <-errc
+	var e *ResponseError
+	if !xerrors.As(err, &e) || e.Code != CodeContentModified {
+		t.Errorf("Wait = %v; want the error of the last attempt", err)
+	}
+}
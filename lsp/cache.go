@@ -0,0 +1,87 @@
+package lsp
+
+import "encoding/json"
+
+// CacheResponses returns an option to cache responses of methods, such as
+// textDocument/hover and textDocument/definition, that are deterministic
+// for the same document version.
+//
+// Responses are cached per method, params and version of the document.
+// Requests for documents that are not opened are not cached because
+// they can be changed on disk. The cache of a document is invalidated
+// when the client sends didChange or didClose for it.
+func CacheResponses(methods ...string) Option {
+	m := make(map[string]bool)
+	for _, s := range methods {
+		m[s] = true
+	}
+	return func(c *Client) {
+		c.cacheable = m
+	}
+}
+
+type cacheKey struct {
+	method  string
+	uri     DocumentURI
+	version int
+	params  string
+}
+
+// cacheKey returns a key for the request of method with params.
+// If the request isn't cacheable, ok is false.
+func (c *Client) cacheKey(method string, params json.RawMessage) (key *cacheKey, ok bool) {
+	if !c.cacheable[method] {
+		return nil, false
+	}
+	var p struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.TextDocument.URI == "" {
+		return nil, false
+	}
+	version, ok := c.version(p.TextDocument.URI)
+	if !ok {
+		return nil, false
+	}
+	return &cacheKey{
+		method:  method,
+		uri:     p.TextDocument.URI,
+		version: version,
+		params:  string(params),
+	}, true
+}
+
+func (c *Client) cachedResult(key *cacheKey) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.cache[*key]
+	return result, ok
+}
+
+func (c *Client) storeResult(key *cacheKey, result json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.versions[key.uri]; !ok || v != key.version {
+		return // the document was changed while waiting the response
+	}
+	if c.cache == nil {
+		c.cache = make(map[cacheKey]json.RawMessage)
+	}
+	c.cache[*key] = result
+}
+
+// invalidateDocument removes cached results for uri.
+func (c *Client) invalidateDocument(uri DocumentURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateCache(uri)
+}
+
+// invalidateCache removes cached results for uri. c.mu must be held.
+func (c *Client) invalidateCache(uri DocumentURI) {
+	for key := range c.cache {
+		if key.uri == uri {
+			delete(c.cache, key)
+		}
+	}
+}
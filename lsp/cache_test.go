@@ -0,0 +1,118 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestClientCacheResponses(t *testing.T) {
+	c, s := newPipeClient(t, CacheResponses("textDocument/hover"))
+	defer c.Close()
+	defer s.Close()
+
+	requests := make(chan string, 10)
+	go func() {
+		n := 0
+		for {
+			msg, err := s.read()
+			if err != nil {
+				return
+			}
+			requests <- msg.Method
+			if msg.ID == 0 {
+				continue
+			}
+			n++
+			s.write(&Message{ID: msg.ID, Result: json.RawMessage(`{"n":` + strconv.Itoa(n) + `}`)})
+		}
+	}()
+
+	const uri = "file:///tmp/a.go"
+	params := &TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: 1, Character: 2},
+	}
+	hover := func() int {
+		t.Helper()
+		var reply struct{ N int }
+		if err := c.Wait(c.Call("textDocument/hover", params, &reply)); err != nil {
+			t.Fatalf("hover: %v", err)
+		}
+		return reply.N
+	}
+
+	if n := hover(); n != 1 {
+		t.Errorf("hover for unopened document = %d; want 1", n)
+	}
+	<-requests
+	if n := hover(); n != 2 {
+		t.Errorf("hover for unopened document shouldn't be cached: %d; want 2", n)
+	}
+	<-requests
+
+	err := c.DidOpenTextDocument(&DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, Version: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requests
+	if n := hover(); n != 3 {
+		t.Errorf("hover = %d; want 3", n)
+	}
+	<-requests
+	if n := hover(); n != 3 {
+		t.Errorf("hover = %d; want cached 3", n)
+	}
+
+	version := 2
+	err = c.DidChangeTextDocument(&DidChangeTextDocumentParams{
+		TextDocument: VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+			Version:                &version,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requests
+	if n := hover(); n != 4 {
+		t.Errorf("hover after didChange = %d; want 4", n)
+	}
+	<-requests
+
+	// didChange without a version also invalidates the cache.
+	if n := hover(); n != 4 {
+		t.Errorf("hover = %d; want cached 4", n)
+	}
+	err = c.DidChangeTextDocument(&DidChangeTextDocumentParams{
+		TextDocument: VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requests
+	if n := hover(); n != 5 {
+		t.Errorf("hover after didChange without version = %d; want 5", n)
+	}
+	<-requests
+	err = c.DidCloseTextDocument(&DidCloseTextDocumentParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requests
+	if n := hover(); n != 6 {
+		t.Errorf("hover after didClose = %d; want 6", n)
+	}
+	<-requests
+	select {
+	case method := <-requests:
+		t.Errorf("unexpected request: %s", method)
+	default:
+	}
+}
@@ -0,0 +1,86 @@
+package lsp
+
+import (
+	"encoding/json"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrCanceled is returned by calls that are canceled by CancelDocument.
+var ErrCanceled = xerrors.New("lsp: request is canceled")
+
+type cancelDocument struct {
+	uri  DocumentURI
+	done chan struct{}
+}
+
+// CancelDocument cancels all outstanding requests whose params refer to uri
+// with textDocument.uri or uri. It sends $/cancelRequest for each of them,
+// and the calls fail with ErrCanceled without waiting for the server.
+// Late responses to the canceled requests are discarded.
+func (c *Client) CancelDocument(uri DocumentURI) {
+	if uri == "" {
+		return
+	}
+	r := cancelDocument{
+		uri:  uri,
+		done: make(chan struct{}),
+	}
+	select {
+	case c.cancels <- r:
+	case <-c.quit:
+		return
+	}
+	<-r.done
+}
+
+// cancelCalls is called by the run loop to cancel calls in cache that refer to uri.
+func (c *Client) cancelCalls(cache map[int]*Call, uri DocumentURI) {
+	for _, call := range cache {
+		if call.uri == uri {
+			c.cancelCall(cache, call, ErrCanceled)
+		}
+	}
+}
+
+// cancelCall fails call in cache with err, then sends $/cancelRequest for it.
+// It is called by the run loop.
+func (c *Client) cancelCall(cache map[int]*Call, call *Call, err error) {
+	id := call.msg.ID
+	// keep the id reserved until the server responds to it.
+	cache[id] = &Call{
+		Method: call.Method,
+		Reply:  new(json.RawMessage),
+		msg:    call.msg,
+		done:   make(chan *Call, 1),
+	}
+	c.deletePartials(call)
+	if call.timer != nil {
+		call.timer.Stop()
+	}
+	call.Error = err
+	call.done <- call
+
+	n, e := c.newCall("$/cancelRequest", &CancelParams{ID: id}, nil)
+	if e != nil {
+		return
+	}
+	c.writes.push(n)
+}
+
+// paramsURI returns the document uri that params refer to.
+func paramsURI(params json.RawMessage) DocumentURI {
+	var p struct {
+		TextDocument struct {
+			URI DocumentURI `json:"uri"`
+		} `json:"textDocument"`
+		URI DocumentURI `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return ""
+	}
+	if p.TextDocument.URI != "" {
+		return p.TextDocument.URI
+	}
+	return p.URI
+}
@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestClientCancelDocument(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	const uri = "file:///home/me/a.go"
+	params := func(uri DocumentURI) *TextDocumentPositionParams {
+		return &TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: uri},
+		}
+	}
+	var reply1, reply2 json.RawMessage
+	call1 := c.Call("textDocument/hover", params(uri), &reply1)
+	msg1, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call2 := c.Call("textDocument/hover", params("file:///home/me/b.go"), &reply2)
+	msg2, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go c.CancelDocument(uri)
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "$/cancelRequest" {
+		t.Fatalf("method = %q; want $/cancelRequest", msg.Method)
+	}
+	var p CancelParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != msg1.ID {
+		t.Errorf("canceled id = %d; want %d", p.ID, msg1.ID)
+	}
+	if err := call1.Wait(); !xerrors.Is(err, ErrCanceled) {
+		t.Errorf("Wait = %v; want %v", err, ErrCanceled)
+	}
+
+	// a late response to the canceled request must not reach other calls.
+	if err := s.write(&Message{ID: msg1.ID, Result: json.RawMessage(`"late"`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: msg2.ID, Result: json.RawMessage(`"b"`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := call2.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if s := string(reply2); s != `"b"` {
+		t.Errorf("reply = %s; want %q", s, "b")
+	}
+}
+
+func TestClientMethodTimeouts(t *testing.T) {
+	c, s := newPipeClient(t, MethodTimeouts(time.Hour, map[string]time.Duration{
+		"textDocument/hover": 10 * time.Millisecond,
+	}))
+	defer c.Close()
+	defer s.Close()
+
+	if d := c.timeout("textDocument/definition"); d != time.Hour {
+		t.Errorf("default timeout = %v; want %v", d, time.Hour)
+	}
+	var reply json.RawMessage
+	call := c.Call("textDocument/hover", &TextDocumentPositionParams{}, &reply)
+	msg1, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "$/cancelRequest" {
+		t.Fatalf("method = %q; want $/cancelRequest", msg.Method)
+	}
+	if err := call.Wait(); !xerrors.Is(err, ErrTimeout) {
+		t.Errorf("Wait = %v; want %v", err, ErrTimeout)
+	}
+
+	// the late response must not be written to reply.
+	if err := s.write(&Message{ID: msg1.ID, Result: json.RawMessage(`{"x":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+	sync := c.Call("textDocument/definition", &TextDocumentPositionParams{}, new(json.RawMessage))
+	msg2, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: msg2.ID, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sync.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if reply != nil {
+		t.Errorf("reply = %s; want nil", reply)
+	}
+}
@@ -0,0 +1,135 @@
+package lsp
+
+import (
+	"encoding/json"
+)
+
+// ClientFeature is a feature of textDocument client capabilities,
+// named after its key in the specification.
+type ClientFeature string
+
+// ClientFeature values.
+const (
+	FeatureSynchronization    ClientFeature = "synchronization"
+	FeatureCompletion         ClientFeature = "completion"
+	FeatureHover              ClientFeature = "hover"
+	FeatureDeclaration        ClientFeature = "declaration"
+	FeatureDefinition         ClientFeature = "definition"
+	FeatureTypeDefinition     ClientFeature = "typeDefinition"
+	FeatureImplementation     ClientFeature = "implementation"
+	FeatureReferences         ClientFeature = "references"
+	FeatureDocumentSymbol     ClientFeature = "documentSymbol"
+	FeatureDocumentLink       ClientFeature = "documentLink"
+	FeatureCodeAction         ClientFeature = "codeAction"
+	FeaturePublishDiagnostics ClientFeature = "publishDiagnostics"
+	FeatureDiagnostic         ClientFeature = "diagnostic" // pull diagnostics
+)
+
+var clientFeatures = []ClientFeature{
+	FeatureSynchronization,
+	FeatureCompletion,
+	FeatureHover,
+	FeatureDeclaration,
+	FeatureDefinition,
+	FeatureTypeDefinition,
+	FeatureImplementation,
+	FeatureReferences,
+	FeatureDocumentSymbol,
+	FeatureDocumentLink,
+	FeatureCodeAction,
+	FeaturePublishDiagnostics,
+	FeatureDiagnostic,
+}
+
+// ClientCapabilitiesBuilder builds ClientCapabilities that advertise only selected features,
+// so that the server doesn't compute results the client ignores.
+// Enabled features have the settings of DefaultClientCapabilities.
+type ClientCapabilitiesBuilder struct {
+	enabled          map[ClientFeature]bool
+	workspaceFolders bool
+}
+
+// NewClientCapabilitiesBuilder returns a builder that enables the features
+// advertised by DefaultClientCapabilities.
+func NewClientCapabilitiesBuilder() *ClientCapabilitiesBuilder {
+	b := &ClientCapabilitiesBuilder{
+		enabled:          make(map[ClientFeature]bool),
+		workspaceFolders: true,
+	}
+	for _, f := range clientFeatures {
+		b.enabled[f] = f != FeatureDiagnostic
+	}
+	return b
+}
+
+// Enable enables features.
+func (b *ClientCapabilitiesBuilder) Enable(features ...ClientFeature) *ClientCapabilitiesBuilder {
+	for _, f := range features {
+		b.enabled[f] = true
+	}
+	return b
+}
+
+// Disable disables features. Disabled features are not sent to the server at all.
+func (b *ClientCapabilitiesBuilder) Disable(features ...ClientFeature) *ClientCapabilitiesBuilder {
+	for _, f := range features {
+		b.enabled[f] = false
+	}
+	return b
+}
+
+// Only enables features and disables all others.
+func (b *ClientCapabilitiesBuilder) Only(features ...ClientFeature) *ClientCapabilitiesBuilder {
+	for _, f := range clientFeatures {
+		b.enabled[f] = false
+	}
+	return b.Enable(features...)
+}
+
+// WorkspaceFolders sets whether the client supports workspace folders.
+func (b *ClientCapabilitiesBuilder) WorkspaceFolders(enabled bool) *ClientCapabilitiesBuilder {
+	b.workspaceFolders = enabled
+	return b
+}
+
+// Build returns the capabilities.
+func (b *ClientCapabilitiesBuilder) Build() *ClientCapabilities {
+	c := DefaultClientCapabilities()
+	c.Workspace.WorkspaceFolders = b.workspaceFolders
+	t := &c.TextDocument
+	if b.enabled[FeatureDiagnostic] {
+		t.Diagnostic = &struct {
+			DynamicRegistration    bool `json:"dynamicRegistration,omitempty"`
+			RelatedDocumentSupport bool `json:"relatedDocumentSupport,omitempty"`
+		}{}
+	}
+	for _, f := range clientFeatures {
+		// diagnostic is omitted by its nil pointer.
+		if b.enabled[f] || f == FeatureDiagnostic {
+			continue
+		}
+		if t.omit == nil {
+			t.omit = make(map[ClientFeature]bool)
+		}
+		t.omit[f] = true
+	}
+	return c
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// Features disabled by ClientCapabilitiesBuilder are omitted.
+func (t TextDocumentClientCapabilities) MarshalJSON() ([]byte, error) {
+	type caps TextDocumentClientCapabilities
+	b, err := json.Marshal(caps(t))
+	if err != nil || len(t.omit) == 0 {
+		return b, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for f := range t.omit {
+		delete(m, string(f))
+	}
+	return json.Marshal(m)
+}
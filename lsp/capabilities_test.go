@@ -0,0 +1,61 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClientCapabilitiesBuilder(t *testing.T) {
+	c := NewClientCapabilitiesBuilder().
+		Only(FeatureSynchronization, FeatureHover, FeatureDefinition, FeaturePublishDiagnostics).
+		WorkspaceFolders(false).
+		Build()
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Workspace    map[string]json.RawMessage `json:"workspace"`
+		TextDocument map[string]json.RawMessage `json:"textDocument"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.Workspace["workspaceFolders"]; ok {
+		t.Errorf("workspaceFolders is advertised")
+	}
+	want := map[string]bool{
+		"synchronization":    true,
+		"hover":              true,
+		"definition":         true,
+		"publishDiagnostics": true,
+	}
+	for key := range v.TextDocument {
+		if !want[key] {
+			t.Errorf("textDocument.%s is advertised", key)
+		}
+		delete(want, key)
+	}
+	for key := range want {
+		t.Errorf("textDocument.%s is not advertised", key)
+	}
+}
+
+func TestClientCapabilitiesBuilderDefault(t *testing.T) {
+	b1, err := json.Marshal(NewClientCapabilitiesBuilder().Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := json.Marshal(DefaultClientCapabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b1) != string(b2) {
+		t.Errorf("Build = %s; want %s", b1, b2)
+	}
+
+	c := NewClientCapabilitiesBuilder().Enable(FeatureDiagnostic).Build()
+	if c.TextDocument.Diagnostic == nil {
+		t.Errorf("diagnostic is not advertised")
+	}
+}
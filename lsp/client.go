@@ -4,14 +4,19 @@ package lsp
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/xerrors"
 )
@@ -28,21 +33,55 @@ func OpenCommand(name string, args ...string) (*PipeConn, error) {
 	cmd := exec.Command(name, args...)
 	w, err := cmd.StdinPipe()
 	if err != nil {
-		return nil, xerrors.Errorf("can't pipe: %w", err)
+		return nil, xerrors.Errorf("can't pipe to %s: %w", name, err)
 	}
 	r, err := cmd.StdoutPipe()
 	if err != nil {
 		w.Close()
-		return nil, xerrors.Errorf("can't pipe: %w", err)
+		return nil, xerrors.Errorf("can't pipe to %s: %w", name, err)
 	}
 	if err := cmd.Start(); err != nil {
 		r.Close()
 		w.Close()
-		return nil, xerrors.Errorf("can't start gopls: %w", err)
+		if xerrors.Is(err, exec.ErrNotFound) {
+			return nil, xerrors.Errorf("language server '%s' not found in PATH: %w", name, err)
+		}
+		return nil, xerrors.Errorf("can't start %s: %w", name, err)
 	}
 	return &PipeConn{cmd: cmd, r: r, w: w}, nil
 }
 
+// OpenCommandTimeout executes command, then sends the initialize request with params.
+// If the server doesn't respond within timeout, OpenCommandTimeout kills the process and returns an error.
+// If params.RootURI is empty, it is set to current directory.
+// The initialized notification is sent as well.
+func OpenCommandTimeout(timeout time.Duration, params *InitializeParams, name string, args ...string) (*Client, error) {
+	conn, err := OpenCommand(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(conn)
+	if params.RootURI == "" {
+		params.RootURI = c.URL(".")
+	}
+	r := c.Initialize(params)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.Wait()
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	case <-time.After(timeout):
+		c.Close()
+		return nil, xerrors.Errorf("%s didn't respond to initialize within %v", name, timeout)
+	}
+}
+
 // Read reads bytes from stdout of c.
 func (c *PipeConn) Read(b []byte) (int, error) {
 	return c.r.Read(b)
@@ -77,13 +116,13 @@ func (c *PipeConn) Close() error {
 }
 
 // Message represents request/response/notification messages.
-// If Params is not nil, client treats the message as a request.
+// If Method is not empty, client treats the message as a request.
 // If Result or Error is not nil, client treats the message as a response.
 // In addition to the above, If ID set to zero, client treats it as a notification.
 type Message struct {
 	Version string `json:"jsonrpc"`
 	ID      int    `json:"id,omitempty"`
-	Method  string `json:"method"`
+	Method  string `json:"method,omitempty"`
 
 	// This appears request or notification.
 	Params json.RawMessage `json:"params,omitempty"`
@@ -97,9 +136,22 @@ type Message struct {
 type ResponseError struct {
 	Code    int             `json:"code"`
 	Message string          `json:"message"`
-	Data    json.RawMessage `json:"data"`
+	Data    json.RawMessage `json:"data,omitempty"`
 }
 
+// Error codes defined by JSON-RPC and the specification.
+const (
+	CodeParseError           = -32700
+	CodeInvalidRequest       = -32600
+	CodeMethodNotFound       = -32601
+	CodeInvalidParams        = -32602
+	CodeInternalError        = -32603
+	CodeServerNotInitialized = -32002
+	CodeUnknownError         = -32001
+	CodeRequestCancelled     = -32800
+	CodeContentModified      = -32801
+)
+
 // Error implements error interface.
 func (e *ResponseError) Error() string {
 	return fmt.Sprintf("%d: %s", e.Code, e.Message)
@@ -112,71 +164,645 @@ type Call struct {
 	Reply  interface{}
 	Error  error
 
-	msg  *Message
-	done chan *Call
+	msg    *Message
+	tokens []ProgressToken // partial result and work done tokens
+	key    *cacheKey       // set if the response should be cached
+	uri    DocumentURI     // document that the request refers to; set by run loop
+	high   bool            // written before other calls; set by run loop
+	timer  *time.Timer     // fails the call on timeout; set by run loop
+	text   *string         // streamed in place of textSentinel
+	done   chan *Call
 }
 
 // Client represents a language server protocol client.
+//
+// Methods of Client are safe for concurrent use.
+// Messages are written to the server in the order their calls are made,
+// unless HighPriority is used, and writes don't block making other calls.
+// Messages that the server hasn't read yet wait in a queue, which is unbounded
+// unless MaxQueuedWrites is used; QueuedWrites reports its length.
+// Responses are matched to their requests by id, so the server may respond in any order.
 type Client struct {
 	BaseURL *url.URL
-	Event   chan *Message
 	Debug   bool
 
-	lastID int
-	conn   io.ReadWriteCloser
-	c      chan *Call
+	// Event receives notifications from the server that are not handled by the client.
+	// Requests without handlers are responded with MethodNotFound error instead.
+	// If the receiver is slow, new messages are dropped.
+	// Event is closed by Close after the client stops delivering messages,
+	// so ranging over it terminates; buffered messages are still received.
+	Event chan *Message
+
+	// If StrictDecoding is true, the client reports fields in results
+	// that its types don't model to stderr. Results are still decoded leniently.
+	// Fields decoded by custom UnmarshalJSON methods are not checked.
+	StrictDecoding bool
+
+	// Diagnostics receives textDocument/publishDiagnostics notifications
+	// instead of Event. If the receiver is slow, a pending publish of a document
+	// is replaced by newer one, so the latest diagnostics are never dropped.
+	Diagnostics chan *PublishDiagnosticsParams
+
+	// MinSeverity drops diagnostics less severe than it from Diagnostics.
+	// If MinSeverity is zero, all diagnostics are delivered.
+	MinSeverity DiagnosticSeverity
+
+	lastID  int
+	freeIDs []int      // ids that were responded; guarded by mu
+	genID   func() int // set by IDGenerator; read-only after NewClient
+	conn    io.ReadWriteCloser
+	c       chan *Call
+	cancels chan cancelDocument
+	aborts  chan abortCall // calls that timed out or were canceled by Do
+
+	quit      chan struct{} // closed by Close
+	closeOnce sync.Once
+	closeErr  error
+	wg        sync.WaitGroup // run, reader, writer and deliverDiagnostics
+	readErr   error          // set by reader before it exits
+	pending   int32          // number of requests waiting for responses; atomic
+	gone      chan struct{}  // closed when the connection is lost or c is closed
+	goneErr   error          // reason why gone is closed
+	diags     diagnosticQueue
+	subs      diagnosticSubs
+	writes    writeQueue
 
 	cap ServerCapabilities
+
+	manualInitialized bool                           // read-only after NewClient
+	readBufferSize    int                            // read-only after NewClient
+	highPriority      map[string]bool                // methods; read-only after NewClient
+	extraHeader       string                         // written after Content-Length; read-only after NewClient
+	maxQueued         int                            // read-only after NewClient
+	initRetry         *Backoff                       // read-only after NewClient
+	workDone          func(*Call, *WorkDoneProgress) // read-only after NewClient
+	timeouts          map[string]time.Duration       // read-only after NewClient
+	defaultTimeout    time.Duration                  // read-only after NewClient
+
+	// confirmEdit is set by ConfirmApplyEdit; read-only after NewClient.
+	confirmEdit func(label string, p *EditPreview) bool
+
+	// accept reports whether the client delivers notifications of method.
+	// If accept is nil, all notifications but ones in drop are delivered.
+	accept func(method string) bool
+	drop   map[string]bool // methods; read-only after NewClient
+
+	mu           sync.Mutex
+	pulled       map[DocumentURI]*DocumentDiagnosticReport // last full reports
+	handlers     map[string]Handler
+	collectors   map[DocumentURI]*editCollector   // documents of running executeCommandEdits
+	debouncers   map[*DidChangeDebouncer]struct{} // debouncers that have pending updates
+	versions     map[DocumentURI]int              // versions of open documents
+	texts        map[DocumentURI]string           // texts of open documents as the server knows
+	languages    map[DocumentURI]string           // language identifiers of open documents
+	lastToken    int
+	interceptors []Interceptor
+	cacheable    map[string]bool // methods; read-only after NewClient
+	cache        map[cacheKey]json.RawMessage
+	folders      []WorkspaceFolder
+	initialized  bool // initialized notification has been sent
+	serverInfo   *ServerInfo
+	status       Status
+	tap          func(b []byte, dir Direction)
+	content      ContentProvider
+	reinit       reinitState
+	logw         io.Writer // set by LogMessages; read-only after NewClient
+
+	stderr   io.Writer // for tests; os.Stderr if nil
+	partials map[ProgressToken]*partialQueue
+}
+
+func (c *Client) setVersion(uri DocumentURI, version int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.versions == nil {
+		c.versions = make(map[DocumentURI]int)
+	}
+	c.versions[uri] = version
+	c.invalidateCache(uri)
+}
+
+func (c *Client) deleteVersion(uri DocumentURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.versions, uri)
+	delete(c.texts, uri)
+	delete(c.languages, uri)
+	c.invalidateCache(uri)
+}
+
+// setLanguage records the language identifier of uri that was sent to the server.
+func (c *Client) setLanguage(uri DocumentURI, languageID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.languages == nil {
+		c.languages = make(map[DocumentURI]string)
+	}
+	c.languages[uri] = languageID
+}
+
+// setText records text of uri that was sent to the server.
+func (c *Client) setText(uri DocumentURI, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.texts == nil {
+		c.texts = make(map[DocumentURI]string)
+	}
+	c.texts[uri] = text
+}
+
+// text returns the text of uri that was sent to the server lastly.
+// If uri is not opened by DidOpenTextDocument, ok is false.
+func (c *Client) text(uri DocumentURI) (text string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	text, ok = c.texts[uri]
+	return
+}
+
+// version returns the version of uri that was sent to the server lastly.
+// If uri is not opened, ok is false.
+func (c *Client) version(uri DocumentURI) (version int, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	version, ok = c.versions[uri]
+	return
+}
+
+// Handler responds to a request from the server.
+// If err is a *ResponseError, the client sends it as the error of the response.
+// Other errors are sent as CodeInternalError.
+type Handler func(params json.RawMessage) (result interface{}, err error)
+
+// Handle registers h as the handler for requests of method from the server.
+// The handler runs on its own goroutine, so it can call other methods of c.
+// Requests of methods without handlers are responded with MethodNotFound error.
+// The client handles workspace/applyEdit by default with ApplyWorkspaceEdit;
+// registering a handler for it replaces the default.
+func (c *Client) Handle(method string, h Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handlers == nil {
+		c.handlers = make(map[string]Handler)
+	}
+	c.handlers[method] = h
+}
+
+func (c *Client) handler(method string) Handler {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.handlers[method]
+}
+
+// serve calls h with params of msg, then sends its result to the server.
+func (c *Client) serve(msg *Message, h Handler) {
+	resp := &Message{
+		Version: "2.0",
+		ID:      msg.ID,
+	}
+	result, err := h(msg.Params)
+	if err == nil {
+		resp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		var e *ResponseError
+		if !xerrors.As(err, &e) {
+			e = &ResponseError{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Result = nil
+		resp.Error = e
+	}
+	call := &Call{
+		Method: msg.Method,
+		Reply:  nil, // response doesn't wait for reply.
+		msg:    resp,
+		done:   make(chan *Call, 1),
+	}
+	if err := c.Wait(c.send(call)); err != nil {
+		c.debugf("can't respond to %s: %v\n", msg.Method, err)
+	}
+}
+
+// methodNotFound returns a handler that responds MethodNotFound error.
+func methodNotFound(method string) Handler {
+	return func(params json.RawMessage) (interface{}, error) {
+		return nil, &ResponseError{
+			Code:    CodeMethodNotFound,
+			Message: fmt.Sprintf("method not found: %s", method),
+		}
+	}
+}
+
+// Option configures a client created by NewClient.
+type Option func(c *Client)
+
+// defaultDropped are notifications that the client drops by default.
+// The client doesn't abort handlers of requests, so $/cancelRequest from the server is useless.
+var defaultDropped = []string{
+	"$/cancelRequest",
+}
+
+// DropNotifications returns an option to discard notifications of methods from the server.
+// Dropped notifications are neither decoded nor delivered to Event or Diagnostics,
+// so they don't occupy the buffer of Event.
+// Multiple DropNotifications options add up; $/cancelRequest is dropped by default.
+func DropNotifications(methods ...string) Option {
+	return func(c *Client) {
+		for _, s := range methods {
+			c.drop[s] = true
+		}
+	}
+}
+
+// AcceptNotifications returns an option to deliver only notifications of methods from the server.
+// Other notifications are discarded. Methods are delivered even if
+// they are dropped by default.
+func AcceptNotifications(methods ...string) Option {
+	m := make(map[string]bool)
+	for _, s := range methods {
+		m[s] = true
+	}
+	return func(c *Client) {
+		for _, s := range methods {
+			delete(c.drop, s)
+		}
+		c.accept = func(method string) bool {
+			return m[method]
+		}
+	}
+}
+
+// IDGenerator returns an option to allocate request ids with f instead of the built-in counter.
+// The client calls f serially, so f doesn't need to be safe for concurrent use.
+// The ids must be non-zero and unique among outstanding requests;
+// a request with an invalid id fails without being sent.
+func IDGenerator(f func() int) Option {
+	return func(c *Client) {
+		c.genID = f
+	}
+}
+
+// ManualInitialized returns an option to suppress sending the initialized notification
+// automatically after initialize. The caller must send it with Initialized.
+func ManualInitialized() Option {
+	return func(c *Client) {
+		c.manualInitialized = true
+	}
+}
+
+// HighPriority returns an option to write requests and notifications of methods
+// before other queued messages, so that interactive calls such as textDocument/hover
+// aren't delayed by bulk operations. A call of high priority still follows
+// queued didOpen, didChange, didClose, willSave and didSave of the document it refers to.
+func HighPriority(methods ...string) Option {
+	m := make(map[string]bool)
+	for _, s := range methods {
+		m[s] = true
+	}
+	return func(c *Client) {
+		c.highPriority = m
+	}
+}
+
+// Headers returns an option to write h as additional header fields of each message,
+// for example to authenticate to a proxy in front of a remote server.
+// The fields are written in sorted order after Content-Length.
+// Headers panics if a name or a value contains CR or LF, a name contains a colon,
+// or h contains Content-Length.
+func Headers(h map[string]string) Option {
+	names := make([]string, 0, len(h))
+	for name, v := range h {
+		if name == "" || strings.ContainsAny(name, ":\r\n") || strings.ContainsAny(v, "\r\n") {
+			panic(fmt.Sprintf("lsp: invalid header %q: %q", name, v))
+		}
+		if strings.EqualFold(name, "Content-Length") {
+			panic("lsp: Content-Length can't be set by Headers")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, h[name])
+	}
+	s := b.String()
+	return func(c *Client) {
+		c.extraHeader = s
+	}
+}
+
+// MaxQueuedWrites returns an option to limit the number of messages waiting to be written.
+// When n messages are queued, new requests fail with ErrQueueFull without being sent.
+// Notifications are always queued because dropping them would desynchronize documents.
+// If n is zero, the queue is unbounded.
+func MaxQueuedWrites(n int) Option {
+	return func(c *Client) {
+		c.maxQueued = n
+	}
+}
+
+// QueuedWrites returns the number of messages waiting to be written to the server.
+// It grows when the server reads messages slower than the client sends them.
+func (c *Client) QueuedWrites() int {
+	return c.writes.len()
+}
+
+// MethodTimeouts returns an option to fail requests that the server doesn't respond to in time.
+// The timeout of a method is m[method], or def if m doesn't have it.
+// A zero timeout means no timeout. A request that times out fails with ErrTimeout,
+// and $/cancelRequest is sent to the server; its late response is discarded.
+func MethodTimeouts(def time.Duration, m map[string]time.Duration) Option {
+	timeouts := make(map[string]time.Duration, len(m))
+	for method, d := range m {
+		timeouts[method] = d
+	}
+	return func(c *Client) {
+		c.defaultTimeout = def
+		c.timeouts = timeouts
+	}
+}
+
+func (c *Client) timeout(method string) time.Duration {
+	if d, ok := c.timeouts[method]; ok {
+		return d
+	}
+	return c.defaultTimeout
+}
+
+// abortCall requests the run loop to fail call with err if it is still waiting for the response.
+type abortCall struct {
+	call *Call
+	err  error
+}
+
+// abort passes call to the run loop to fail it with err.
+func (c *Client) abort(call *Call, err error) {
+	select {
+	case c.aborts <- abortCall{call: call, err: err}:
+	case <-c.quit:
+	}
+}
+
+// expireAfter aborts call with ErrTimeout after d.
+func (c *Client) expireAfter(call *Call, d time.Duration) *time.Timer {
+	return time.AfterFunc(d, func() {
+		c.abort(call, xerrors.Errorf("%w after %v", ErrTimeout, d))
+	})
+}
+
+const defaultReadBufferSize = 4096
+
+// ReadBufferSize returns an option to set the size of the buffer reading messages from the server.
+// Messages longer than the buffer are still read correctly.
+func ReadBufferSize(n int) Option {
+	return func(c *Client) {
+		c.readBufferSize = n
+	}
 }
 
 // NewClient returns a client that communicates to the server with conn.
 // This method starts goroutines, so you must call Close method after use.
-func NewClient(conn io.ReadWriteCloser) *Client {
+func NewClient(conn io.ReadWriteCloser, opts ...Option) *Client {
 	c := &Client{
-		Event: make(chan *Message, 10),
-		conn:  conn,
-		c:     make(chan *Call),
+		Event:       make(chan *Message, 10),
+		Diagnostics: make(chan *PublishDiagnosticsParams, 10),
+		conn:        conn,
+		c:           make(chan *Call),
+		cancels:     make(chan cancelDocument),
+		aborts:      make(chan abortCall),
+		quit:        make(chan struct{}),
+		gone:        make(chan struct{}),
+		diags: diagnosticQueue{
+			ready: make(chan struct{}, 1),
+		},
+		writes: writeQueue{
+			ready: make(chan struct{}, 1),
+		},
+		readBufferSize: defaultReadBufferSize,
+	}
+	c.handlers = map[string]Handler{
+		"workspace/applyEdit": c.applyEdit,
+	}
+	c.drop = make(map[string]bool)
+	for _, s := range defaultDropped {
+		c.drop[s] = true
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	c.wg.Add(4)
 	go c.run()
+	go c.deliverDiagnostics()
 	return c
 }
 
+// ErrClosed is returned by calls that are sent to or pending on the closed client.
+var ErrClosed = xerrors.New("lsp: client is closed")
+
+// ErrServerExited reports that the server closed the connection after shutdown or exit.
+var ErrServerExited = xerrors.New("lsp: server exited")
+
+// ErrServerLost reports that the connection to the server was lost unexpectedly.
+var ErrServerLost = xerrors.New("lsp: lost the connection to the server")
+
+// ErrTimeout is returned by requests that time out. See MethodTimeouts.
+var ErrTimeout = xerrors.New("lsp: request timed out")
+
+// ErrQueueFull is returned by requests that are rejected because
+// too many messages are waiting to be written. See MaxQueuedWrites.
+var ErrQueueFull = xerrors.New("lsp: too many queued messages")
+
+// ErrUnsupported is returned by calls of methods that the server doesn't advertise.
+// The error is wrapped with the method name.
+var ErrUnsupported = xerrors.New("lsp: not supported by the server")
+
+// DrainEvents returns messages that are buffered in c.Event without blocking.
+func (c *Client) DrainEvents() []*Message {
+	var a []*Message
+	for {
+		select {
+		case msg, ok := <-c.Event:
+			if !ok {
+				return a
+			}
+			a = append(a, msg)
+		default:
+			return a
+		}
+	}
+}
+
+// Done returns a channel that is closed when the connection to the server is lost or c is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.gone
+}
+
+// Err returns nil if Done is not closed yet. Otherwise Err returns
+// ErrServerExited if the server exited after shutdown or exit,
+// ErrClosed if c was closed, or an error wrapping ErrServerLost.
+func (c *Client) Err() error {
+	select {
+	case <-c.gone:
+		return c.goneErr
+	default:
+		return nil
+	}
+}
+
 func (c *Client) debugf(format string, args ...interface{}) {
 	if c.Debug {
-		fmt.Fprintf(os.Stderr, format, args...)
+		c.logf(format, args...)
 	}
 }
 
+func (c *Client) logf(format string, args ...interface{}) {
+	w := c.stderr
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// decodeResult decodes the result of method into reply.
+func (c *Client) decodeResult(method string, result json.RawMessage, reply interface{}) error {
+	if c.StrictDecoding {
+		d := json.NewDecoder(bytes.NewReader(result))
+		d.DisallowUnknownFields()
+		err := d.Decode(reply)
+		if err == nil {
+			return nil
+		}
+		c.logf("lsp: %s: %v\n", method, decodeError(result, err))
+	}
+	if err := json.Unmarshal(result, reply); err != nil {
+		return decodeError(result, err)
+	}
+	return nil
+}
+
+// CallFunc is the type of Client.Call.
+type CallFunc func(method string, args, reply interface{}) *Call
+
+// Interceptor returns a CallFunc that wraps next.
+// It can observe or modify args, or return a call without calling next.
+type Interceptor func(next CallFunc) CallFunc
+
+// Use adds interceptor that wraps every subsequent Call.
+// Interceptors are applied in the order they are added,
+// so the first one sees the call first.
+// Partial result requests and responses to the server don't pass through interceptors.
+func (c *Client) Use(interceptor Interceptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interceptors = append(c.interceptors, interceptor)
+}
+
 // Call calls the method with args. If reply is nil,
 // then call don't wait for reply. Therefore it is notification.
 // This is low level API.
 func (c *Client) Call(method string, args, reply interface{}) *Call {
+	c.mu.Lock()
+	a := c.interceptors
+	c.mu.Unlock()
+	f := CallFunc(c.call)
+	for i := len(a) - 1; i >= 0; i-- {
+		f = a[i](f)
+	}
+	return f(method, args, reply)
+}
+
+func (c *Client) call(method string, args, reply interface{}) *Call {
+	var key *cacheKey
+	if reply != nil && c.cacheable[method] {
+		params, err := json.Marshal(args)
+		if err != nil {
+			return failedCall(method, args, reply, err)
+		}
+		if k, ok := c.cacheKey(method, params); ok {
+			if result, ok := c.cachedResult(k); ok {
+				err := json.Unmarshal(result, reply)
+				return failedCall(method, args, reply, err)
+			}
+			key = k
+		}
+	}
+	call, err := c.newCall(method, args, reply)
+	if err != nil {
+		return failedCall(method, args, reply, err)
+	}
+	call.key = key
+	if c.workDone != nil && reply != nil && !lifecycleMethods[method] {
+		c.reportWorkDone(call)
+	}
+	return c.send(call)
+}
+
+// DoneCall returns a call that has already completed with err.
+// Interceptors can use it to respond without sending a request;
+// it is done when the reply is filled by the interceptor.
+func DoneCall(method string, args, reply interface{}, err error) *Call {
+	return failedCall(method, args, reply, err)
+}
+
+// send passes call to the run loop. If c is closed, call fails with ErrClosed.
+func (c *Client) send(call *Call) *Call {
+	select {
+	case c.c <- call:
+	case <-c.quit:
+		c.deletePartials(call)
+		call.Error = ErrClosed
+		call.done <- call
+	}
+	return call
+}
+
+func (c *Client) newCall(method string, args, reply interface{}) (*Call, error) {
+	params, text := streamedText(method, args)
+	r, err := c.makeRequest(method, params, reply)
+	if err != nil {
+		return nil, err
+	}
+	return &Call{
+		Method: method,
+		Args:   args,
+		Reply:  reply,
+		msg:    r,
+		text:   text,
+		done:   make(chan *Call, 1),
+	}, nil
+}
+
+// failedCall returns a call that has already completed with err.
+func failedCall(method string, args, reply interface{}, err error) *Call {
 	call := &Call{
 		Method: method,
 		Args:   args,
 		Reply:  reply,
+		Error:  err,
 		done:   make(chan *Call, 1),
 	}
-	r, err := c.makeRequest(method, args, reply)
-	if err != nil {
-		call.Error = err
-		call.done <- call
-		return call
-	}
-	call.msg = r
-	c.c <- call
+	call.done <- call
 	return call
 }
 
+// unsupported returns a call that fails because the server doesn't provide method.
+func (c *Client) unsupported(method string, args, reply interface{}) *Call {
+	err := xerrors.Errorf("%s: %w", method, ErrUnsupported)
+	return failedCall(method, args, reply, err)
+}
+
 func (c *Client) makeRequest(method string, args, reply interface{}) (*Message, error) {
 	params, err := json.Marshal(args)
 	if err != nil {
 		return nil, err
 	}
+	// params must be omitted, not null, for methods without params such as exit.
+	if string(params) == "null" {
+		params = nil
+	}
 	var id int
 	if reply != nil {
-		c.lastID++
-		id = c.lastID
+		id = c.allocID()
 	}
 	return &Message{
 		Version: "2.0",
@@ -186,46 +812,189 @@ func (c *Client) makeRequest(method string, args, reply interface{}) (*Message,
 	}, nil
 }
 
+// allocID returns an id for a new request.
+// It reuses ids that were released by releaseID to keep them small,
+// unless the ids are allocated by IDGenerator.
+func (c *Client) allocID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.genID != nil {
+		return c.genID()
+	}
+	if n := len(c.freeIDs); n > 0 {
+		id := c.freeIDs[n-1]
+		c.freeIDs = c.freeIDs[:n-1]
+		return id
+	}
+	c.lastID++
+	return c.lastID
+}
+
+// releaseID makes id available for new requests.
+// It must be called after the call of id was removed from the cache.
+func (c *Client) releaseID(id int) {
+	if c.genID != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.freeIDs = append(c.freeIDs, id)
+}
+
 // Wait waits for a response of call.
 // This is low level API.
 func (c *Client) Wait(call *Call) error {
+	return call.Wait()
+}
+
+// Wait waits for a response of call. It is same as Client.Wait.
+// An error of a request is wrapped with its method and id.
+func (call *Call) Wait() error {
 	call = <-call.done
-	if call.Error != nil {
+	return call.err()
+}
+
+func (call *Call) err() error {
+	if call.Error == nil || call.msg == nil || call.msg.ID == 0 {
 		return call.Error
 	}
-	return nil
+	return xerrors.Errorf("%s (#%d): %w", call.Method, call.msg.ID, call.Error)
+}
+
+// CancelParams represents the interface described in the specification.
+type CancelParams struct {
+	ID int `json:"id"`
+}
+
+// Do calls the method with args and waits for its reply.
+// If ctx is done before the reply, Do sends $/cancelRequest to the server,
+// discards the late response and returns ctx.Err() wrapped with the method and id of the request.
+// This is low level API.
+func (c *Client) Do(ctx context.Context, method string, args, reply interface{}) error {
+	call := c.Call(method, args, reply)
+	select {
+	case <-call.done:
+		return call.err()
+	case <-ctx.Done():
+	}
+	if call.msg == nil || call.msg.ID == 0 {
+		return ctx.Err()
+	}
+	// the run loop sends $/cancelRequest and discards the late response,
+	// unless the response has already arrived.
+	c.abort(call, ctx.Err())
+	<-call.done
+	return call.err()
+}
+
+// Waiter is the interface implemented by calls and results of requests.
+type Waiter interface {
+	Wait() error
+}
+
+// WaitAll waits for all of ws to complete.
+// It returns the first error of ws in the argument order, if any.
+func WaitAll(ws ...Waiter) error {
+	var err error
+	for _, w := range ws {
+		if e := w.Wait(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
 func (c *Client) reader(replyc chan<- *Message) {
+	defer c.wg.Done()
 	defer close(replyc)
-	r := bufio.NewReader(c.conn)
+	r := bufio.NewReaderSize(c.conn, c.readBufferSize)
 	for {
-		msg, err := c.readMessage(r)
-		if err == io.EOF {
+		// A timeout between messages is benign unless requests are waiting.
+		if _, err := r.Peek(1); err != nil {
+			if isTimeout(err) && atomic.LoadInt32(&c.pending) == 0 {
+				continue
+			}
+			if isTimeout(err) {
+				err = xerrors.Errorf("no response from the server: %w", err)
+			}
+			c.readErr = err
 			return
 		}
+		msg, err := c.readMessage(r)
 		if err != nil {
-			// TODO(lufia): where do we pass an error?
+			c.readErr = err
+			return
+		}
+		select {
+		case replyc <- msg:
+		case <-c.quit:
 			return
 		}
-		replyc <- msg
 	}
 }
 
 func (c *Client) run() {
-	callc := c.c
+	defer c.wg.Done()
 	replyc := make(chan *Message, 1)
 	go c.reader(replyc)
+	errc := make(chan writeError)
+	go c.writer(errc)
 
 	cache := make(map[int]*Call)
-	for callc != nil || replyc != nil {
+	var (
+		broken error // set if the connection can't be read anymore
+		exited bool  // shutdown or exit has been sent to the server
+	)
+	for {
+		atomic.StoreInt32(&c.pending, int32(len(cache)))
 		select {
+		case <-c.quit:
+			c.setStatus(StatusDisconnected)
+			c.failCalls(cache, ErrClosed)
+			if broken == nil {
+				c.goneErr = ErrClosed
+				close(c.gone)
+			}
+			close(c.Event)
+			return
 		case msg, ok := <-replyc:
 			if !ok {
 				replyc = nil
+				if c.readErr == io.EOF && exited {
+					broken = ErrServerExited
+				} else {
+					broken = xerrors.Errorf("%w: %v", ErrServerLost, c.readErr)
+				}
+				c.setStatus(StatusDead)
+				c.failCalls(cache, broken)
+				c.goneErr = broken
+				close(c.gone)
 				continue
 			}
-			if msg.Params != nil { // request from the server
+			if msg.Method != "" { // request from the server
+				if msg.ID != 0 {
+					h := c.handler(msg.Method)
+					if h == nil {
+						h = methodNotFound(msg.Method)
+					}
+					if msg.Method == "workspace/applyEdit" {
+						h = c.collectEdits(h)
+					}
+					go c.serve(msg, h)
+					continue
+				}
+				if msg.Method == "$/progress" && c.progress(msg) {
+					continue
+				}
+				if c.drop[msg.Method] || c.accept != nil && !c.accept(msg.Method) {
+					continue
+				}
+				if msg.Method == "textDocument/publishDiagnostics" && c.publishDiagnostics(msg) {
+					continue
+				}
+				if msg.Method == "window/logMessage" && c.logw != nil && c.logMessage(msg) {
+					continue
+				}
 				// shouldn't block even if c.Event is full.
 				select {
 				case c.Event <- msg:
@@ -239,45 +1008,326 @@ func (c *Client) run() {
 				continue
 			}
 			delete(cache, msg.ID)
+			c.releaseID(msg.ID)
+			c.deletePartials(call)
+			if call.timer != nil {
+				call.timer.Stop()
+			}
 			if msg.Error != nil {
 				call.Error = msg.Error
 				call.done <- call
 				continue
 			}
-			err := json.Unmarshal([]byte(msg.Result), call.Reply)
+			err := c.decodeResult(call.Method, msg.Result, call.Reply)
 			if err != nil {
 				call.Error = err
 				call.done <- call
 				continue
 			}
+			if call.key != nil {
+				c.storeResult(call.key, msg.Result)
+			}
+			if call.Method == "shutdown" {
+				exited = true
+			}
 			call.done <- call
-		case call, ok := <-callc:
-			if !ok {
-				callc = nil
+		case e := <-errc:
+			// the request may have been failed already due to broken connection.
+			if cache[e.call.msg.ID] != e.call {
 				continue
 			}
-			if err := c.writeJSON(call.msg); err != nil {
-				call.Error = err
+			delete(cache, e.call.msg.ID)
+			c.releaseID(e.call.msg.ID)
+			c.deletePartials(e.call)
+			e.call.Error = e.err
+			e.call.done <- e.call
+		case call := <-c.c:
+			if broken != nil {
+				if call.Reply != nil {
+					c.releaseID(call.msg.ID)
+				}
+				c.deletePartials(call)
+				call.Error = broken
 				call.done <- call
 				continue
 			}
-			if call.msg.ID == 0 {
+			if call.Reply != nil {
+				if id := call.msg.ID; id == 0 || cache[id] != nil {
+					c.deletePartials(call)
+					call.Error = xerrors.Errorf("%s: request id %d is already in use or invalid", call.Method, id)
+					call.done <- call
+					continue
+				}
+			}
+			if call.Reply != nil && c.maxQueued > 0 && c.writes.len() >= c.maxQueued {
+				c.releaseID(call.msg.ID)
+				c.deletePartials(call)
+				call.Error = xerrors.Errorf("%s: %w", call.Method, ErrQueueFull)
 				call.done <- call
 				continue
 			}
-			cache[call.msg.ID] = call
+			if call.Method == "exit" {
+				exited = true
+			}
+			// register the call before it is written
+			// so that its response can't arrive before it.
+			if call.Reply != nil || c.highPriority != nil {
+				call.uri = paramsURI(call.msg.Params)
+			}
+			call.high = c.highPriority[call.Method]
+			if call.Reply != nil {
+				cache[call.msg.ID] = call
+				if d := c.timeout(call.Method); d > 0 {
+					call.timer = c.expireAfter(call, d)
+				}
+			}
+			c.writes.push(call)
+		case r := <-c.aborts:
+			if cache[r.call.msg.ID] == r.call {
+				c.cancelCall(cache, r.call, r.err)
+			}
+		case r := <-c.cancels:
+			c.cancelCalls(cache, r.uri)
+			close(r.done)
+		}
+	}
+}
+
+type writeError struct {
+	call *Call
+	err  error
+}
+
+// writeQueue holds calls that are waiting to be written in order.
+// Calls of high priority are written before others, but never before
+// a preceding synchronization of the document they refer to.
+type writeQueue struct {
+	mu    sync.Mutex
+	calls []*Call
+	high  []*Call
+	ready chan struct{}
+}
+
+func (q *writeQueue) push(call *Call) {
+	q.mu.Lock()
+	if call.high {
+		q.high = append(q.high, call)
+	} else {
+		q.calls = append(q.calls, call)
+	}
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *writeQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.calls) + len(q.high)
+}
+
+// pop returns the next call to write, or nil if the queue is empty.
+func (q *writeQueue) pop() *Call {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.high) > 0 {
+		call := q.high[0]
+		if i := q.indexSync(call.uri); i >= 0 {
+			return q.remove(i)
+		}
+		q.high[0] = nil
+		q.high = q.high[1:]
+		return call
+	}
+	if len(q.calls) == 0 {
+		return nil
+	}
+	return q.remove(0)
+}
+
+// indexSync returns the index of the first queued document synchronization of uri, or -1.
+func (q *writeQueue) indexSync(uri DocumentURI) int {
+	if uri == "" {
+		return -1
+	}
+	for i, call := range q.calls {
+		if call.uri == uri && syncMethods[call.Method] {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *writeQueue) remove(i int) *Call {
+	call := q.calls[i]
+	if i == 0 {
+		q.calls[0] = nil
+		q.calls = q.calls[1:]
+		return call
+	}
+	n := copy(q.calls[i:], q.calls[i+1:])
+	q.calls[i+n] = nil
+	q.calls = q.calls[:i+n]
+	return call
+}
+
+// syncMethods are notifications that change the state of documents in the server.
+var syncMethods = map[string]bool{
+	"textDocument/didOpen":   true,
+	"textDocument/didChange": true,
+	"textDocument/didClose":  true,
+	"textDocument/didSave":   true,
+	"textDocument/willSave":  true,
+}
+
+// writer writes queued calls to the connection, so that run don't block on writes.
+// Failures of requests are sent to errc because run owns pending requests.
+func (c *Client) writer(errc chan<- writeError) {
+	defer c.wg.Done()
+	for {
+		call := c.writes.pop()
+		if call == nil {
+			select {
+			case <-c.writes.ready:
+				continue
+			case <-c.quit:
+				c.failWrites()
+				return
+			}
+		}
+		err := c.writeCall(call)
+		if call.Reply == nil { // notification or response
+			call.Error = err
+			call.done <- call
+			continue
+		}
+		if err != nil {
+			select {
+			case errc <- writeError{call: call, err: err}:
+			case <-c.quit:
+				c.failWrites()
+				return
+			}
+		}
+	}
+}
+
+// failWrites completes notifications in the queue with ErrClosed.
+// Requests are completed by run.
+func (c *Client) failWrites() {
+	for call := c.writes.pop(); call != nil; call = c.writes.pop() {
+		if call.Reply == nil {
+			call.Error = ErrClosed
+			call.done <- call
+		}
+	}
+}
+
+// failCalls completes all calls in cache with err.
+func (c *Client) failCalls(cache map[int]*Call, err error) {
+	for id, call := range cache {
+		delete(cache, id)
+		c.releaseID(id)
+		c.deletePartials(call)
+		call.Error = err
+		call.done <- call
+	}
+}
+
+// publishDiagnostics sends the diagnostics in msg to c.Diagnostics.
+// It returns false if msg can't be decoded.
+func (c *Client) publishDiagnostics(msg *Message) bool {
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return false
+	}
+	params.Diagnostics = FilterDiagnostics(params.Diagnostics, c.MinSeverity)
+	c.diags.push(&params)
+	c.subs.publish(&params)
+	return true
+}
+
+// diagnosticQueue holds diagnostics that are waiting to be sent to Diagnostics.
+// It holds only the latest diagnostics for each document.
+type diagnosticQueue struct {
+	mu    sync.Mutex
+	uris  []DocumentURI // in order of arrival
+	m     map[DocumentURI]*PublishDiagnosticsParams
+	ready chan struct{}
+}
+
+func (q *diagnosticQueue) push(params *PublishDiagnosticsParams) {
+	q.mu.Lock()
+	if q.m == nil {
+		q.m = make(map[DocumentURI]*PublishDiagnosticsParams)
+	}
+	if _, ok := q.m[params.URI]; !ok {
+		q.uris = append(q.uris, params.URI)
+	}
+	q.m[params.URI] = params
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the oldest pending diagnostics, or nil if nothing is pending.
+func (q *diagnosticQueue) pop() *PublishDiagnosticsParams {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.uris) == 0 {
+		return nil
+	}
+	uri := q.uris[0]
+	q.uris = q.uris[1:]
+	params := q.m[uri]
+	delete(q.m, uri)
+	return params
+}
+
+// deliverDiagnostics sends pending diagnostics to c.Diagnostics until c is closed,
+// then closes c.Diagnostics and the channels subscribed by SubscribeDiagnostics.
+func (c *Client) deliverDiagnostics() {
+	defer c.wg.Done()
+	defer close(c.Diagnostics)
+	defer c.subs.close()
+	for {
+		params := c.diags.pop()
+		if params == nil {
+			select {
+			case <-c.diags.ready:
+				continue
+			case <-c.quit:
+				return
+			}
+		}
+		select {
+		case c.Diagnostics <- params:
+		case <-c.quit:
+			return
 		}
 	}
-	close(c.Event)
 }
 
 func (c *Client) readMessage(r *bufio.Reader) (*Message, error) {
-	var contentLen int64
+	var (
+		contentLen int64 = -1
+		header     bytes.Buffer
+	)
+	// ReadString collects a line even if it arrives in fragments
+	// or it is longer than the buffer of r.
 	for {
 		s, err := r.ReadString('\n')
 		if err != nil {
+			if err == io.EOF && header.Len() > 0 {
+				err = io.ErrUnexpectedEOF
+			}
 			return nil, err
 		}
+		header.WriteString(s)
 		s = strings.TrimSpace(s)
 		if s == "" {
 			break
@@ -286,21 +1336,32 @@ func (c *Client) readMessage(r *bufio.Reader) (*Message, error) {
 		if len(a) < 2 {
 			continue
 		}
-		switch strings.TrimSpace(a[0]) {
-		case "Content-Length":
+		// header names are case-insensitive; unknown ones are ignored.
+		switch strings.ToLower(strings.TrimSpace(a[0])) {
+		case "content-length":
 			v := strings.TrimSpace(a[1])
-			contentLen, _ = strconv.ParseInt(v, 10, 64)
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return nil, xerrors.Errorf("invalid Content-Length: %q", v)
+			}
+			contentLen = n
 		}
 	}
+	if contentLen < 0 {
+		return nil, xerrors.Errorf("missing Content-Length in header: %q", header.String())
+	}
 
 	buf := bytes.NewBuffer(make([]byte, 0, contentLen))
 	if _, err := io.CopyN(buf, r, contentLen); err != nil {
 		return nil, err
 	}
 	c.debugf("<- '%s'\n", buf.Bytes())
+	if tap := c.wireTap(); tap != nil {
+		tap(append(header.Bytes(), buf.Bytes()...), Incoming)
+	}
 	var msg Message
 	if err := json.Unmarshal(buf.Bytes(), &msg); err != nil {
-		return nil, err
+		return nil, decodeError(buf.Bytes(), err)
 	}
 	return &msg, nil
 }
@@ -311,19 +1372,63 @@ func (c *Client) writeJSON(args interface{}) error {
 		return xerrors.Errorf("can't marshal: %w", err)
 	}
 	c.debugf("-> '%s'\n", p)
-	_, err = fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n", len(p))
-	if err != nil {
-		return xerrors.Errorf("can't write: %w", err)
+	b := append([]byte(fmt.Sprintf("Content-Length: %d\r\n%s\r\n", len(p), c.extraHeader)), p...)
+	if tap := c.wireTap(); tap != nil {
+		tap(b, Outgoing)
 	}
-	_, err = c.conn.Write(p)
+	_, err = c.conn.Write(b)
 	if err != nil {
 		return xerrors.Errorf("can't write: %w", err)
 	}
 	return nil
 }
 
+// Direction represents the direction of a message.
+type Direction int
+
+// Direction values.
+const (
+	Incoming Direction = iota + 1 // from the server
+	Outgoing                      // to the server
+)
+
+// String returns "in" or "out".
+func (d Direction) String() string {
+	switch d {
+	case Incoming:
+		return "in"
+	case Outgoing:
+		return "out"
+	default:
+		return fmt.Sprintf("Direction(%d)", int(d))
+	}
+}
+
+// SetWireTap sets tap that is called with each framed message, including its header,
+// exactly as read from or written to the connection. The tap must not retain b.
+// If tap is nil, SetWireTap removes the current tap.
+func (c *Client) SetWireTap(tap func(b []byte, dir Direction)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tap = tap
+}
+
+func (c *Client) wireTap() func([]byte, Direction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tap
+}
+
 // Close closes underlying resources such as a connection and goroutines.
+// Pending calls fail with ErrClosed, and pending updates of debouncers are discarded.
+// Close waits for the goroutines to exit.
+// It is safe to call Close more than once.
 func (c *Client) Close() error {
-	close(c.c)
-	return c.conn.Close()
+	c.closeOnce.Do(func() {
+		close(c.quit)
+		c.stopDebouncers()
+		c.closeErr = c.conn.Close()
+		c.wg.Wait()
+	})
+	return c.closeErr
 }
@@ -1,9 +1,25 @@
 package lsp
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"golang.org/x/xerrors"
 )
 
 func TestMessage(t *testing.T) {
@@ -56,6 +72,72 @@ func TestMessage(t *testing.T) {
 	}
 }
 
+func TestReadMessageFragmented(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"result":{"value":"` + strings.Repeat("x", 100) + `"}}`
+	var b strings.Builder
+	for i := 0; i < 2; i++ {
+		fmt.Fprintf(&b, "X-Long-Header: %s\r\n", strings.Repeat("y", 200))
+		fmt.Fprintf(&b, "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n")
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+		for j := 0; j < 20; j++ {
+			fmt.Fprintf(&b, "X-Header-%d: %d\r\n", j, j)
+		}
+		b.WriteString("\r\n")
+		b.WriteString(body)
+	}
+	var c Client
+	r := bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(b.String())), 16)
+	for i := 0; i < 2; i++ {
+		msg, err := c.readMessage(r)
+		if err != nil {
+			t.Fatalf("readMessage #%d: %v", i, err)
+		}
+		if msg.ID != 1 || !strings.Contains(string(msg.Result), strings.Repeat("x", 100)) {
+			t.Errorf("readMessage #%d = %+v", i, msg)
+		}
+	}
+	if _, err := c.readMessage(r); err != io.EOF {
+		t.Errorf("readMessage at the end = %v; want io.EOF", err)
+	}
+}
+
+func TestReadMessageHeaderCase(t *testing.T) {
+	const body = `{"jsonrpc":"2.0","id":3,"result":null}`
+	tests := []string{
+		"content-length: %d\r\n\r\n%s",
+		"CONTENT-LENGTH: %d\r\n\r\n%s",
+		"X-Unknown: 1\r\ncontent-Length:%d\r\nx-other: a:b\r\n\r\n%s",
+	}
+	var c Client
+	for _, format := range tests {
+		s := fmt.Sprintf(format, len(body), body)
+		msg, err := c.readMessage(bufio.NewReader(strings.NewReader(s)))
+		if err != nil {
+			t.Errorf("readMessage(%q): %v", s, err)
+			continue
+		}
+		if msg.ID != 3 {
+			t.Errorf("readMessage(%q).ID = %d; want 3", s, msg.ID)
+		}
+	}
+}
+
+func TestReadMessageInvalidHeader(t *testing.T) {
+	tests := []string{
+		"Content-Type: x\r\n\r\n{}",
+		"Content-Length: -1\r\n\r\n{}",
+		"Content-Length: abc\r\n\r\n{}",
+		"Content-Length: 2\r\n",
+	}
+	var c Client
+	for _, s := range tests {
+		r := bufio.NewReader(strings.NewReader(s))
+		if _, err := c.readMessage(r); err == nil || err == io.EOF {
+			t.Errorf("readMessage(%q) = %v; want an error", s, err)
+		}
+	}
+}
+
 func TestPLS(t *testing.T) {
 	conn, err := OpenCommand("gopls", "-v", "serve")
 	if err != nil {
@@ -249,6 +331,38 @@ func TestPLS(t *testing.T) {
 	c.Close()
 }
 
+func TestOpenCommandNotFound(t *testing.T) {
+	const name = "no-such-language-server"
+	_, err := OpenCommand(name)
+	if err == nil {
+		t.Fatalf("OpenCommand(%q) should fail", name)
+	}
+	if !xerrors.Is(err, exec.ErrNotFound) {
+		t.Errorf("OpenCommand(%q) = %v; want exec.ErrNotFound", name, err)
+	}
+	if !strings.Contains(err.Error(), name) {
+		t.Errorf("OpenCommand(%q) = %v; should contain the command name", name, err)
+	}
+}
+
+func TestOpenCommandTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip(err)
+	}
+	start := time.Now()
+	c, err := OpenCommandTimeout(100*time.Millisecond, &InitializeParams{}, "sleep", "10")
+	if err == nil {
+		c.Close()
+		t.Fatalf("OpenCommandTimeout should fail if the server doesn't respond")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("OpenCommandTimeout took %v; want to fail around the timeout", d)
+	}
+	if !strings.Contains(err.Error(), "sleep") {
+		t.Errorf("OpenCommandTimeout = %v; should contain the command name", err)
+	}
+}
+
 // textDocument/didChange
 // ->textDocument/publishDiagnostics
 // textDocument/didClose
@@ -287,3 +401,1315 @@ func TestClientEventOverflow(t *testing.T) {
 		t.Errorf("Wait(): %v", err)
 	}
 }
+
+// pipeServer is a fake server that is connected to a client with net.Pipe.
+type pipeServer struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *Client // for writeJSON
+}
+
+func newPipeClient(t *testing.T, opts ...Option) (*Client, *pipeServer) {
+	t.Helper()
+	cconn, sconn := net.Pipe()
+	c := NewClient(cconn, opts...)
+	s := &pipeServer{
+		conn: sconn,
+		r:    bufio.NewReader(sconn),
+		w:    &Client{conn: sconn},
+	}
+	return c, s
+}
+
+func (s *pipeServer) read() (*Message, error) {
+	return s.w.readMessage(s.r)
+}
+
+func (s *pipeServer) write(msg *Message) error {
+	msg.Version = "2.0"
+	return s.w.writeJSON(msg)
+}
+
+// initialize completes the initialize request of c with result.
+// It also consumes the initialized notification unless c is created with ManualInitialized.
+func (s *pipeServer) initialize(t *testing.T, c *Client, result string) *InitializeResult {
+	t.Helper()
+	r := c.Initialize(&InitializeParams{RootURI: "file:///home/me/a"})
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(result)}); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.Wait()
+	}()
+	if !c.manualInitialized {
+		if msg, err := s.read(); err != nil {
+			t.Fatal(err)
+		} else if msg.Method != "initialized" {
+			t.Fatalf("method = %q; want initialized", msg.Method)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return r
+}
+
+func (s *pipeServer) Close() error {
+	return s.conn.Close()
+}
+
+func TestClientDiagnostics(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	err := s.write(&Message{
+		Method: "textDocument/publishDiagnostics",
+		Params: json.RawMessage(`{
+			"uri": "file:///tmp/a.go",
+			"diagnostics": [{
+				"range": {"start": {"line": 3, "character": 5}, "end": {"line": 3, "character": 6}},
+				"severity": 1,
+				"message": "x redeclared in this block",
+				"relatedInformation": [{
+					"location": {
+						"uri": "file:///tmp/b.go",
+						"range": {"start": {"line": 1, "character": 5}, "end": {"line": 1, "character": 6}}
+					},
+					"message": "other declaration of x"
+				}]
+			}]
+		}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := <-c.Diagnostics
+	if n := len(params.Diagnostics); n != 1 {
+		t.Fatalf("len(Diagnostics) = %d; want 1", n)
+	}
+	a := params.Diagnostics[0].RelatedInformation
+	if len(a) != 1 {
+		t.Fatalf("len(RelatedInformation) = %d; want 1", len(a))
+	}
+	want := DocumentURI("file:///tmp/b.go")
+	if uri := a[0].Location.URI; uri != want {
+		t.Errorf("Location.URI = %v; want %v", uri, want)
+	}
+}
+
+func TestClientDropNotifications(t *testing.T) {
+	c, s := newPipeClient(t, DropNotifications("textDocument/publishDiagnostics"))
+	defer c.Close()
+	defer s.Close()
+
+	methods := []string{"textDocument/publishDiagnostics", "window/logMessage"}
+	for _, method := range methods {
+		err := s.write(&Message{
+			Method: method,
+			Params: json.RawMessage(`{"uri":"file:///tmp/a.go","diagnostics":[]}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg := <-c.Event
+	if msg.Method != "window/logMessage" {
+		t.Errorf("Method = %q; want window/logMessage", msg.Method)
+	}
+	select {
+	case params := <-c.Diagnostics:
+		t.Errorf("dropped diagnostics are delivered: %v", params)
+	default:
+	}
+}
+
+func TestClientRecycleID(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		var reply interface{}
+		call := c.Call("test/method", nil, &reply)
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID != 1 {
+			t.Errorf("ID = %d; want 1", msg.ID)
+		}
+		if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Wait(call); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+}
+
+func TestClientHandle(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	c.Handle("workspace/configuration", func(params json.RawMessage) (interface{}, error) {
+		return nil, &ResponseError{Code: CodeInvalidParams, Message: "no configuration"}
+	})
+	c.Handle("test/echo", func(params json.RawMessage) (interface{}, error) {
+		return params, nil
+	})
+
+	tests := []struct {
+		method string
+		result string
+		code   int
+	}{
+		{method: "workspace/configuration", code: CodeInvalidParams},
+		{method: "test/echo", result: `{"a":1}`},
+	}
+	for i, tt := range tests {
+		id := i + 100
+		err := s.write(&Message{
+			ID:     id,
+			Method: tt.method,
+			Params: json.RawMessage(`{"a":1}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID != id {
+			t.Errorf("%s: ID = %d; want %d", tt.method, msg.ID, id)
+		}
+		if msg.Method != "" {
+			t.Errorf("%s: response shouldn't have method: %q", tt.method, msg.Method)
+		}
+		if tt.code != 0 {
+			if msg.Error == nil || msg.Error.Code != tt.code {
+				t.Errorf("%s: Error = %v; want code %d", tt.method, msg.Error, tt.code)
+			}
+			continue
+		}
+		if s := string(msg.Result); s != tt.result {
+			t.Errorf("%s: Result = %s; want %s", tt.method, s, tt.result)
+		}
+	}
+}
+
+func TestClientReferencesPartial(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	c.cap.ReferencesProvider = true
+	var chunks [][]Location
+	r := c.ReferencesPartial(&ReferenceParams{}, func(locations []Location) {
+		chunks = append(chunks, locations)
+	})
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params ReferenceParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	token, err := json.Marshal(params.PartialResultToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uri := range []string{"file:///a.go", "file:///b.go"} {
+		err := s.write(&Message{
+			Method: "$/progress",
+			Params: json.RawMessage(`{"token":` + string(token) + `,"value":[{"uri":"` + uri + `"}]}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`[{"uri":"file:///c.go"}]`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("received %d chunks; want 2", len(chunks))
+	}
+	var a []DocumentURI
+	for _, l := range r.Locations {
+		a = append(a, l.URI)
+	}
+	want := []DocumentURI{"file:///a.go", "file:///b.go", "file:///c.go"}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("Locations = %v; want %v", a, want)
+	}
+	if n := len(c.partials); n != 0 {
+		t.Errorf("%d partial callbacks remain after the response", n)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	go func() {
+		for _, resp := range []*Message{
+			{Result: json.RawMessage(`[{"uri":"file:///a.go"}]`)},
+			{Error: &ResponseError{Code: CodeInvalidParams, Message: "bad position"}},
+		} {
+			msg, err := s.read()
+			if err != nil {
+				return
+			}
+			resp.ID = msg.ID
+			s.write(resp)
+		}
+	}()
+
+	locations, err := Request[[]Location](c, "textDocument/definition", &TextDocumentPositionParams{})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if len(locations) != 1 || locations[0].URI != "file:///a.go" {
+		t.Errorf("Request = %v; want a location of file:///a.go", locations)
+	}
+
+	_, err = Request[[]Location](c, "textDocument/definition", &TextDocumentPositionParams{})
+	var e *ResponseError
+	if !xerrors.As(err, &e) || e.Code != CodeInvalidParams {
+		t.Errorf("Request: error = %v; want *ResponseError with code %d", err, CodeInvalidParams)
+	}
+}
+
+func TestClientCloseLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 1000; i++ {
+		c, s := newPipeClient(t)
+		var reply interface{}
+		call := c.Call("test/method", nil, &reply)
+		if _, err := s.read(); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 0 {
+			// the server dies while the call is pending.
+			s.Close()
+			if err := c.Wait(call); err == nil {
+				t.Fatalf("Wait should fail after the server is closed")
+			}
+			if err := c.Wait(c.Call("test/method", nil, &reply)); err == nil {
+				t.Fatalf("Call should fail after the server is closed")
+			}
+			c.Close()
+		} else {
+			c.Close()
+			if err := c.Wait(call); !xerrors.Is(err, ErrClosed) {
+				t.Fatalf("Wait: %v; want %v", err, ErrClosed)
+			}
+			s.Close()
+		}
+		if err := c.Wait(c.Call("test/method", nil, &reply)); !xerrors.Is(err, ErrClosed) {
+			t.Fatalf("Call after Close: %v; want %v", err, ErrClosed)
+		}
+	}
+
+	// goroutines of net.Pipe may take a moment to exit.
+	var n int
+	for i := 0; i < 50; i++ {
+		n = runtime.NumGoroutine()
+		if n <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("NumGoroutine = %d; want <= %d", n, before)
+}
+
+func TestWaitAll(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	go func() {
+		var msgs []*Message
+		for i := 0; i < 3; i++ {
+			msg, err := s.read()
+			if err != nil {
+				return
+			}
+			msgs = append(msgs, msg)
+		}
+		// respond in reverse order.
+		for i := len(msgs) - 1; i >= 0; i-- {
+			resp := &Message{ID: msgs[i].ID, Result: json.RawMessage(`[{"uri":"file:///a.go"}]`)}
+			if msgs[i].Method == "textDocument/hover" {
+				resp.Result = nil
+				resp.Error = &ResponseError{Code: CodeInternalError, Message: "no hover"}
+			}
+			if err := s.write(resp); err != nil {
+				return
+			}
+		}
+	}()
+
+	c.cap.DefinitionProvider = true
+	c.cap.ReferencesProvider = true
+	var hover interface{}
+	r1 := c.GotoDefinition(&TextDocumentPositionParams{})
+	r2 := c.Call("textDocument/hover", &TextDocumentPositionParams{}, &hover)
+	r3 := c.References(&ReferenceParams{})
+	err := WaitAll(r1, r2, r3)
+	var e *ResponseError
+	if !xerrors.As(err, &e) || e.Message != "no hover" {
+		t.Errorf("WaitAll: %v; want the error of hover", err)
+	}
+	if len(r1.Locations) != 1 || len(r3.Locations) != 1 {
+		t.Errorf("Locations = %v, %v; want a location each", r1.Locations, r3.Locations)
+	}
+}
+
+func TestClientMinSeverity(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+	c.MinSeverity = DiagnosticSeverityWarning
+
+	err := s.write(&Message{
+		Method: "textDocument/publishDiagnostics",
+		Params: json.RawMessage(`{
+			"uri": "file:///tmp/a.go",
+			"diagnostics": [
+				{"range": {}, "severity": 1, "message": "error"},
+				{"range": {}, "severity": 2, "message": "warning"},
+				{"range": {}, "severity": 3, "message": "information"},
+				{"range": {}, "severity": 4, "message": "hint"},
+				{"range": {}, "message": "no severity"}
+			]
+		}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := <-c.Diagnostics
+	var a []string
+	for _, d := range params.Diagnostics {
+		a = append(a, d.Message)
+	}
+	want := []string{"error", "warning", "no severity"}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("Diagnostics = %q; want %q", a, want)
+	}
+}
+
+func TestClientDiagnosticsOverflow(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	const n = 30 // more than cap(c.Diagnostics)
+	publish := func(uri string, i int) {
+		t.Helper()
+		err := s.write(&Message{
+			Method: "textDocument/publishDiagnostics",
+			Params: json.RawMessage(fmt.Sprintf(`{"uri":%q,"diagnostics":[{"range":{},"message":"%d"}]}`, uri, i)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		publish("file:///tmp/a.go", i)
+	}
+	publish("file:///tmp/b.go", n)
+
+	latest := make(map[DocumentURI]string)
+	timeout := time.After(5 * time.Second)
+	for latest["file:///tmp/a.go"] != fmt.Sprint(n-1) || latest["file:///tmp/b.go"] != fmt.Sprint(n) {
+		select {
+		case params := <-c.Diagnostics:
+			latest[params.URI] = params.Diagnostics[0].Message
+		case <-timeout:
+			t.Fatalf("the latest diagnostics are dropped: %v", latest)
+		}
+	}
+}
+
+func TestClientUse(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	var log []string
+	c.Use(func(next CallFunc) CallFunc {
+		return func(method string, args, reply interface{}) *Call {
+			log = append(log, "outer "+method)
+			return next(method, args, reply)
+		}
+	})
+	c.Use(func(next CallFunc) CallFunc {
+		return func(method string, args, reply interface{}) *Call {
+			log = append(log, "inner "+method)
+			if method == "test/cached" {
+				*reply.(*string) = "cached"
+				return DoneCall(method, args, reply, nil)
+			}
+			return next(method, "changed", reply)
+		}
+	})
+
+	var reply string
+	if err := c.Wait(c.Call("test/cached", nil, &reply)); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if reply != "cached" {
+		t.Errorf("reply = %q; want %q", reply, "cached")
+	}
+
+	call := c.Call("test/method", "original", &reply)
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := string(msg.Params); p != `"changed"` {
+		t.Errorf("Params = %s; want %q", p, "changed")
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`"server"`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait(call); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	want := []string{"outer test/cached", "inner test/cached", "outer test/method", "inner test/method"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("log = %q; want %q", log, want)
+	}
+}
+
+func TestClientErr(t *testing.T) {
+	t.Run("shutdown", func(t *testing.T) {
+		c, s := newPipeClient(t)
+		defer c.Close()
+		r := c.Shutdown()
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`null`)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Wait(); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+		if err := c.Err(); err != nil {
+			t.Errorf("Err() = %v before the server exits; want nil", err)
+		}
+		s.Close()
+		<-c.Done()
+		if err := c.Err(); err != ErrServerExited {
+			t.Errorf("Err() = %v; want %v", err, ErrServerExited)
+		}
+	})
+	t.Run("crash", func(t *testing.T) {
+		c, s := newPipeClient(t)
+		defer c.Close()
+		s.Close()
+		<-c.Done()
+		if err := c.Err(); !xerrors.Is(err, ErrServerLost) {
+			t.Errorf("Err() = %v; want %v", err, ErrServerLost)
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		c, s := newPipeClient(t)
+		defer s.Close()
+		c.Close()
+		<-c.Done()
+		if err := c.Err(); err != ErrClosed {
+			t.Errorf("Err() = %v; want %v", err, ErrClosed)
+		}
+	})
+}
+
+func TestClientStrictDecoding(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+	var log bytes.Buffer
+	c.stderr = &log
+	c.StrictDecoding = true
+
+	go func() {
+		msg, err := s.read()
+		if err != nil {
+			return
+		}
+		s.write(&Message{ID: msg.ID, Result: json.RawMessage(`[{"uri":"file:///a.go","newField":1}]`)})
+	}()
+	c.cap.DefinitionProvider = true
+	r := c.GotoDefinition(&TextDocumentPositionParams{})
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if len(r.Locations) != 1 || r.Locations[0].URI != "file:///a.go" {
+		t.Errorf("Locations = %v; want a location of file:///a.go", r.Locations)
+	}
+	if s := log.String(); !strings.Contains(s, "newField") {
+		t.Errorf("log = %q; should report the unknown field", s)
+	}
+}
+
+func TestClientSetWireTap(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	var (
+		mu     sync.Mutex
+		frames []string
+	)
+	c.SetWireTap(func(b []byte, dir Direction) {
+		mu.Lock()
+		defer mu.Unlock()
+		frames = append(frames, dir.String()+" "+string(b))
+	})
+	go func() {
+		msg, err := s.read()
+		if err != nil {
+			return
+		}
+		s.write(&Message{ID: msg.ID, Result: json.RawMessage(`1`)})
+	}()
+	var reply int
+	if err := c.Wait(c.Call("test/method", nil, &reply)); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"out Content-Length: 47\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"method":"test/method"}`,
+		"in Content-Length: 35\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"result":1}`,
+	}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("frames = %q; want %q", frames, want)
+	}
+}
+
+func TestClientConcurrentCalls(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	// the server responds to batches of requests in reverse order.
+	reqs := make(chan *Message)
+	go func() {
+		defer close(reqs)
+		for {
+			msg, err := s.read()
+			if err != nil {
+				return
+			}
+			reqs <- msg
+		}
+	}()
+	go func() {
+		var pending []*Message
+		for {
+			var (
+				msg *Message
+				ok  bool
+			)
+			if len(pending) == 0 {
+				msg, ok = <-reqs
+			} else {
+				select {
+				case msg, ok = <-reqs:
+				default:
+					ok = true
+				}
+			}
+			if !ok {
+				return
+			}
+			if msg != nil && len(pending) < 64 {
+				pending = append(pending, msg)
+				continue
+			}
+			if msg != nil {
+				pending = append(pending, msg)
+			}
+			for i := len(pending) - 1; i >= 0; i-- {
+				p := pending[i]
+				if err := s.write(&Message{ID: p.ID, Result: p.Params}); err != nil {
+					return
+				}
+			}
+			pending = pending[:0]
+		}
+	}()
+
+	const (
+		workers = 50
+		calls   = 10000
+	)
+	var wg sync.WaitGroup
+	errc := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < calls; i += workers * 4 {
+				var a []*Call
+				var replies [4]int
+				for j := 0; j < 4 && i+j*workers < calls; j++ {
+					a = append(a, c.Call("test/echo", i+j*workers, &replies[j]))
+				}
+				for j, call := range a {
+					if err := call.Wait(); err != nil {
+						errc <- err
+						return
+					}
+					if n := i + j*workers; replies[j] != n {
+						errc <- fmt.Errorf("reply = %d; want %d", replies[j], n)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+}
+
+func TestClientIDGenerator(t *testing.T) {
+	var ids = []int{100, 200, 200}
+	c, s := newPipeClient(t, IDGenerator(func() int {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}))
+	defer c.Close()
+	defer s.Close()
+
+	call1 := c.Call("test/echo", 1, new(int))
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 100 {
+		t.Errorf("ID = %d; want 100", msg.ID)
+	}
+	call2 := c.Call("test/echo", 2, new(int))
+	msg2, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg2.ID != 200 {
+		t.Errorf("ID = %d; want 200", msg2.ID)
+	}
+
+	// 200 is still outstanding.
+	call3 := c.Call("test/echo", 3, new(int))
+	if err := call3.Wait(); err == nil {
+		t.Errorf("Wait with duplicated id: succeeded")
+	}
+
+	for _, m := range []*Message{msg2, msg} {
+		if err := s.write(&Message{ID: m.ID, Result: m.Params}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WaitAll(call1, call2); err != nil {
+		t.Fatal(err)
+	}
+	if n := *call1.Reply.(*int); n != 1 {
+		t.Errorf("reply = %d; want 1", n)
+	}
+	if n := *call2.Reply.(*int); n != 2 {
+		t.Errorf("reply = %d; want 2", n)
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	go func() {
+		msg, err := s.read()
+		if err != nil {
+			return
+		}
+		s.write(&Message{
+			ID:    msg.ID,
+			Error: &ResponseError{Code: CodeInvalidParams, Message: "bad params"},
+		})
+	}()
+	err := c.Do(context.Background(), "test/fail", nil, new(int))
+	if err == nil {
+		t.Fatal("Do: succeeded")
+	}
+	if want := "test/fail (#1): "; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Do: error = %q; want prefix %q", err, want)
+	}
+	var e *ResponseError
+	if !xerrors.As(err, &e) || e.Code != CodeInvalidParams {
+		t.Errorf("Do: error = %v; want *ResponseError", err)
+	}
+}
+
+func TestClientDoCancel(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Do(ctx, "test/slow", nil, new(int))
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := <-errc; !xerrors.Is(err, context.Canceled) {
+		t.Errorf("Do: error = %v; want context.Canceled", err)
+	}
+	m, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Method != "$/cancelRequest" {
+		t.Fatalf("method = %q; want $/cancelRequest", m.Method)
+	}
+	var params CancelParams
+	if err := json.Unmarshal(m.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.ID != msg.ID {
+		t.Errorf("cancel id = %d; want %d", params.ID, msg.ID)
+	}
+}
+
+func TestClientDoCancelLateResponse(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var reply json.RawMessage
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Do(ctx, "test/slow", nil, &reply)
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	m, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Method != "$/cancelRequest" {
+		t.Fatalf("method = %q; want $/cancelRequest", m.Method)
+	}
+	if err := <-errc; !xerrors.Is(err, context.Canceled) {
+		t.Errorf("Do: error = %v; want context.Canceled", err)
+	}
+
+	// the late response must be discarded while the caller reads reply.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`{"x":1}`)}); err != nil {
+			t.Error(err)
+		}
+	}()
+	if reply != nil {
+		t.Errorf("reply = %s; want nil", reply)
+	}
+	<-done
+	sync := c.Call("test/sync", nil, new(json.RawMessage))
+	msg2, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: msg2.ID, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sync.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if reply != nil {
+		t.Errorf("reply = %s; want nil", reply)
+	}
+}
+
+func TestClientEventClose(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer s.Close()
+
+	for i := 1; i <= 3; i++ {
+		err := s.write(&Message{Method: "test/event", Params: json.RawMessage(fmt.Sprintf(`%d`, i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// wait for run to deliver all events.
+	if err := s.write(&Message{ID: 1, Method: "test/sync"}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 1 || resp.Error == nil || resp.Error.Code != CodeMethodNotFound {
+		t.Errorf("response to unknown request = %+v; want MethodNotFound error", resp)
+	}
+	if a := c.DrainEvents(); len(a) != 3 || string(a[0].Params) != "1" {
+		t.Errorf("DrainEvents() = %v; want 3 events", a)
+	}
+	if a := c.DrainEvents(); len(a) != 0 {
+		t.Errorf("DrainEvents() after drained = %v; want empty", a)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for range c.Event {
+		}
+		close(done)
+	}()
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ranging over Event doesn't terminate after Close")
+	}
+	if a := c.DrainEvents(); len(a) != 0 {
+		t.Errorf("DrainEvents() after Close = %v; want empty", a)
+	}
+}
+
+func TestClientOutOfOrderResponses(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	const n = 5
+	calls := make([]*Call, n)
+	replies := make([]string, n)
+	msgs := make(map[int]*Message)
+	for i := range calls {
+		calls[i] = c.Call("test/echo", fmt.Sprintf("request %d", i), &replies[i])
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[msg.ID] = msg
+	}
+	if len(msgs) != n {
+		t.Fatalf("got %d distinct ids; want %d", len(msgs), n)
+	}
+	order := []int{calls[4].msg.ID, calls[2].msg.ID, calls[0].msg.ID, calls[3].msg.ID, calls[1].msg.ID}
+	for _, id := range order {
+		msg := msgs[id]
+		if err := s.write(&Message{ID: id, Result: msg.Params}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, call := range calls {
+		if err := call.Wait(); err != nil {
+			t.Fatalf("Wait #%d: %v", i, err)
+		}
+		if want := fmt.Sprintf("request %d", i); replies[i] != want {
+			t.Errorf("reply #%d = %q; want %q", i, replies[i], want)
+		}
+	}
+}
+
+func TestClientMethodNotFound(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	if err := s.write(&Message{ID: 7, Method: "client/unknownRequest", Params: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 7 || resp.Error == nil || resp.Error.Code != CodeMethodNotFound {
+		t.Errorf("response = %+v; want MethodNotFound error", resp)
+	}
+	if len(c.Event) != 0 {
+		t.Errorf("unknown request is delivered to Event")
+	}
+}
+
+func TestWriteQueuePriority(t *testing.T) {
+	calls := []*Call{
+		{Method: "textDocument/didOpen", uri: "file:///b.go"},
+		{Method: "textDocument/didOpen", uri: "file:///a.go"},
+		{Method: "workspace/symbol"},
+		{Method: "textDocument/hover", uri: "file:///a.go", high: true},
+		{Method: "textDocument/completion", uri: "file:///b.go", high: true},
+		{Method: "textDocument/didOpen", uri: "file:///c.go"},
+	}
+	q := writeQueue{ready: make(chan struct{}, 1)}
+	for _, call := range calls {
+		q.push(call)
+	}
+	want := []*Call{calls[1], calls[3], calls[0], calls[4], calls[2], calls[5]}
+	for i, w := range want {
+		if call := q.pop(); call != w {
+			t.Errorf("pop[%d] = %s %s; want %s %s", i, call.Method, call.uri, w.Method, w.uri)
+		}
+	}
+	if call := q.pop(); call != nil {
+		t.Errorf("pop = %v; want nil", call)
+	}
+}
+
+func TestClientHighPriority(t *testing.T) {
+	c, s := newPipeClient(t, HighPriority("textDocument/hover"))
+	defer c.Close()
+	defer s.Close()
+
+	var reply json.RawMessage
+	call := c.Call("textDocument/hover", &TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///a.go"},
+	}, &reply)
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "textDocument/hover" {
+		t.Fatalf("method = %q; want textDocument/hover", msg.Method)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := call.Wait(); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	c, s := newPipeClient(t, Headers(map[string]string{
+		"Proxy-Authorization": "Bearer xxx",
+		"X-Session":           "1",
+	}))
+	defer c.Close()
+	defer s.Close()
+
+	headerc := make(chan string, 1)
+	c.SetWireTap(func(b []byte, dir Direction) {
+		if dir == Outgoing {
+			i := bytes.Index(b, []byte("\r\n\r\n"))
+			headerc <- string(b[:i+4])
+		}
+	})
+	call := c.Call("test/notify", nil, nil)
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := call.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := "\r\nProxy-Authorization: Bearer xxx\r\nX-Session: 1\r\n\r\n"
+	if h := <-headerc; !strings.HasPrefix(h, "Content-Length: ") || !strings.HasSuffix(h, want) {
+		t.Errorf("header = %q; want Content-Length followed by %q", h, want)
+	}
+}
+
+func TestClientExit(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	bodyc := make(chan string, 1)
+	c.SetWireTap(func(b []byte, dir Direction) {
+		if dir == Outgoing {
+			i := bytes.Index(b, []byte("\r\n\r\n"))
+			bodyc <- string(b[i+4:])
+		}
+	})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Exit()
+	}()
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Exit: %v", err)
+	}
+	if body, want := <-bodyc, `{"jsonrpc":"2.0","method":"exit"}`; body != want {
+		t.Errorf("exit = %s; want %s", body, want)
+	}
+}
+
+func TestClientNotificationNotCached(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	call := c.Call("test/notify", &struct{}{}, nil)
+	select {
+	case <-call.done:
+		t.Fatalf("notification is done before it is written: %v", call.Error)
+	default:
+	}
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 0 {
+		t.Errorf("notification has id %d", msg.ID)
+	}
+	// the server never responds to notifications.
+	if err := call.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// the run loop has recorded the size of the cache when it receives the next call.
+	next := c.Call("test/notify", &struct{}{}, nil)
+	if n := atomic.LoadInt32(&c.pending); n != 0 {
+		t.Errorf("pending requests = %d; want 0", n)
+	}
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	c.mu.Lock()
+	lastID, freeIDs := c.lastID, c.freeIDs
+	c.mu.Unlock()
+	if len(freeIDs) != 0 || lastID != 0 {
+		t.Errorf("notifications allocate ids: lastID = %d, freeIDs = %v", lastID, freeIDs)
+	}
+}
+
+func TestClientMaxQueuedWrites(t *testing.T) {
+	c, s := newPipeClient(t, MaxQueuedWrites(1))
+	defer c.Close()
+	defer s.Close()
+
+	var reply interface{}
+	call1 := c.Call("test/method", nil, &reply)
+	// wait for the writer to take call1; it blocks until the server reads.
+	for c.QueuedWrites() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	call2 := c.Call("test/method", nil, &reply)
+	call3 := c.Call("test/method", nil, &reply)
+	notify := c.Call("test/notify", nil, nil)
+	if err := call3.Wait(); !xerrors.Is(err, ErrQueueFull) {
+		t.Errorf("Wait = %v; want %v", err, ErrQueueFull)
+	}
+	for _, want := range []string{"test/method", "test/method", "test/notify"} {
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != want {
+			t.Errorf("method = %q; want %q", msg.Method, want)
+		}
+		if msg.ID != 0 {
+			if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`1`)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := WaitAll(call1, call2, notify); err != nil {
+		t.Errorf("WaitAll: %v", err)
+	}
+	if n := c.QueuedWrites(); n != 0 {
+		t.Errorf("QueuedWrites = %d; want 0", n)
+	}
+}
+
+func TestClientDropNotificationsDefault(t *testing.T) {
+	tests := []struct {
+		opts []Option
+		want []string
+	}{
+		{nil, []string{"test/b", "test/c"}},
+		{[]Option{DropNotifications("test/b"), DropNotifications("test/c")}, nil},
+		{[]Option{AcceptNotifications("$/cancelRequest", "test/c")}, []string{"$/cancelRequest", "test/c"}},
+	}
+	for _, tt := range tests {
+		c, s := newPipeClient(t, tt.opts...)
+		for _, method := range []string{"$/cancelRequest", "test/b", "test/c"} {
+			if err := s.write(&Message{Method: method, Params: json.RawMessage(`{"id":1}`)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the response to a server request orders after the notifications.
+		if err := s.write(&Message{ID: 1, Method: "test/sync"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.read(); err != nil {
+			t.Fatal(err)
+		}
+		var methods []string
+		for _, msg := range c.DrainEvents() {
+			methods = append(methods, msg.Method)
+		}
+		if !reflect.DeepEqual(methods, tt.want) {
+			t.Errorf("events = %q; want %q", methods, tt.want)
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestClientReferencesPartialBlockingCallback(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	c.cap.ReferencesProvider = true
+	var nested error
+	params := &ReferenceParams{PartialResultParams: PartialResultParams{PartialResultToken: "mine"}}
+	r := c.ReferencesPartial(params, func(locations []Location) {
+		// waiting for another response must not block receiving it.
+		nested = c.Call("workspace/symbol", map[string]string{"query": "x"}, new(json.RawMessage)).Wait()
+	})
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p ReferenceParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.PartialResultToken != "mine" {
+		t.Errorf("partialResultToken = %q; want the token of the caller", p.PartialResultToken)
+	}
+	err = s.write(&Message{
+		Method: "$/progress",
+		Params: json.RawMessage(`{"token":"mine","value":[{"uri":"file:///a.go"}]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sym.Method != "workspace/symbol" {
+		t.Fatalf("method = %q; want workspace/symbol", sym.Method)
+	}
+	// the final response arrives while the callback is still waiting.
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`[{"uri":"file:///b.go"}]`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: sym.ID, Result: json.RawMessage(`[]`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if nested != nil {
+		t.Errorf("nested call: %v", nested)
+	}
+	if n := len(r.Locations); n != 2 {
+		t.Errorf("len(Locations) = %d; want 2", n)
+	}
+}
+
+func TestClientReportWorkDone(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		progress []WorkDoneProgress
+		calls    []*Call
+		received = make(chan struct{}, 2)
+	)
+	c, s := newPipeClient(t, ReportWorkDone(func(call *Call, p *WorkDoneProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, *p)
+		calls = append(calls, call)
+		received <- struct{}{}
+	}))
+	defer c.Close()
+	defer s.Close()
+
+	var reply json.RawMessage
+	call := c.Call("workspace/symbol", map[string]string{"query": "x"}, &reply)
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params struct {
+		Query         string
+		WorkDoneToken ProgressToken
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.WorkDoneToken == "" || params.Query != "x" {
+		t.Fatalf("params = %s; want a workDoneToken with the query", msg.Params)
+	}
+	token, err := json.Marshal(params.WorkDoneToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{
+		`{"kind":"begin","title":"indexing","percentage":0}`,
+		`{"kind":"end"}`,
+	} {
+		err := s.write(&Message{
+			Method: "$/progress",
+			Params: json.RawMessage(`{"token":` + string(token) + `,"value":` + value + `}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`[]`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := call.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	// progress is reported on another goroutine.
+	for i := 0; i < 2; i++ {
+		<-received
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) != 2 {
+		t.Fatalf("received %d progress; want 2", len(progress))
+	}
+	if p := progress[0]; p.Kind != WorkDoneProgressBegin || p.Title != "indexing" || p.Percentage == nil {
+		t.Errorf("progress[0] = %+v; want begin of indexing", p)
+	}
+	if p := progress[1]; p.Kind != WorkDoneProgressEnd {
+		t.Errorf("progress[1] = %+v; want end", p)
+	}
+	for _, x := range calls {
+		if x != call {
+			t.Errorf("progress is reported for %v; want %v", x, call)
+		}
+	}
+	if n := len(c.partials); n != 0 {
+		t.Errorf("%d progress callbacks remain after the response", n)
+	}
+}
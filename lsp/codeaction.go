@@ -0,0 +1,339 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// CodeActionKind values.
+const (
+	CodeActionKindEmpty                 = ""
+	CodeActionKindQuickFix              = "quickfix"
+	CodeActionKindRefactor              = "refactor"
+	CodeActionKindRefactorExtract       = "refactor.extract"
+	CodeActionKindRefactorInline        = "refactor.inline"
+	CodeActionKindRefactorRewrite       = "refactor.rewrite"
+	CodeActionKindSource                = "source"
+	CodeActionKindSourceOrganizeImports = "source.organizeImports"
+	CodeActionKindSourceFixAll          = "source.fixAll"
+)
+
+// CodeActionOptions represents the interface described in the specification.
+type CodeActionOptions struct {
+	Provider        Provider `json:"-"`
+	CodeActionKinds []string `json:"codeActionKinds,omitempty"`
+	ResolveProvider bool     `json:"resolveProvider,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (o *CodeActionOptions) UnmarshalJSON(b []byte) error {
+	type options CodeActionOptions
+	return unmarshalProvider(b, &o.Provider, (*options)(o))
+}
+
+// CodeActionKinds returns kinds of code actions the server advertises.
+// It returns nil if the server doesn't list them, even if it provides code actions.
+func (c *Client) CodeActionKinds() []string {
+	return copyStrings(c.cap.CodeActionProvider.CodeActionKinds)
+}
+
+// CodeActionContext represents the interface described in the specification.
+type CodeActionContext struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+
+	// Only requests code actions of these kinds.
+	// A kind also matches its sub-kinds, e.g. "source" matches "source.organizeImports".
+	Only []string `json:"only,omitempty"`
+}
+
+// CodeActionParams represents the interface described in the specification.
+type CodeActionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+	Context      CodeActionContext      `json:"context"`
+}
+
+// CodeAction represents the interface described in the specification.
+type CodeAction struct {
+	Title       string         `json:"title"`
+	Kind        string         `json:"kind,omitempty"`
+	Diagnostics []Diagnostic   `json:"diagnostics,omitempty"`
+	IsPreferred bool           `json:"isPreferred,omitempty"`
+	Edit        *WorkspaceEdit `json:"edit,omitempty"`
+	Command     *Command       `json:"command,omitempty"`
+
+	// Data is preserved between a code action request and a resolve request.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// The specification allows a bare Command in place of CodeAction;
+// it is decoded into a CodeAction that only has Title and Command.
+func (a *CodeAction) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Command json.RawMessage `json:"command"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var name string
+	if json.Unmarshal(v.Command, &name) == nil {
+		var cmd Command
+		if err := json.Unmarshal(b, &cmd); err != nil {
+			return err
+		}
+		*a = CodeAction{Title: cmd.Title, Command: &cmd}
+		return nil
+	}
+	type action CodeAction
+	return json.Unmarshal(b, (*action)(a))
+}
+
+// CodeActionsResult represents a result object for code action request.
+type CodeActionsResult struct {
+	Actions []CodeAction
+
+	c    *Client
+	call *Call
+}
+
+// CodeAction sends the code action request to the server.
+func (c *Client) CodeAction(params *CodeActionParams) *CodeActionsResult {
+	const method = "textDocument/codeAction"
+	var result CodeActionsResult
+	result.c = c
+	if !c.cap.CodeActionProvider.Provider {
+		result.call = c.unsupported(method, params, &result.Actions)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Actions)
+	return &result
+}
+
+// Wait waits for a response of code action request.
+func (r *CodeActionsResult) Wait() error {
+	return r.c.Wait(r.call)
+}
+
+// ResolveCodeAction sends the code action resolve request to the server,
+// and returns action that its properties such as Edit are filled.
+// If the server doesn't advertise resolveProvider, ResolveCodeAction returns action as is.
+func (c *Client) ResolveCodeAction(action *CodeAction) (*CodeAction, error) {
+	const method = "codeAction/resolve"
+	if !c.cap.CodeActionProvider.ResolveProvider {
+		return action, nil
+	}
+	var resolved CodeAction
+	if err := c.Wait(c.Call(method, action, &resolved)); err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// OrganizeImports requests the organize imports code action for the whole document of uri,
+// then returns the edits to apply to the document.
+// If the server returns a code action without edits, OrganizeImports resolves it.
+// If the server returns a command instead of edits, OrganizeImports executes it
+// and collects the edits to uri that the server requests with workspace/applyEdit.
+// Edits to other documents are passed to the handler of workspace/applyEdit.
+// The edits to uri aren't applied by OrganizeImports.
+//
+// The range of the document is computed from the text returned by Content if it exists.
+func (c *Client) OrganizeImports(uri DocumentURI) ([]TextEdit, error) {
+	var r Range
+	if text, err := c.Content(uri); err == nil {
+		r.End = AcmeOffsetToPosition(text, utf8.RuneCountInString(text))
+	}
+	result := c.CodeAction(&CodeActionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Range:        r,
+		Context: CodeActionContext{
+			Diagnostics: []Diagnostic{},
+			Only:        []string{CodeActionKindSourceOrganizeImports},
+		},
+	})
+	if err := result.Wait(); err != nil {
+		return nil, err
+	}
+	var edits []TextEdit
+	for _, action := range result.Actions {
+		// a bare command doesn't have its kind.
+		if action.Kind != "" && !matchCodeActionKind(action.Kind, CodeActionKindSourceOrganizeImports) {
+			continue
+		}
+		if action.Edit == nil && action.Command == nil {
+			a, err := c.ResolveCodeAction(&action)
+			if err != nil {
+				return nil, err
+			}
+			action = *a
+		}
+		if action.Edit != nil {
+			edits = append(edits, action.Edit.TextEdits(uri)...)
+		}
+		if action.Command != nil {
+			a, err := c.executeCommandEdits(action.Command, uri)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, a...)
+		}
+	}
+	return edits, nil
+}
+
+// matchCodeActionKind reports whether kind is base or its sub-kind.
+func matchCodeActionKind(kind, base string) bool {
+	return kind == base || strings.HasPrefix(kind, base+".")
+}
+
+// editCollector holds edits to a document that the server requests
+// with workspace/applyEdit while executeCommandEdits runs a command.
+type editCollector struct {
+	mu    sync.Mutex
+	edits []TextEdit
+	done  chan struct{} // closed when the command is finished
+}
+
+func (r *editCollector) add(edits []TextEdit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.edits = append(r.edits, edits...)
+}
+
+// executeCommandEdits executes cmd, then returns edits to uri in workspace/applyEdit
+// requests sent by the server during the execution.
+// Edits to other documents are passed to the handler of workspace/applyEdit.
+// Commands for the same uri are executed one by one,
+// because it can't be told which command the server applies edits for.
+func (c *Client) executeCommandEdits(cmd *Command, uri DocumentURI) ([]TextEdit, error) {
+	r := c.registerCollector(uri)
+	defer c.unregisterCollector(uri, r)
+
+	err := c.ExecuteCommand(&ExecuteCommandParams{
+		Command:   cmd.Command,
+		Arguments: cmd.Arguments,
+	}).Wait()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.edits, nil
+}
+
+// registerCollector registers a new collector of edits to uri.
+// It waits for the collector that is registered for uri already.
+func (c *Client) registerCollector(uri DocumentURI) *editCollector {
+	r := &editCollector{done: make(chan struct{})}
+	for {
+		c.mu.Lock()
+		p, ok := c.collectors[uri]
+		if !ok {
+			if c.collectors == nil {
+				c.collectors = make(map[DocumentURI]*editCollector)
+			}
+			c.collectors[uri] = r
+			c.mu.Unlock()
+			return r
+		}
+		c.mu.Unlock()
+		<-p.done
+	}
+}
+
+func (c *Client) unregisterCollector(uri DocumentURI, r *editCollector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.collectors, uri)
+	close(r.done)
+}
+
+// collectEdits returns the handler of workspace/applyEdit that takes edits
+// to the documents of running executeCommandEdits, and passes the rest of the edit to h.
+// The taken edits are reported as applied only if h applies the rest.
+func (c *Client) collectEdits(h Handler) Handler {
+	return func(params json.RawMessage) (interface{}, error) {
+		var p ApplyWorkspaceEditParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return h(params)
+		}
+		taken, err := c.takeEdits(&p.Edit)
+		if err != nil {
+			return &ApplyWorkspaceEditResult{FailureReason: err.Error()}, nil
+		}
+		if len(taken) == 0 {
+			return h(params)
+		}
+		if len(p.Edit.Changes) > 0 || len(p.Edit.DocumentChanges) > 0 {
+			b, err := json.Marshal(&p)
+			if err != nil {
+				return nil, err
+			}
+			result, err := h(b)
+			if err != nil || !isApplied(result) {
+				return result, err
+			}
+		}
+		for r, edits := range taken {
+			r.add(edits)
+		}
+		return &ApplyWorkspaceEditResult{Applied: true}, nil
+	}
+}
+
+// takeEdits removes text edits to the documents of running executeCommandEdits from edit,
+// and returns them. It fails if the versions of the documents are mismatched.
+func (c *Client) takeEdits(edit *WorkspaceEdit) (map[*editCollector][]TextEdit, error) {
+	c.mu.Lock()
+	collectors := make(map[DocumentURI]*editCollector, len(c.collectors))
+	for uri, r := range c.collectors {
+		collectors[uri] = r
+	}
+	c.mu.Unlock()
+	if len(collectors) == 0 {
+		return nil, nil
+	}
+
+	taken := make(map[*editCollector][]TextEdit)
+	for uri, edits := range edit.Changes {
+		if r, ok := collectors[uri]; ok {
+			taken[r] = append(taken[r], edits...)
+			delete(edit.Changes, uri)
+		}
+	}
+	var changes []DocumentChange
+	for _, d := range edit.DocumentChanges {
+		e := d.TextDocumentEdit
+		if e == nil {
+			changes = append(changes, d)
+			continue
+		}
+		r, ok := collectors[e.TextDocument.URI]
+		if !ok {
+			changes = append(changes, d)
+			continue
+		}
+		if err := c.checkVersion(e.TextDocument.URI, e.TextDocument.Version); err != nil {
+			return nil, err
+		}
+		taken[r] = append(taken[r], e.Edits...)
+	}
+	edit.DocumentChanges = changes
+	return taken, nil
+}
+
+// isApplied reports whether result of a workspace/applyEdit handler reports success.
+func isApplied(result interface{}) bool {
+	if r, ok := result.(*ApplyWorkspaceEditResult); ok {
+		return r != nil && r.Applied
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return false
+	}
+	var r ApplyWorkspaceEditResult
+	return json.Unmarshal(b, &r) == nil && r.Applied
+}
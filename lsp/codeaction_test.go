@@ -0,0 +1,422 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestCodeActionOptions(t *testing.T) {
+	tests := []struct {
+		s    string
+		want CodeActionOptions
+	}{
+		{`true`, CodeActionOptions{Provider: true}},
+		{`false`, CodeActionOptions{}},
+		{
+			`{"codeActionKinds":["quickfix","source.organizeImports"],"resolveProvider":true}`,
+			CodeActionOptions{
+				Provider:        true,
+				CodeActionKinds: []string{"quickfix", "source.organizeImports"},
+				ResolveProvider: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		var o CodeActionOptions
+		if err := json.Unmarshal([]byte(tt.s), &o); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(o, tt.want) {
+			t.Errorf("Unmarshal(%s) = %+v; want %+v", tt.s, o, tt.want)
+		}
+	}
+}
+
+func TestCodeActionUnmarshal(t *testing.T) {
+	s := `[
+		{"title":"Organize Imports","kind":"source.organizeImports","edit":{"changes":{}}},
+		{"title":"Run test","command":"gopls.test","arguments":[1]}
+	]`
+	var a []CodeAction
+	if err := json.Unmarshal([]byte(s), &a); err != nil {
+		t.Fatal(err)
+	}
+	want := []CodeAction{
+		{
+			Title: "Organize Imports",
+			Kind:  CodeActionKindSourceOrganizeImports,
+			Edit:  &WorkspaceEdit{Changes: map[DocumentURI][]TextEdit{}},
+		},
+		{
+			Title: "Run test",
+			Command: &Command{
+				Title:     "Run test",
+				Command:   "gopls.test",
+				Arguments: []json.RawMessage{json.RawMessage(`1`)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("Unmarshal = %+v; want %+v", a, want)
+	}
+}
+
+func TestClientCodeActionOnly(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	c.cap.CodeActionProvider = CodeActionOptions{
+		Provider:        true,
+		CodeActionKinds: []string{CodeActionKindSourceOrganizeImports},
+	}
+	if kinds := c.CodeActionKinds(); !reflect.DeepEqual(kinds, []string{CodeActionKindSourceOrganizeImports}) {
+		t.Errorf("CodeActionKinds() = %v", kinds)
+	}
+	r := c.CodeAction(&CodeActionParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///a.go"},
+		Context: CodeActionContext{
+			Diagnostics: []Diagnostic{},
+			Only:        []string{CodeActionKindSourceOrganizeImports},
+		},
+	})
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params CodeActionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(params.Context.Only, []string{CodeActionKindSourceOrganizeImports}) {
+		t.Errorf("context.only = %v", params.Context.Only)
+	}
+	resp := `[{"title":"Organize Imports","kind":"source.organizeImports"}]`
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(resp)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Actions) != 1 || r.Actions[0].Kind != CodeActionKindSourceOrganizeImports {
+		t.Errorf("Actions = %+v", r.Actions)
+	}
+}
+
+func TestClientCodeActionUnsupported(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	if err := c.CodeAction(&CodeActionParams{}).Wait(); !xerrors.Is(err, ErrUnsupported) {
+		t.Errorf("CodeAction without the capability = %v; want ErrUnsupported", err)
+	}
+}
+
+func TestClientOrganizeImports(t *testing.T) {
+	const uri = "file:///nonexistent/a.go"
+	edit := `{"range":{"start":{"line":2,"character":0},"end":{"line":3,"character":0}},"newText":""}`
+	want := []TextEdit{{
+		Range: Range{Start: Position{Line: 2}, End: Position{Line: 3}},
+	}}
+	tests := []struct {
+		name    string
+		actions string
+		applied bool // server sends workspace/applyEdit
+	}{
+		{
+			name:    "edit",
+			actions: `[{"title":"Organize Imports","kind":"source.organizeImports","edit":{"changes":{"` + uri + `":[` + edit + `]}}}]`,
+		},
+		{
+			name:    "command",
+			actions: `[{"title":"Organize Imports","command":"organizeImports","arguments":["` + uri + `"]}]`,
+			applied: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, s := newPipeClient(t)
+			defer c.Close()
+			defer s.Close()
+			c.cap.CodeActionProvider.Provider = true
+			c.cap.ExecuteCommandProvider.Commands = []string{"organizeImports"}
+
+			type result struct {
+				edits []TextEdit
+				err   error
+			}
+			resc := make(chan result, 1)
+			go func() {
+				edits, err := c.OrganizeImports(uri)
+				resc <- result{edits, err}
+			}()
+			msg, err := s.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(tt.actions)}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.applied {
+				msg, err := s.read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Method != "workspace/executeCommand" {
+					t.Fatalf("method = %q; want workspace/executeCommand", msg.Method)
+				}
+				apply := `{"edit":{"documentChanges":[{"textDocument":{"uri":"` + uri + `","version":null},"edits":[` + edit + `]}]}}`
+				if err := s.write(&Message{ID: 1000, Method: "workspace/applyEdit", Params: json.RawMessage(apply)}); err != nil {
+					t.Fatal(err)
+				}
+				resp, err := s.read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.ID != 1000 || string(resp.Result) != `{"applied":true}` {
+					t.Errorf("applyEdit response = %+v", resp)
+				}
+				if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`null`)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := <-resc
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if !reflect.DeepEqual(r.edits, want) {
+				t.Errorf("OrganizeImports = %+v; want %+v", r.edits, want)
+			}
+			h := c.handler("workspace/applyEdit")
+			if reflect.ValueOf(h).Pointer() != reflect.ValueOf(c.applyEdit).Pointer() {
+				t.Errorf("applyEdit handler is not restored")
+			}
+		})
+	}
+}
+
+func TestClientOrganizeImportsConcurrent(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+	c.cap.CodeActionProvider.Provider = true
+	c.cap.ExecuteCommandProvider.Commands = []string{"organizeImports"}
+	others := make(chan json.RawMessage, 1)
+	c.Handle("workspace/applyEdit", func(params json.RawMessage) (interface{}, error) {
+		others <- params
+		return &ApplyWorkspaceEditResult{Applied: true}, nil
+	})
+
+	uris := []DocumentURI{"file:///nonexistent/a.go", "file:///nonexistent/b.go"}
+	edit := func(line int) TextEdit {
+		return TextEdit{Range: Range{Start: Position{Line: line}, End: Position{Line: line + 1}}}
+	}
+	type result struct {
+		edits []TextEdit
+		err   error
+	}
+	resc := make([]chan result, len(uris))
+	for i, uri := range uris {
+		resc[i] = make(chan result, 1)
+		go func(uri DocumentURI, c1 chan<- result) {
+			edits, err := c.OrganizeImports(uri)
+			c1 <- result{edits, err}
+		}(uri, resc[i])
+	}
+	for range uris {
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var params CodeActionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		actions := `[{"title":"Organize Imports","command":"organizeImports","arguments":["` + string(params.TextDocument.URI) + `"]}]`
+		if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(actions)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var commands []int
+	for range uris {
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != "workspace/executeCommand" {
+			t.Fatalf("method = %q; want workspace/executeCommand", msg.Method)
+		}
+		commands = append(commands, msg.ID)
+	}
+
+	// a single applyEdit request changes both documents and another one.
+	const other = "file:///nonexistent/c.go"
+	p := ApplyWorkspaceEditParams{
+		Edit: WorkspaceEdit{
+			Changes: map[DocumentURI][]TextEdit{
+				uris[0]: {edit(0)},
+				other:   {edit(2)},
+			},
+			DocumentChanges: []DocumentChange{
+				{TextDocumentEdit: &TextDocumentEdit{
+					TextDocument: OptionalVersionedTextDocumentIdentifier{
+						TextDocumentIdentifier: TextDocumentIdentifier{URI: uris[1]},
+					},
+					Edits: []TextEdit{edit(1)},
+				}},
+			},
+		},
+	}
+	b, err := json.Marshal(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: 1000, Method: "workspace/applyEdit", Params: b}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 1000 || string(resp.Result) != `{"applied":true}` {
+		t.Errorf("applyEdit response = %+v", resp)
+	}
+	var rest ApplyWorkspaceEditParams
+	if err := json.Unmarshal(<-others, &rest); err != nil {
+		t.Fatal(err)
+	}
+	want := WorkspaceEdit{Changes: map[DocumentURI][]TextEdit{other: {edit(2)}}}
+	if !reflect.DeepEqual(rest.Edit, want) {
+		t.Errorf("edit passed to the handler = %+v; want %+v", rest.Edit, want)
+	}
+	for _, id := range commands {
+		if err := s.write(&Message{ID: id, Result: json.RawMessage(`null`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range uris {
+		r := <-resc[i]
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if want := []TextEdit{edit(i)}; !reflect.DeepEqual(r.edits, want) {
+			t.Errorf("OrganizeImports(%s) = %+v; want %+v", uris[i], r.edits, want)
+		}
+	}
+}
+
+func TestClientOrganizeImportsRejected(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+	c.cap.CodeActionProvider.Provider = true
+	c.cap.ExecuteCommandProvider.Commands = []string{"organizeImports"}
+	c.Handle("workspace/applyEdit", func(params json.RawMessage) (interface{}, error) {
+		return &ApplyWorkspaceEditResult{FailureReason: "rejected"}, nil
+	})
+
+	const uri = "file:///nonexistent/a.go"
+	type result struct {
+		edits []TextEdit
+		err   error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		edits, err := c.OrganizeImports(uri)
+		resc <- result{edits, err}
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := `[{"title":"Organize Imports","command":"organizeImports","arguments":["` + uri + `"]}]`
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(actions)}); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit := `{"range":{"start":{"line":0,"character":0},"end":{"line":1,"character":0}},"newText":""}`
+	apply := `{"edit":{"changes":{"` + uri + `":[` + edit + `],"file:///nonexistent/b.go":[` + edit + `]}}}`
+	if err := s.write(&Message{ID: 1000, Method: "workspace/applyEdit", Params: json.RawMessage(apply)}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Result) != `{"applied":false,"failureReason":"rejected"}` {
+		t.Errorf("applyEdit response = %s; want the failure of the handler", resp.Result)
+	}
+	if err := s.write(&Message{ID: cmd.ID, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+	r := <-resc
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if len(r.edits) != 0 {
+		t.Errorf("OrganizeImports = %+v; want no edits that the server failed to apply", r.edits)
+	}
+}
+
+func TestClientResolveCodeAction(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	action := &CodeAction{
+		Title: "Fill struct",
+		Kind:  CodeActionKindRefactorRewrite,
+		Data:  json.RawMessage(`{"id":3}`),
+	}
+	a, err := c.ResolveCodeAction(action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != action {
+		t.Errorf("ResolveCodeAction without resolveProvider = %+v; want the action as is", a)
+	}
+
+	c.cap.CodeActionProvider = CodeActionOptions{Provider: true, ResolveProvider: true}
+	type result struct {
+		action *CodeAction
+		err    error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		a, err := c.ResolveCodeAction(action)
+		resc <- result{a, err}
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "codeAction/resolve" {
+		t.Errorf("method = %q; want codeAction/resolve", msg.Method)
+	}
+	var params CodeAction
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if string(params.Data) != `{"id":3}` {
+		t.Errorf("data = %s; want {\"id\":3}", params.Data)
+	}
+	resp := `{"title":"Fill struct","kind":"refactor.rewrite","edit":{"changes":{"file:///a.go":[]}}}`
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(resp)}); err != nil {
+		t.Fatal(err)
+	}
+	r := <-resc
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.action.Edit == nil {
+		t.Errorf("Edit is not resolved: %+v", r.action)
+	}
+}
@@ -0,0 +1,99 @@
+package lsp
+
+// DocumentColorParams represents the interface described in the specification.
+type DocumentColorParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// Color represents the interface described in the specification.
+// Each component is in the range [0, 1].
+type Color struct {
+	Red   float64 `json:"red"`
+	Green float64 `json:"green"`
+	Blue  float64 `json:"blue"`
+	Alpha float64 `json:"alpha"`
+}
+
+// ColorInformation represents the interface described in the specification.
+type ColorInformation struct {
+	Range Range `json:"range"`
+	Color Color `json:"color"`
+}
+
+// ColorInformationsResult represents a result object for document color request.
+type ColorInformationsResult struct {
+	Colors []ColorInformation
+
+	c    *Client
+	call *Call
+}
+
+// DocumentColor sends the document color request to the server.
+func (c *Client) DocumentColor(params *DocumentColorParams) *ColorInformationsResult {
+	const method = "textDocument/documentColor"
+	var result ColorInformationsResult
+	result.c = c
+	if !c.cap.ColorProvider {
+		result.call = c.unsupported(method, params, &result.Colors)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Colors)
+	return &result
+}
+
+// Wait waits for a response of document color request.
+func (r *ColorInformationsResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Colors == nil {
+		r.Colors = []ColorInformation{}
+	}
+	return nil
+}
+
+// ColorPresentationParams represents the interface described in the specification.
+type ColorPresentationParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Color        Color                  `json:"color"`
+	Range        Range                  `json:"range"`
+}
+
+// ColorPresentation represents the interface described in the specification.
+type ColorPresentation struct {
+	Label               string     `json:"label"`
+	TextEdit            *TextEdit  `json:"textEdit,omitempty"`
+	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
+}
+
+// ColorPresentationsResult represents a result object for color presentation request.
+type ColorPresentationsResult struct {
+	Presentations []ColorPresentation
+
+	c    *Client
+	call *Call
+}
+
+// ColorPresentation sends the color presentation request to the server.
+func (c *Client) ColorPresentation(params *ColorPresentationParams) *ColorPresentationsResult {
+	const method = "textDocument/colorPresentation"
+	var result ColorPresentationsResult
+	result.c = c
+	if !c.cap.ColorProvider {
+		result.call = c.unsupported(method, params, &result.Presentations)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Presentations)
+	return &result
+}
+
+// Wait waits for a response of color presentation request.
+func (r *ColorPresentationsResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Presentations == nil {
+		r.Presentations = []ColorPresentation{}
+	}
+	return nil
+}
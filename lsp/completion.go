@@ -0,0 +1,484 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/xerrors"
+)
+
+// InsertTextFormat values.
+const (
+	InsertTextFormatPlainText = 1
+	InsertTextFormatSnippet   = 2
+)
+
+// CompletionTriggerKind values.
+const (
+	CompletionTriggerKindInvoked                         = 1
+	CompletionTriggerKindTriggerCharacter                = 2
+	CompletionTriggerKindTriggerForIncompleteCompletions = 3
+)
+
+// CompletionParams represents the interface described in the specification.
+type CompletionParams struct {
+	TextDocumentPositionParams
+	Context *CompletionContext `json:"context,omitempty"`
+}
+
+// CompletionContext represents the interface described in the specification.
+type CompletionContext struct {
+	TriggerKind      int    `json:"triggerKind"`
+	TriggerCharacter string `json:"triggerCharacter,omitempty"`
+}
+
+// NewCompletionParams returns parameters to request completion at pos in uri.
+// If trigger is empty, the completion is treated as invoked manually.
+// Otherwise it is treated as triggered by typing trigger.
+func NewCompletionParams(uri DocumentURI, pos Position, trigger string) *CompletionParams {
+	ctx := &CompletionContext{
+		TriggerKind: CompletionTriggerKindInvoked,
+	}
+	if trigger != "" {
+		ctx.TriggerKind = CompletionTriggerKindTriggerCharacter
+		ctx.TriggerCharacter = trigger
+	}
+	return &CompletionParams{
+		TextDocumentPositionParams: TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: uri},
+			Position:     pos,
+		},
+		Context: ctx,
+	}
+}
+
+// Retrigger returns a copy of p to re-request completion for an incomplete list.
+func (p *CompletionParams) Retrigger() *CompletionParams {
+	q := *p
+	q.Context = &CompletionContext{
+		TriggerKind: CompletionTriggerKindTriggerForIncompleteCompletions,
+	}
+	return &q
+}
+
+// CompletionList represents the interface described in the specification.
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// The server may respond either CompletionItem[] or CompletionList.
+func (l *CompletionList) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*l = CompletionList{}
+		return nil
+	}
+	if len(b) > 0 && b[0] == '[' {
+		*l = CompletionList{}
+		return json.Unmarshal(b, &l.Items)
+	}
+	type list CompletionList
+	var v list
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*l = CompletionList(v)
+	return nil
+}
+
+// CompletionItem represents the interface described in the specification.
+type CompletionItem struct {
+	Label            string `json:"label"`
+	Kind             int    `json:"kind,omitempty"`
+	Detail           string `json:"detail,omitempty"`
+	Deprecated       bool   `json:"deprecated,omitempty"`
+	Preselect        bool   `json:"preselect,omitempty"`
+	SortText         string `json:"sortText,omitempty"`
+	FilterText       string `json:"filterText,omitempty"`
+	InsertText       string `json:"insertText,omitempty"`
+	InsertTextFormat int    `json:"insertTextFormat,omitempty"`
+
+	TextEdit *CompletionTextEdit `json:"textEdit,omitempty"`
+
+	// AdditionalTextEdits are applied along with the completion, e.g. to add an import.
+	// They must not overlap the primary edit and each other.
+	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
+
+	// Command is executed after the item is inserted.
+	Command *Command `json:"command,omitempty"`
+
+	// Data is preserved between a completion request and a resolve request.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// CompletionTextEdit represents either TextEdit or InsertReplaceEdit described in the specification.
+// Range is set for TextEdit; Insert and Replace are set for InsertReplaceEdit.
+type CompletionTextEdit struct {
+	NewText string `json:"newText"`
+	Range   *Range `json:"range,omitempty"`
+	Insert  *Range `json:"insert,omitempty"`
+	Replace *Range `json:"replace,omitempty"`
+}
+
+// Text returns the text to insert and its placeholders.
+// If item is a snippet, placeholders are stripped from the text.
+// If item has no insertText, Text returns its label as is.
+func (item *CompletionItem) Text() (string, []Placeholder) {
+	if item.InsertText == "" {
+		return item.Label, nil
+	}
+	if item.InsertTextFormat != InsertTextFormatSnippet {
+		return item.InsertText, nil
+	}
+	return ParseSnippet(item.InsertText)
+}
+
+// SortKey returns the string to order item among others; it is SortText or Label.
+func (item *CompletionItem) SortKey() string {
+	if item.SortText != "" {
+		return item.SortText
+	}
+	return item.Label
+}
+
+// FilterKey returns the string to match item against a typed prefix; it is FilterText or Label.
+func (item *CompletionItem) FilterKey() string {
+	if item.FilterText != "" {
+		return item.FilterText
+	}
+	return item.Label
+}
+
+// FilterCompletionItems returns items whose FilterKey starts with prefix,
+// ordered by their SortKey. The prefix is matched case-insensitively.
+// Items that have the same SortKey are kept in order of the server.
+func FilterCompletionItems(items []CompletionItem, prefix string) []CompletionItem {
+	prefix = strings.ToLower(prefix)
+	a := make([]CompletionItem, 0, len(items))
+	for _, item := range items {
+		if strings.HasPrefix(strings.ToLower(item.FilterKey()), prefix) {
+			a = append(a, item)
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool {
+		return a[i].SortKey() < a[j].SortKey()
+	})
+	return a
+}
+
+// ApplyCompletion returns text that item is completed at pos.
+// If item has textEdit, its range is replaced with the new text;
+// the insert range is used for InsertReplaceEdit. Otherwise the word before pos
+// is replaced with the text of item. Placeholders of snippets are stripped.
+// Item's additionalTextEdits are applied together.
+func ApplyCompletion(item *CompletionItem, text string, pos Position) (string, error) {
+	return applyCompletion(item, text, pos, false)
+}
+
+// ApplyCompletionReplace is like ApplyCompletion, but it uses the replace range for InsertReplaceEdit.
+func ApplyCompletionReplace(item *CompletionItem, text string, pos Position) (string, error) {
+	return applyCompletion(item, text, pos, true)
+}
+
+func applyCompletion(item *CompletionItem, text string, pos Position, replace bool) (string, error) {
+	edit, err := completionEdit(item, text, pos, replace)
+	if err != nil {
+		return "", err
+	}
+	edits := make([]TextEdit, 0, 1+len(item.AdditionalTextEdits))
+	edits = append(edits, edit)
+	for _, e := range item.AdditionalTextEdits {
+		if e.Range.Overlaps(edit.Range) {
+			return "", xerrors.Errorf("completion %q: additional edit %v overlaps the completion", item.Label, e.Range)
+		}
+		edits = append(edits, e)
+	}
+	return ApplyEdits(text, edits)
+}
+
+// completionEdit returns the primary edit of item.
+func completionEdit(item *CompletionItem, text string, pos Position, replace bool) (TextEdit, error) {
+	e := item.TextEdit
+	if e == nil {
+		s, _ := item.Text()
+		return TextEdit{
+			Range:   Range{Start: wordStart(text, pos), End: pos},
+			NewText: s,
+		}, nil
+	}
+	var r *Range
+	switch {
+	case e.Range != nil:
+		r = e.Range
+	case replace && e.Replace != nil:
+		r = e.Replace
+	case e.Insert != nil:
+		r = e.Insert
+	default:
+		return TextEdit{}, xerrors.Errorf("completion %q: textEdit has no range", item.Label)
+	}
+	s := e.NewText
+	if item.InsertTextFormat == InsertTextFormatSnippet {
+		s, _ = ParseSnippet(s)
+	}
+	return TextEdit{Range: *r, NewText: s}, nil
+}
+
+// wordStart returns the position where the word that ends at pos begins.
+func wordStart(text string, pos Position) Position {
+	off := runeOffset(text, pos)
+	s := []rune(text)
+	i := off
+	for i > 0 && isWordRune(s[i-1]) {
+		i--
+	}
+	if i == off {
+		return pos
+	}
+	return AcmeOffsetToPosition(text, i)
+}
+
+func isWordRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// ExecuteCompletionCommand executes the command of item on the server.
+// It should be called after the item is applied. If item has no command, it does nothing.
+// Commands that the server doesn't advertise, such as ones for a specific editor,
+// fail with ErrUnsupported.
+func (c *Client) ExecuteCompletionCommand(item *CompletionItem) error {
+	if item.Command == nil {
+		return nil
+	}
+	return c.ExecuteCommand(&ExecuteCommandParams{
+		Command:   item.Command.Command,
+		Arguments: item.Command.Arguments,
+	}).Wait()
+}
+
+// CompletionTriggerCharacters returns characters that trigger completion automatically.
+// It returns nil before the initialize request completes.
+func (c *Client) CompletionTriggerCharacters() []string {
+	return copyStrings(c.cap.CompletionProvider.TriggerCharacters)
+}
+
+// CompletionListResult represents a result object for completion request.
+type CompletionListResult struct {
+	List CompletionList
+
+	c    *Client
+	call *Call
+}
+
+// Completion sends the completion request to the server.
+func (c *Client) Completion(params *CompletionParams) *CompletionListResult {
+	const method = "textDocument/completion"
+	var result CompletionListResult
+	result.c = c
+	if !c.cap.CompletionProvider.Provider {
+		result.call = c.unsupported(method, params, &result.List)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.List)
+	return &result
+}
+
+// Wait waits for a response of completion request.
+func (r *CompletionListResult) Wait() error {
+	return r.c.Wait(r.call)
+}
+
+// ResolveCompletionItem sends the completion item resolve request to the server,
+// and returns item that its properties such as Detail are filled.
+// If the server doesn't advertise resolveProvider, ResolveCompletionItem returns item as is.
+func (c *Client) ResolveCompletionItem(item *CompletionItem) (*CompletionItem, error) {
+	const method = "completionItem/resolve"
+	if !c.cap.CompletionProvider.ResolveProvider {
+		return item, nil
+	}
+	var resolved CompletionItem
+	if err := c.Wait(c.Call(method, item, &resolved)); err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// Placeholder represents a tab stop in the snippet.
+type Placeholder struct {
+	Index  int    // 0 is the final cursor position
+	Offset int    // offset in runes from the beginning of plain text
+	Text   string // default text; it is empty if the tab stop has no placeholder
+}
+
+// ParseSnippet returns plain text of s that is formatted in snippet syntax,
+// and its placeholders ordered by tab stop. The final tab stop ($0) is placed last.
+func ParseSnippet(s string) (plainText string, placeholders []Placeholder) {
+	p := &snippetParser{s: []rune(s)}
+	p.parse(false)
+	sort.SliceStable(p.placeholders, func(i, j int) bool {
+		a, b := p.placeholders[i].Index, p.placeholders[j].Index
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+	return string(p.out), p.placeholders
+}
+
+type snippetParser struct {
+	s            []rune
+	i            int
+	out          []rune
+	placeholders []Placeholder
+}
+
+func (p *snippetParser) peek() rune {
+	if p.i >= len(p.s) {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+// parse parses elements until end of input or '}' if nested is true.
+func (p *snippetParser) parse(nested bool) {
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == '\\' && p.i+1 < len(p.s) && isSnippetEscape(p.s[p.i+1]):
+			p.out = append(p.out, p.s[p.i+1])
+			p.i += 2
+		case c == '}' && nested:
+			p.i++
+			return
+		case c == '$':
+			p.i++
+			p.parseDollar()
+		default:
+			p.out = append(p.out, c)
+			p.i++
+		}
+	}
+}
+
+func isSnippetEscape(c rune) bool {
+	return c == '$' || c == '}' || c == '\\' || c == ',' || c == '|'
+}
+
+func (p *snippetParser) parseDollar() {
+	switch c := p.peek(); {
+	case isSnippetDigit(c):
+		n := p.number()
+		p.addPlaceholder(n, len(p.out))
+	case isSnippetVarStart(c):
+		p.name() // variables are not resolved
+	case c == '{':
+		start := p.i
+		p.i++
+		p.parseBrace(start)
+	default:
+		p.out = append(p.out, '$')
+	}
+}
+
+func (p *snippetParser) parseBrace(start int) {
+	c := p.peek()
+	switch {
+	case isSnippetDigit(c):
+		n := p.number()
+		off := len(p.out)
+		switch p.peek() {
+		case '}':
+			p.i++
+			p.addPlaceholder(n, off)
+			return
+		case ':':
+			p.i++
+			p.parse(true)
+			p.addPlaceholder(n, off)
+			return
+		case '|':
+			p.i++
+			p.parseChoice()
+			p.addPlaceholder(n, off)
+			return
+		}
+	case isSnippetVarStart(c):
+		p.name()
+		switch p.peek() {
+		case '}':
+			p.i++
+			return
+		case ':':
+			p.i++
+			p.parse(true)
+			return
+		}
+	}
+	// not a snippet syntax; treat it as literal.
+	p.out = append(p.out, '$')
+	p.i = start
+	p.out = append(p.out, p.s[p.i])
+	p.i++
+}
+
+// parseChoice writes the first option of ${1|a,b|} into p.out.
+func (p *snippetParser) parseChoice() {
+	first := true
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == '\\' && p.i+1 < len(p.s) && isSnippetEscape(p.s[p.i+1]):
+			if first {
+				p.out = append(p.out, p.s[p.i+1])
+			}
+			p.i += 2
+		case c == '|' && p.i+1 < len(p.s) && p.s[p.i+1] == '}':
+			p.i += 2
+			return
+		case c == ',':
+			first = false
+			p.i++
+		default:
+			if first {
+				p.out = append(p.out, c)
+			}
+			p.i++
+		}
+	}
+}
+
+func (p *snippetParser) addPlaceholder(n, off int) {
+	p.placeholders = append(p.placeholders, Placeholder{
+		Index:  n,
+		Offset: off,
+		Text:   string(p.out[off:]),
+	})
+}
+
+func (p *snippetParser) number() int {
+	n := 0
+	for isSnippetDigit(p.peek()) {
+		n = n*10 + int(p.s[p.i]-'0')
+		p.i++
+	}
+	return n
+}
+
+func isSnippetDigit(c rune) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isSnippetVarStart(c rune) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func (p *snippetParser) name() {
+	for c := p.peek(); isSnippetVarStart(c) || isSnippetDigit(c); c = p.peek() {
+		p.i++
+	}
+}
@@ -0,0 +1,350 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestParseSnippet(t *testing.T) {
+	tests := []struct {
+		s            string
+		text         string
+		placeholders []Placeholder
+	}{
+		{s: "fmt.Println", text: "fmt.Println"},
+		{
+			s:    "Println(${1:a ...interface{\\}})$0",
+			text: "Println(a ...interface{})",
+			placeholders: []Placeholder{
+				{Index: 1, Offset: 8, Text: "a ...interface{}"},
+				{Index: 0, Offset: 25},
+			},
+		},
+		{
+			s:    "for ${2:i} := range ${1:v} {\n\t$0\n}",
+			text: "for i := range v {\n\t\n}",
+			placeholders: []Placeholder{
+				{Index: 1, Offset: 15, Text: "v"},
+				{Index: 2, Offset: 4, Text: "i"},
+				{Index: 0, Offset: 20},
+			},
+		},
+		{
+			s:    "${1:outer ${2:inner}}",
+			text: "outer inner",
+			placeholders: []Placeholder{
+				{Index: 1, Offset: 0, Text: "outer inner"},
+				{Index: 2, Offset: 6, Text: "inner"},
+			},
+		},
+		{
+			s:    "${1|one,two|} $TM_FILENAME${NAME:default}",
+			text: "one default",
+			placeholders: []Placeholder{
+				{Index: 1, Offset: 0, Text: "one"},
+			},
+		},
+		{s: "cost: $ 5 ${x", text: "cost: $ 5 ${x"},
+		{s: "\\$1", text: "$1"},
+	}
+	for _, tt := range tests {
+		text, placeholders := ParseSnippet(tt.s)
+		if text != tt.text {
+			t.Errorf("ParseSnippet(%q) = %q; want %q", tt.s, text, tt.text)
+		}
+		if !reflect.DeepEqual(placeholders, tt.placeholders) {
+			t.Errorf("ParseSnippet(%q) = %v; want %v", tt.s, placeholders, tt.placeholders)
+		}
+	}
+}
+
+func TestClientTriggerCharacters(t *testing.T) {
+	var c Client
+	if a := c.CompletionTriggerCharacters(); a != nil {
+		t.Errorf("CompletionTriggerCharacters() = %q before initialize; want nil", a)
+	}
+	b := []byte(`{
+		"completionProvider": {"triggerCharacters": ["."]},
+		"signatureHelpProvider": {"triggerCharacters": ["(", ","]}
+	}`)
+	if err := json.Unmarshal(b, &c.cap); err != nil {
+		t.Fatal(err)
+	}
+	if a, want := c.CompletionTriggerCharacters(), []string{"."}; !reflect.DeepEqual(a, want) {
+		t.Errorf("CompletionTriggerCharacters() = %q; want %q", a, want)
+	}
+	if a, want := c.SignatureHelpTriggerCharacters(), []string{"(", ","}; !reflect.DeepEqual(a, want) {
+		t.Errorf("SignatureHelpTriggerCharacters() = %q; want %q", a, want)
+	}
+}
+
+func TestNewCompletionParams(t *testing.T) {
+	tests := []struct {
+		trigger string
+		want    string
+	}{
+		{"", `{"textDocument":{"uri":"file:///a.go"},"position":{"line":1,"character":4},"context":{"triggerKind":1}}`},
+		{".", `{"textDocument":{"uri":"file:///a.go"},"position":{"line":1,"character":4},"context":{"triggerKind":2,"triggerCharacter":"."}}`},
+	}
+	for _, tt := range tests {
+		p := NewCompletionParams("file:///a.go", Position{Line: 1, Character: 4}, tt.trigger)
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != tt.want {
+			t.Errorf("NewCompletionParams(%q) = %s; want %s", tt.trigger, s, tt.want)
+		}
+	}
+}
+
+func TestCompletionItemText(t *testing.T) {
+	tests := []struct {
+		item CompletionItem
+		text string
+	}{
+		{CompletionItem{Label: "$x", InsertTextFormat: InsertTextFormatSnippet}, "$x"},
+		{CompletionItem{Label: "Println", InsertText: "Println($1)", InsertTextFormat: InsertTextFormatSnippet}, "Println()"},
+		{CompletionItem{Label: "Println", InsertText: "Println($1)"}, "Println($1)"},
+	}
+	for _, tt := range tests {
+		if s, _ := tt.item.Text(); s != tt.text {
+			t.Errorf("Text() of %+v = %q; want %q", tt.item, s, tt.text)
+		}
+	}
+}
+
+func TestClientCompletionUnsupported(t *testing.T) {
+	var c Client
+	if err := c.Completion(&CompletionParams{}).Wait(); err == nil {
+		t.Errorf("Completion should fail without completionProvider")
+	}
+}
+
+func TestFilterCompletionItems(t *testing.T) {
+	items := []CompletionItem{
+		{Label: "Println", SortText: "00002"},
+		{Label: "Printf", SortText: "00001"},
+		{Label: "Sprint", SortText: "00000"},
+		{Label: "fmt.Print", FilterText: "Print", SortText: "00003"},
+		{Label: "Print"},
+		{Label: "print"},
+	}
+	a := FilterCompletionItems(items, "pri")
+	var labels []string
+	for _, item := range a {
+		labels = append(labels, item.Label)
+	}
+	want := []string{"Printf", "Println", "fmt.Print", "Print", "print"}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("FilterCompletionItems = %v; want %v", labels, want)
+	}
+	if n := len(FilterCompletionItems(items, "")); n != len(items) {
+		t.Errorf("FilterCompletionItems with empty prefix returns %d items; want %d", n, len(items))
+	}
+}
+
+func TestApplyCompletion(t *testing.T) {
+	const text = "package a\n\nfunc f() {\n\tfmt.Prln()\n}\n"
+	pos := Position{Line: 3, Character: 7} // after "fmt.Pr"
+	r := func(c0, c1 int) *Range {
+		return &Range{Start: Position{Line: 3, Character: c0}, End: Position{Line: 3, Character: c1}}
+	}
+	tests := []struct {
+		name    string
+		item    CompletionItem
+		replace bool
+		want    string
+	}{
+		{
+			name: "label",
+			item: CompletionItem{Label: "Println"},
+			want: "\tfmt.Printlnln()",
+		},
+		{
+			name: "textEdit",
+			item: CompletionItem{Label: "Println", TextEdit: &CompletionTextEdit{NewText: "Println", Range: r(5, 9)}},
+			want: "\tfmt.Println()",
+		},
+		{
+			name: "insert",
+			item: CompletionItem{Label: "Println", TextEdit: &CompletionTextEdit{NewText: "Println", Insert: r(5, 7), Replace: r(5, 9)}},
+			want: "\tfmt.Printlnln()",
+		},
+		{
+			name:    "replace",
+			item:    CompletionItem{Label: "Println", TextEdit: &CompletionTextEdit{NewText: "Println", Insert: r(5, 7), Replace: r(5, 9)}},
+			replace: true,
+			want:    "\tfmt.Println()",
+		},
+		{
+			name: "snippet",
+			item: CompletionItem{
+				Label:            "Println",
+				InsertTextFormat: InsertTextFormatSnippet,
+				TextEdit:         &CompletionTextEdit{NewText: "Println(${1:a})", Range: r(5, 11)},
+			},
+			want: "\tfmt.Println(a)",
+		},
+	}
+	for _, tt := range tests {
+		f := ApplyCompletion
+		if tt.replace {
+			f = ApplyCompletionReplace
+		}
+		s, err := f(&tt.item, text, pos)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if line := strings.Split(s, "\n")[3]; line != tt.want {
+			t.Errorf("%s: line = %q; want %q", tt.name, line, tt.want)
+		}
+	}
+}
+
+func TestCompletionTextEditUnmarshal(t *testing.T) {
+	s := `{"label":"x","textEdit":{"newText":"x","insert":{"start":{"line":0,"character":0},"end":{"line":0,"character":1}},"replace":{"start":{"line":0,"character":0},"end":{"line":0,"character":2}}}}`
+	var item CompletionItem
+	if err := json.Unmarshal([]byte(s), &item); err != nil {
+		t.Fatal(err)
+	}
+	e := item.TextEdit
+	if e == nil || e.Range != nil || e.Insert == nil || e.Replace == nil || e.Replace.End.Character != 2 {
+		t.Errorf("TextEdit = %+v", e)
+	}
+}
+
+func TestApplyCompletionAdditionalTextEdits(t *testing.T) {
+	const text = "package a\n\nfunc f() {\n\tstrings.Sp\n}\n"
+	item := CompletionItem{
+		Label: "Split",
+		TextEdit: &CompletionTextEdit{
+			NewText: "Split",
+			Range:   &Range{Start: Position{Line: 3, Character: 9}, End: Position{Line: 3, Character: 11}},
+		},
+		AdditionalTextEdits: []TextEdit{{
+			Range:   Range{Start: Position{Line: 1}, End: Position{Line: 1}},
+			NewText: "\nimport \"strings\"\n",
+		}},
+	}
+	s, err := ApplyCompletion(&item, text, Position{Line: 3, Character: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package a\n\nimport \"strings\"\n\nfunc f() {\n\tstrings.Split\n}\n"
+	if s != want {
+		t.Errorf("ApplyCompletion = %q; want %q", s, want)
+	}
+
+	item.AdditionalTextEdits[0].Range = Range{Start: Position{Line: 3, Character: 1}, End: Position{Line: 3, Character: 10}}
+	if _, err := ApplyCompletion(&item, text, Position{Line: 3, Character: 11}); err == nil {
+		t.Errorf("ApplyCompletion with overlapped edits: succeeded")
+	}
+}
+
+func TestClientExecuteCompletionCommand(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	if err := c.ExecuteCompletionCommand(&CompletionItem{Label: "x"}); err != nil {
+		t.Errorf("ExecuteCompletionCommand without command: %v", err)
+	}
+	item := CompletionItem{
+		Label: "x",
+		Command: &Command{
+			Title:     "Add import",
+			Command:   "gopls.add_import",
+			Arguments: []json.RawMessage{json.RawMessage(`{"ImportPath":"strings"}`)},
+		},
+	}
+	if err := c.ExecuteCompletionCommand(&item); !xerrors.Is(err, ErrUnsupported) {
+		t.Errorf("ExecuteCompletionCommand with unknown command = %v; want ErrUnsupported", err)
+	}
+
+	c.cap.ExecuteCommandProvider.Commands = []string{"gopls.add_import"}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.ExecuteCompletionCommand(&item)
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params ExecuteCommandParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Command != "gopls.add_import" || len(params.Arguments) != 1 {
+		t.Errorf("executeCommand params = %+v", params)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("ExecuteCompletionCommand: %v", err)
+	}
+}
+
+func TestClientResolveDataRoundTrip(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+	c.cap.CompletionProvider = CompletionOptions{Provider: true, ResolveProvider: true}
+	c.cap.CodeActionProvider = CodeActionOptions{Provider: true, ResolveProvider: true}
+
+	// the blob holds values that are changed if they were decoded and encoded again.
+	const data = `{"id":12345678901234567890,"f":1.50e+3,"s":"\u00e9\"x","a":[null,{}]}`
+
+	// respond responds result to the request, then checks data in the resolve request.
+	respond := func(result string, wait func() error, resolve func() error) {
+		t.Helper()
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(result)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := wait(); err != nil {
+			t.Fatalf("%s: %v", msg.Method, err)
+		}
+		errc := make(chan error, 1)
+		go func() { errc <- resolve() }()
+		msg, err = s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var params struct {
+			Data json.RawMessage
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		if string(params.Data) != data {
+			t.Errorf("%s: data = %s; want %s", msg.Method, params.Data, data)
+		}
+		if err := s.write(&Message{ID: msg.ID, Result: msg.Params}); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errc; err != nil {
+			t.Errorf("%s: %v", msg.Method, err)
+		}
+	}
+
+	list := c.Completion(&CompletionParams{})
+	respond(`{"isIncomplete":false,"items":[{"label":"Println","data":`+data+`}]}`, list.Wait, func() error {
+		_, err := c.ResolveCompletionItem(&list.List.Items[0])
+		return err
+	})
+	actions := c.CodeAction(&CodeActionParams{})
+	respond(`[{"title":"Fill struct","data":`+data+`}]`, actions.Wait, func() error {
+		_, err := c.ResolveCodeAction(&actions.Actions[0])
+		return err
+	})
+}
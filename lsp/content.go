@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// ContentProvider provides the current text of documents,
+// such as bodies of editor windows that are not saved yet.
+type ContentProvider interface {
+	// Content returns the text of uri.
+	// It should return an error wrapping os.ErrNotExist if it doesn't hold uri,
+	// then the client reads the file on disk instead.
+	Content(uri DocumentURI) (string, error)
+}
+
+// ContentProviderFunc is an adapter to use an ordinary function as ContentProvider.
+type ContentProviderFunc func(uri DocumentURI) (string, error)
+
+// Content calls f(uri).
+func (f ContentProviderFunc) Content(uri DocumentURI) (string, error) {
+	return f(uri)
+}
+
+// SetContentProvider sets p that the client queries for the text of documents.
+// If p is nil, documents are read from disk.
+func (c *Client) SetContentProvider(p ContentProvider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.content = p
+}
+
+func (c *Client) contentProvider() ContentProvider {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.content
+}
+
+// Content returns the current text of uri.
+// It returns the text of the open document that c sent to the server lastly if any.
+// Otherwise it queries the content provider, then reads the file on disk.
+func (c *Client) Content(uri DocumentURI) (string, error) {
+	if text, ok := c.text(uri); ok {
+		return text, nil
+	}
+	if p := c.contentProvider(); p != nil {
+		s, err := p.Content(uri)
+		if err == nil {
+			return s, nil
+		}
+		if !xerrors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return readURI(uri)
+}
+
+// readURI reads the file on disk that uri points to.
+func readURI(uri DocumentURI) (string, error) {
+	file, err := uriToPath(uri)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// EditDocument returns the current text of uri that edits are applied to.
+// The document itself is not changed.
+func (c *Client) EditDocument(uri DocumentURI, edits []TextEdit) (string, error) {
+	text, err := c.Content(uri)
+	if err != nil {
+		return "", err
+	}
+	return ApplyEdits(text, edits)
+}
@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestClientContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := DocumentURI(fileSchema + file)
+	other := DocumentURI(fileSchema + filepath.Join(dir, "b.go"))
+
+	var c Client
+	if s, err := c.Content(uri); err != nil || s != "package a\n" {
+		t.Errorf("Content without provider = %q, %v; want the file", s, err)
+	}
+	c.SetContentProvider(ContentProviderFunc(func(u DocumentURI) (string, error) {
+		if u == uri {
+			return "package unsaved\n", nil
+		}
+		return "", xerrors.Errorf("%s: %w", u, os.ErrNotExist)
+	}))
+	if s, err := c.Content(uri); err != nil || s != "package unsaved\n" {
+		t.Errorf("Content = %q, %v; want the provided text", s, err)
+	}
+	if _, err := c.Content(other); !xerrors.Is(err, os.ErrNotExist) {
+		t.Errorf("Content(%s) = %v; want %v", other, err, os.ErrNotExist)
+	}
+
+	s, err := c.EditDocument(uri, []TextEdit{
+		{
+			Range: Range{
+				Start: Position{Line: 0, Character: 8},
+				End:   Position{Line: 0, Character: 15},
+			},
+			NewText: "b",
+		},
+	})
+	if err != nil || s != "package b\n" {
+		t.Errorf("EditDocument = %q, %v; want %q", s, err, "package b\n")
+	}
+}
+
+func TestClientContentOpenDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := DocumentURI(fileSchema + file)
+
+	var c Client
+	c.SetContentProvider(ContentProviderFunc(func(u DocumentURI) (string, error) {
+		return "package unsaved\n", nil
+	}))
+	c.setVersion(uri, 1)
+	c.setText(uri, "package open\n")
+	if s, err := c.Content(uri); err != nil || s != "package open\n" {
+		t.Errorf("Content = %q, %v; want the text of the open document", s, err)
+	}
+}
+
+func TestClientApplyWorkspaceEditContentProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := DocumentURI(fileSchema + file)
+
+	var c Client
+	c.SetContentProvider(ContentProviderFunc(func(u DocumentURI) (string, error) {
+		return "package unsaved\n", nil
+	}))
+	p, err := c.PreviewWorkspaceEdit(&WorkspaceEdit{
+		Changes: map[DocumentURI][]TextEdit{
+			uri: {{Range: Range{Start: Position{Line: 1}, End: Position{Line: 1}}, NewText: "// x\n"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Changes) != 1 || p.Changes[0].Old != "package unsaved\n" {
+		t.Errorf("Changes = %+v; want the edit of the provided text", p.Changes)
+	}
+}
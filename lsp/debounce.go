@@ -0,0 +1,180 @@
+package lsp
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultDebounceDelay is the quiet period used by DebouncedDidChange if delay is zero.
+const DefaultDebounceDelay = 200 * time.Millisecond
+
+// DidChangeDebouncer coalesces rapid updates of a document into a single
+// didChange notification that is sent after a quiet period.
+// Only the latest text is sent, as a full content change.
+// Pending updates are discarded when the client is closed.
+type DidChangeDebouncer struct {
+	c     *Client
+	uri   DocumentURI
+	delay time.Duration
+
+	mu      sync.Mutex
+	text    string
+	pending bool
+	timer   *time.Timer
+	err     error // first error of the notifications sent by the timer
+
+	sendMu sync.Mutex // serializes notifications; held before mu
+}
+
+// DebouncedDidChange returns a debouncer for uri that must already be opened.
+// If delay is zero, DefaultDebounceDelay is used.
+func (c *Client) DebouncedDidChange(uri DocumentURI, delay time.Duration) *DidChangeDebouncer {
+	if delay <= 0 {
+		delay = DefaultDebounceDelay
+	}
+	return &DidChangeDebouncer{
+		c:     c,
+		uri:   uri,
+		delay: delay,
+	}
+}
+
+// Update records text as the latest state of the document and restarts the timer.
+// Update does nothing after the client is closed.
+func (d *DidChangeDebouncer) Update(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.pending && !d.c.addDebouncer(d) {
+		return
+	}
+	d.text = text
+	d.pending = true
+	if d.timer == nil {
+		d.timer = time.AfterFunc(d.delay, d.fire)
+		return
+	}
+	d.timer.Reset(d.delay)
+}
+
+func (d *DidChangeDebouncer) fire() {
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+	if err := d.flush(); err != nil {
+		d.mu.Lock()
+		if d.err == nil {
+			d.err = err
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Flush sends the pending update immediately, if any.
+// It also reports an error that occurred while sending a previous update from the timer.
+func (d *DidChangeDebouncer) Flush() error {
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.mu.Unlock()
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+	err := d.flush()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev := d.err
+	d.err = nil
+	switch {
+	case prev == nil:
+		return err
+	case err == nil:
+		return xerrors.Errorf("delayed update: %w", prev)
+	default:
+		return xerrors.Errorf("%w (delayed update also failed: %v)", err, prev)
+	}
+}
+
+// Stop discards the pending update.
+func (d *DidChangeDebouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.done()
+}
+
+// done clears the pending update. d.mu must be held.
+func (d *DidChangeDebouncer) done() {
+	if d.pending {
+		d.pending = false
+		d.c.removeDebouncer(d)
+	}
+}
+
+// flush sends the pending update. It doesn't hold d.mu while it sends the notification,
+// so Update can record a new text meanwhile.
+// d.sendMu must be held.
+func (d *DidChangeDebouncer) flush() error {
+	d.mu.Lock()
+	if !d.pending {
+		d.mu.Unlock()
+		return nil
+	}
+	text := d.text
+	d.done()
+	d.mu.Unlock()
+
+	v, ok := d.c.version(d.uri)
+	if !ok {
+		return xerrors.Errorf("%s: document is not opened", d.uri)
+	}
+	v++
+	return d.c.DidChangeTextDocument(&DidChangeTextDocumentParams{
+		TextDocument: VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: TextDocumentIdentifier{URI: d.uri},
+			Version:                &v,
+		},
+		ContentChanges: []TextDocumentContentChangeEvent{
+			{Text: text},
+		},
+	})
+}
+
+// addDebouncer registers d to be stopped by Close.
+// It reports false if c is closed already.
+func (c *Client) addDebouncer(d *DidChangeDebouncer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.quit:
+		return false
+	default:
+	}
+	if c.debouncers == nil {
+		c.debouncers = make(map[*DidChangeDebouncer]struct{})
+	}
+	c.debouncers[d] = struct{}{}
+	return true
+}
+
+func (c *Client) removeDebouncer(d *DidChangeDebouncer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.debouncers, d)
+}
+
+// stopDebouncers discards pending updates of debouncers.
+func (c *Client) stopDebouncers() {
+	c.mu.Lock()
+	a := make([]*DidChangeDebouncer, 0, len(c.debouncers))
+	for d := range c.debouncers {
+		a = append(a, d)
+	}
+	c.mu.Unlock()
+	for _, d := range a {
+		d.Stop()
+	}
+}
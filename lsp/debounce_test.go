@@ -0,0 +1,128 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDidChangeDebouncer(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	const uri = "file:///home/me/a.go"
+	c.setVersion(uri, 1)
+	d := c.DebouncedDidChange(uri, 20*time.Millisecond)
+	d.Update("a")
+	d.Update("ab")
+	d.Update("abc")
+
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "textDocument/didChange" {
+		t.Fatalf("method = %q; want textDocument/didChange", msg.Method)
+	}
+	var params DidChangeTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if v := params.TextDocument.Version; v == nil || *v != 2 {
+		t.Errorf("version = %v; want 2", v)
+	}
+	if n := len(params.ContentChanges); n != 1 {
+		t.Fatalf("len(contentChanges) = %d; want 1", n)
+	}
+	if e := params.ContentChanges[0]; e.Range != nil || e.Text != "abc" {
+		t.Errorf("contentChanges[0] = %+v; want full text %q", e, "abc")
+	}
+	if err := d.Flush(); err != nil {
+		t.Errorf("Flush: %v", err)
+	}
+	if v, _ := c.version(uri); v != 2 {
+		t.Errorf("version after flush = %d; want 2", v)
+	}
+}
+
+func TestDidChangeDebouncerFlush(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	const uri = "file:///home/me/a.go"
+	c.setVersion(uri, 1)
+	d := c.DebouncedDidChange(uri, time.Hour)
+	d.Update("a")
+	errc := make(chan error, 1)
+	go func() {
+		errc <- d.Flush()
+	}()
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	d.Update("b")
+	d.Stop()
+	if err := d.Flush(); err != nil {
+		t.Errorf("Flush after Stop: %v", err)
+	}
+	if v, _ := c.version(uri); v != 2 {
+		t.Errorf("version = %d; want 2", v)
+	}
+}
+
+func TestDidChangeDebouncerTimerError(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	const uri = "file:///home/me/a.go"
+	d := c.DebouncedDidChange(uri, time.Millisecond)
+	d.Update("a") // the document is not opened
+	for {
+		d.mu.Lock()
+		err := d.err
+		d.mu.Unlock()
+		if err != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := d.Flush(); err == nil {
+		t.Errorf("Flush: want the error of the update sent by the timer")
+	}
+	if err := d.Flush(); err != nil {
+		t.Errorf("Flush: error is reported twice: %v", err)
+	}
+}
+
+func TestDidChangeDebouncerClose(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer s.Close()
+
+	const uri = "file:///home/me/a.go"
+	c.setVersion(uri, 1)
+	d := c.DebouncedDidChange(uri, time.Hour)
+	d.Update("a")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d.mu.Lock()
+	pending := d.pending
+	d.mu.Unlock()
+	if pending {
+		t.Errorf("pending update is not discarded by Close")
+	}
+	d.Update("b")
+	if err := d.Flush(); err != nil {
+		t.Errorf("Flush after Close: %v", err)
+	}
+	if n := len(c.debouncers); n != 0 {
+		t.Errorf("%d debouncers are left after Close", n)
+	}
+}
@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// maxSnippet is the maximum length of Payload in DecodeError.
+const maxSnippet = 256
+
+// DecodeError is returned when a message or a result from the server can't be decoded.
+type DecodeError struct {
+	Payload string // the offending JSON; truncated around the error
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v in %s", e.Err, e.Payload)
+}
+
+// Unwrap returns e.Err.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError returns a DecodeError of err that occurred while decoding b.
+func decodeError(b []byte, err error) error {
+	var off int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		off = e.Offset
+	case *json.UnmarshalTypeError:
+		off = e.Offset
+	}
+	return &DecodeError{Payload: snippet(b, int(off)), Err: err}
+}
+
+// snippet returns the part of b around off that is at most maxSnippet bytes plus ellipses.
+// Since encoding/json reports the offset after the offending value, the part mostly precedes off.
+func snippet(b []byte, off int) string {
+	if len(b) <= maxSnippet {
+		return string(b)
+	}
+	i := off - maxSnippet*3/4
+	if i < 0 {
+		i = 0
+	}
+	j := i + maxSnippet
+	if j > len(b) {
+		j = len(b)
+		i = j - maxSnippet
+	}
+	for i > 0 && !utf8.RuneStart(b[i]) {
+		i--
+	}
+	for j < len(b) && !utf8.RuneStart(b[j]) {
+		j--
+	}
+	s := string(b[i:j])
+	if i > 0 {
+		s = "..." + s
+	}
+	if j < len(b) {
+		s += "..."
+	}
+	return s
+}
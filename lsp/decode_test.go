@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestReadMessageDecodeError(t *testing.T) {
+	body := `{"jsonrpc":"2.0","method":"` + strings.Repeat("x", 500) + `","id":"abc","params":null}`
+	s := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+	var c Client
+	_, err := c.readMessage(bufio.NewReader(strings.NewReader(s)))
+	var e *DecodeError
+	if !xerrors.As(err, &e) {
+		t.Fatalf("readMessage = %v; want a DecodeError", err)
+	}
+	if !strings.Contains(e.Payload, `"id":"abc"`) || !strings.HasPrefix(e.Payload, "...") {
+		t.Errorf("Payload = %q; want a snippet around the id", e.Payload)
+	}
+	if n := len(e.Payload); n > maxSnippet+6 {
+		t.Errorf("len(Payload) = %d; want at most %d", n, maxSnippet+6)
+	}
+}
+
+func TestClientDecodeError(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	var reply []Location
+	call := c.Call("textDocument/definition", &TextDocumentPositionParams{}, &reply)
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const result = `{"uri":"file:///a.go"}`
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(result)}); err != nil {
+		t.Fatal(err)
+	}
+	err = call.Wait()
+	var e *DecodeError
+	if !xerrors.As(err, &e) {
+		t.Fatalf("Wait = %v; want a DecodeError", err)
+	}
+	if e.Payload != result {
+		t.Errorf("Payload = %q; want %q", e.Payload, result)
+	}
+	var te *json.UnmarshalTypeError
+	if !xerrors.As(err, &te) {
+		t.Errorf("Wait = %v; want to wrap json.UnmarshalTypeError", err)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	b := []byte(strings.Repeat("あ", 200))
+	s := snippet(b, 300)
+	if !strings.HasPrefix(s, "...") || !strings.HasSuffix(s, "...") {
+		t.Errorf("snippet = %q; want ellipses on both sides", s)
+	}
+	if t2 := strings.Trim(s, "."); strings.Trim(t2, "あ") != "" {
+		t.Errorf("snippet = %q; want only whole runes", s)
+	}
+	if s := snippet([]byte("{}"), 1); s != "{}" {
+		t.Errorf("snippet = %q; want {}", s)
+	}
+}
@@ -0,0 +1,431 @@
+package lsp
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// DiagnosticSeverity represents the severity of Diagnostic.
+// Lower value is more severe.
+type DiagnosticSeverity int
+
+// DiagnosticSeverity values.
+const (
+	DiagnosticSeverityError       DiagnosticSeverity = 1
+	DiagnosticSeverityWarning     DiagnosticSeverity = 2
+	DiagnosticSeverityInformation DiagnosticSeverity = 3
+	DiagnosticSeverityHint        DiagnosticSeverity = 4
+)
+
+// DiagnosticTag represents additional metadata about Diagnostic.
+type DiagnosticTag int
+
+// DiagnosticTag values.
+const (
+	DiagnosticTagUnnecessary DiagnosticTag = 1
+	DiagnosticTagDeprecated  DiagnosticTag = 2
+)
+
+// HasTag reports whether d is tagged with tag.
+func (d *Diagnostic) HasTag(tag DiagnosticTag) bool {
+	for _, t := range d.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// DiagnosticCode represents the code of Diagnostic.
+// The specification allows it to be either integer or string;
+// an integer is held in its representation as received.
+type DiagnosticCode struct {
+	Value  string
+	Number bool // Value was sent as an integer
+}
+
+// String returns code.Value.
+func (code DiagnosticCode) String() string {
+	return code.Value
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (code *DiagnosticCode) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*code = DiagnosticCode{Value: s}
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*code = DiagnosticCode{Value: n.String(), Number: true}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// The code is encoded in the same type as it was decoded.
+func (code DiagnosticCode) MarshalJSON() ([]byte, error) {
+	if !code.Number {
+		return json.Marshal(code.Value)
+	}
+	var n json.Number
+	if err := json.Unmarshal([]byte(code.Value), &n); err != nil {
+		return nil, xerrors.Errorf("diagnostic code %q is not a number: %w", code.Value, err)
+	}
+	return []byte(code.Value), nil
+}
+
+// FilterDiagnostics returns diagnostics that are at least as severe as min.
+// Diagnostics without severity are treated as errors.
+// If min is zero, FilterDiagnostics returns a unchanged.
+func FilterDiagnostics(a []Diagnostic, min DiagnosticSeverity) []Diagnostic {
+	if min == 0 {
+		return a
+	}
+	v := make([]Diagnostic, 0, len(a))
+	for _, d := range a {
+		if d.Severity == 0 || d.Severity <= min {
+			v = append(v, d)
+		}
+	}
+	return v
+}
+
+// DiagnosticStore holds the latest diagnostics for each document.
+// The server publishes all diagnostics of a document at once,
+// so Update replaces the previous diagnostics of the document.
+type DiagnosticStore struct {
+	mu sync.Mutex
+	m  map[DocumentURI][]Diagnostic
+}
+
+// NewDiagnosticStore returns an empty DiagnosticStore.
+func NewDiagnosticStore() *DiagnosticStore {
+	return &DiagnosticStore{m: make(map[DocumentURI][]Diagnostic)}
+}
+
+// Update replaces the diagnostics of params.URI with params.Diagnostics.
+// Duplicated diagnostics are removed.
+func (s *DiagnosticStore) Update(params *PublishDiagnosticsParams) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(params.Diagnostics) == 0 {
+		delete(s.m, params.URI)
+		return
+	}
+	s.m[params.URI] = uniqDiagnostics(params.Diagnostics)
+}
+
+type diagnosticKey struct {
+	Range    Range
+	Severity DiagnosticSeverity
+	Code     DiagnosticCode
+	Source   string
+	Message  string
+}
+
+func uniqDiagnostics(a []Diagnostic) []Diagnostic {
+	seen := make(map[diagnosticKey]bool)
+	v := make([]Diagnostic, 0, len(a))
+	for _, d := range a {
+		k := diagnosticKey{
+			Range:    d.Range,
+			Severity: d.Severity,
+			Source:   d.Source,
+			Message:  d.Message,
+		}
+		if d.Code != nil {
+			k.Code = *d.Code
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		v = append(v, d)
+	}
+	return v
+}
+
+// Diagnostics returns current diagnostics of uri.
+func (s *DiagnosticStore) Diagnostics(uri DocumentURI) []Diagnostic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.m[uri]
+	return append([]Diagnostic(nil), a...)
+}
+
+// Snapshot returns a copy of current diagnostics of all documents.
+func (s *DiagnosticStore) Snapshot() map[DocumentURI][]Diagnostic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[DocumentURI][]Diagnostic, len(s.m))
+	for uri, a := range s.m {
+		m[uri] = append([]Diagnostic(nil), a...)
+	}
+	return m
+}
+
+// DiagnosticOptions represents the interface described in the specification.
+type DiagnosticOptions struct {
+	Identifier            string `json:"identifier,omitempty"`
+	InterFileDependencies bool   `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool   `json:"workspaceDiagnostics"`
+}
+
+// DocumentDiagnosticReportKind values.
+const (
+	DocumentDiagnosticReportKindFull      = "full"
+	DocumentDiagnosticReportKindUnchanged = "unchanged"
+)
+
+// DocumentDiagnosticParams represents the interface described in the specification.
+type DocumentDiagnosticParams struct {
+	TextDocument     TextDocumentIdentifier `json:"textDocument"`
+	Identifier       string                 `json:"identifier,omitempty"`
+	PreviousResultID string                 `json:"previousResultId,omitempty"`
+}
+
+// DocumentDiagnosticReport represents the union of full and unchanged reports described in the specification.
+// If Kind is "unchanged", Items is empty in the response.
+type DocumentDiagnosticReport struct {
+	Kind     string       `json:"kind"`
+	ResultID string       `json:"resultId,omitempty"`
+	Items    []Diagnostic `json:"items,omitempty"`
+
+	RelatedDocuments map[DocumentURI]*DocumentDiagnosticReport `json:"relatedDocuments,omitempty"`
+}
+
+// DocumentDiagnosticReportResult represents a result object for document diagnostic request.
+type DocumentDiagnosticReportResult struct {
+	Report DocumentDiagnosticReport
+
+	uri  DocumentURI
+	c    *Client
+	call *Call
+}
+
+// PullDiagnostics sends the document diagnostic request to the server.
+// If params.PreviousResultID is empty, the result id of last report for the document is used.
+func (c *Client) PullDiagnostics(params *DocumentDiagnosticParams) *DocumentDiagnosticReportResult {
+	const method = "textDocument/diagnostic"
+	var result DocumentDiagnosticReportResult
+	result.uri = params.TextDocument.URI
+	result.c = c
+	if c.cap.DiagnosticProvider == nil {
+		result.call = c.unsupported(method, params, &result.Report)
+		return &result
+	}
+	if params.PreviousResultID == "" {
+		if id := c.lastResultID(params.TextDocument.URI); id != "" {
+			p := *params
+			p.PreviousResultID = id
+			params = &p
+		}
+	}
+	result.call = c.Call(method, params, &result.Report)
+	return &result
+}
+
+// Wait waits for a response of document diagnostic request.
+// When the server reports "unchanged", Items is filled with the last full report.
+func (r *DocumentDiagnosticReportResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	r.c.updateReport(r.uri, &r.Report)
+	for uri, report := range r.Report.RelatedDocuments {
+		r.c.updateReport(uri, report)
+	}
+	return nil
+}
+
+func (c *Client) lastResultID(uri DocumentURI) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r := c.pulled[uri]; r != nil {
+		return r.ResultID
+	}
+	return ""
+}
+
+// updateReport records report if it is full, otherwise fills report with the last one.
+func (c *Client) updateReport(uri DocumentURI, report *DocumentDiagnosticReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch report.Kind {
+	case DocumentDiagnosticReportKindFull:
+		if c.pulled == nil {
+			c.pulled = make(map[DocumentURI]*DocumentDiagnosticReport)
+		}
+		c.pulled[uri] = &DocumentDiagnosticReport{
+			Kind:     report.Kind,
+			ResultID: report.ResultID,
+			Items:    report.Items,
+		}
+	case DocumentDiagnosticReportKindUnchanged:
+		if last := c.pulled[uri]; last != nil {
+			report.Items = last.Items
+			last.ResultID = report.ResultID
+		}
+	}
+}
+
+// PreviousResultID represents the interface described in the specification.
+type PreviousResultID struct {
+	URI   DocumentURI `json:"uri"`
+	Value string      `json:"value"`
+}
+
+// WorkspaceDiagnosticParams represents the interface described in the specification.
+type WorkspaceDiagnosticParams struct {
+	Identifier        string             `json:"identifier,omitempty"`
+	PreviousResultIDs []PreviousResultID `json:"previousResultIds"`
+}
+
+// WorkspaceDocumentDiagnosticReport represents the union of
+// full and unchanged workspace document reports described in the specification.
+type WorkspaceDocumentDiagnosticReport struct {
+	DocumentDiagnosticReport
+	URI     DocumentURI `json:"uri"`
+	Version *int        `json:"version"`
+}
+
+// WorkspaceDiagnosticReport represents the interface described in the specification.
+type WorkspaceDiagnosticReport struct {
+	Items []WorkspaceDocumentDiagnosticReport `json:"items"`
+}
+
+// WorkspaceDiagnosticReportResult represents a result object for workspace diagnostic request.
+type WorkspaceDiagnosticReportResult struct {
+	Report WorkspaceDiagnosticReport
+
+	c    *Client
+	call *Call
+}
+
+// WorkspaceDiagnostics sends the workspace diagnostic request to the server.
+// If params.PreviousResultIDs is nil, result ids of last reports are used.
+func (c *Client) WorkspaceDiagnostics(params *WorkspaceDiagnosticParams) *WorkspaceDiagnosticReportResult {
+	const method = "workspace/diagnostic"
+	var result WorkspaceDiagnosticReportResult
+	result.c = c
+	if opts := c.cap.DiagnosticProvider; opts == nil || !opts.WorkspaceDiagnostics {
+		result.call = c.unsupported(method, params, &result.Report)
+		return &result
+	}
+	if params.PreviousResultIDs == nil {
+		p := *params
+		p.PreviousResultIDs = c.previousResultIDs()
+		params = &p
+	}
+	result.call = c.Call(method, params, &result.Report)
+	return &result
+}
+
+// Wait waits for a response of workspace diagnostic request.
+// When the server reports "unchanged" for a document, its Items is filled with the last full report.
+func (r *WorkspaceDiagnosticReportResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	for i := range r.Report.Items {
+		item := &r.Report.Items[i]
+		r.c.updateReport(item.URI, &item.DocumentDiagnosticReport)
+	}
+	return nil
+}
+
+func (c *Client) previousResultIDs() []PreviousResultID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a := make([]PreviousResultID, 0, len(c.pulled))
+	for uri, report := range c.pulled {
+		if report.ResultID == "" {
+			continue
+		}
+		a = append(a, PreviousResultID{URI: uri, Value: report.ResultID})
+	}
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].URI < a[j].URI
+	})
+	return a
+}
+
+// diagnosticSubs holds channels subscribed by SubscribeDiagnostics.
+type diagnosticSubs struct {
+	mu     sync.Mutex
+	m      map[DocumentURI][]chan *PublishDiagnosticsParams
+	closed bool
+}
+
+// SubscribeDiagnostics returns a channel that receives diagnostics only for uri,
+// in addition to c.Diagnostics. Like c.Diagnostics, a pending notification
+// is replaced by newer one. The channel is closed by UnsubscribeDiagnostics or Close.
+func (c *Client) SubscribeDiagnostics(uri DocumentURI) <-chan *PublishDiagnosticsParams {
+	ch := make(chan *PublishDiagnosticsParams, 1)
+	c.subs.mu.Lock()
+	defer c.subs.mu.Unlock()
+	if c.subs.closed {
+		close(ch)
+		return ch
+	}
+	if c.subs.m == nil {
+		c.subs.m = make(map[DocumentURI][]chan *PublishDiagnosticsParams)
+	}
+	c.subs.m[uri] = append(c.subs.m[uri], ch)
+	return ch
+}
+
+// UnsubscribeDiagnostics closes ch returned by SubscribeDiagnostics
+// and stops delivering diagnostics to it.
+func (c *Client) UnsubscribeDiagnostics(ch <-chan *PublishDiagnosticsParams) {
+	c.subs.mu.Lock()
+	defer c.subs.mu.Unlock()
+	for uri, a := range c.subs.m {
+		for i, x := range a {
+			if x != ch {
+				continue
+			}
+			close(x)
+			a = append(a[:i], a[i+1:]...)
+			if len(a) == 0 {
+				delete(c.subs.m, uri)
+			} else {
+				c.subs.m[uri] = a
+			}
+			return
+		}
+	}
+}
+
+// publish sends params to the channels subscribed to its URI without blocking.
+func (s *diagnosticSubs) publish(params *PublishDiagnosticsParams) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.m[params.URI] {
+		// only publish sends to ch, so there is room after the pending one is dropped.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- params
+	}
+}
+
+// close closes all subscribed channels.
+func (s *diagnosticSubs) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.m {
+		for _, ch := range a {
+			close(ch)
+		}
+	}
+	s.m = nil
+	s.closed = true
+}
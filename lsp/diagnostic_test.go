@@ -0,0 +1,232 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiagnosticStore(t *testing.T) {
+	const uri = DocumentURI("file:///tmp/a.go")
+	d1 := Diagnostic{Message: "undeclared name: x", Severity: DiagnosticSeverityError}
+	d2 := Diagnostic{Message: "unused variable", Severity: DiagnosticSeverityWarning}
+
+	s := NewDiagnosticStore()
+	s.Update(&PublishDiagnosticsParams{URI: uri, Diagnostics: []Diagnostic{d1, d1, d2}})
+	if n := len(s.Diagnostics(uri)); n != 2 {
+		t.Errorf("len(Diagnostics) = %d; want 2", n)
+	}
+	s.Update(&PublishDiagnosticsParams{URI: uri, Diagnostics: []Diagnostic{d2}})
+	if a := s.Diagnostics(uri); len(a) != 1 || a[0].Message != d2.Message {
+		t.Errorf("Diagnostics = %v; want [%v]", a, d2)
+	}
+	s.Update(&PublishDiagnosticsParams{URI: uri})
+	if m := s.Snapshot(); len(m) != 0 {
+		t.Errorf("Snapshot = %v; want empty", m)
+	}
+}
+
+func TestDiagnosticCode(t *testing.T) {
+	tests := []struct {
+		body string
+		code DiagnosticCode
+	}{
+		{body: `"UnusedVar"`, code: DiagnosticCode{Value: "UnusedVar"}},
+		{body: `2304`, code: DiagnosticCode{Value: "2304", Number: true}},
+		{body: `"2304"`, code: DiagnosticCode{Value: "2304"}},
+		{body: `"0123"`, code: DiagnosticCode{Value: "0123"}},
+		{body: `"+5"`, code: DiagnosticCode{Value: "+5"}},
+		{body: `"-0"`, code: DiagnosticCode{Value: "-0"}},
+		{body: `-1`, code: DiagnosticCode{Value: "-1", Number: true}},
+	}
+	for _, tt := range tests {
+		var code DiagnosticCode
+		if err := json.Unmarshal([]byte(tt.body), &code); err != nil {
+			t.Fatalf("can't unmarshal: '%v': %v", tt.body, err)
+		}
+		if code != tt.code {
+			t.Errorf("Unmarshal('%v') = %+v; want %+v", tt.body, code, tt.code)
+		}
+		b, err := json.Marshal(Diagnostic{Code: &code})
+		if err != nil {
+			t.Fatalf("can't marshal: %+v: %v", code, err)
+		}
+		var d struct {
+			Code json.RawMessage `json:"code"`
+		}
+		if err := json.Unmarshal(b, &d); err != nil {
+			t.Fatal(err)
+		}
+		if s := string(d.Code); s != tt.body {
+			t.Errorf("Marshal(%+v) = '%s'; want '%s'", code, s, tt.body)
+		}
+	}
+
+	code := DiagnosticCode{Value: "0123", Number: true}
+	if _, err := json.Marshal(code); err == nil {
+		t.Errorf("Marshal(%+v) should fail", code)
+	}
+}
+
+func TestClientPullDiagnostics(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+	c.cap.DiagnosticProvider = &DiagnosticOptions{}
+
+	responses := []string{
+		`{"kind":"full","resultId":"1","items":[{"range":{},"message":"x declared and not used"}],
+		  "relatedDocuments":{"file:///tmp/b.go":{"kind":"full","resultId":"b1","items":[{"range":{},"message":"in b"}]}}}`,
+		`{"kind":"unchanged","resultId":"2",
+		  "relatedDocuments":{"file:///tmp/b.go":{"kind":"unchanged","resultId":"b2"}}}`,
+	}
+	received := make(chan string, len(responses))
+	go func() {
+		for _, resp := range responses {
+			msg, err := s.read()
+			if err != nil {
+				return
+			}
+			var params DocumentDiagnosticParams
+			json.Unmarshal(msg.Params, &params)
+			received <- params.PreviousResultID
+			s.write(&Message{ID: msg.ID, Result: json.RawMessage(resp)})
+		}
+	}()
+
+	params := &DocumentDiagnosticParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///tmp/a.go"},
+	}
+	r := c.PullDiagnostics(params)
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if id := <-received; id != "" {
+		t.Errorf("first request: previousResultId = %q; want empty", id)
+	}
+
+	r = c.PullDiagnostics(params)
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if id := <-received; id != "1" {
+		t.Errorf("second request: previousResultId = %q; want %q", id, "1")
+	}
+	if params.PreviousResultID != "" {
+		t.Errorf("PullDiagnostics shouldn't modify params: %q", params.PreviousResultID)
+	}
+	if n := len(r.Report.Items); n != 1 {
+		t.Errorf("unchanged report has %d items; want the last 1 item", n)
+	}
+	b := r.Report.RelatedDocuments["file:///tmp/b.go"]
+	if b == nil || len(b.Items) != 1 || b.Items[0].Message != "in b" {
+		t.Errorf("related document = %+v; want the last full report", b)
+	}
+	if id := c.lastResultID("file:///tmp/b.go"); id != "b2" {
+		t.Errorf("result id of related document = %q; want %q", id, "b2")
+	}
+}
+
+func TestClientWorkspaceDiagnostics(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+	c.cap.DiagnosticProvider = &DiagnosticOptions{WorkspaceDiagnostics: true}
+
+	responses := []string{
+		`{"items":[
+			{"kind":"full","uri":"file:///tmp/b.go","version":null,"resultId":"b1","items":[{"range":{},"message":"in b"}]},
+			{"kind":"full","uri":"file:///tmp/a.go","version":1,"resultId":"a1","items":[]}
+		]}`,
+		`{"items":[
+			{"kind":"unchanged","uri":"file:///tmp/b.go","version":null,"resultId":"b2"}
+		]}`,
+	}
+	received := make(chan []PreviousResultID, len(responses))
+	go func() {
+		for _, resp := range responses {
+			msg, err := s.read()
+			if err != nil {
+				return
+			}
+			var params WorkspaceDiagnosticParams
+			json.Unmarshal(msg.Params, &params)
+			received <- params.PreviousResultIDs
+			s.write(&Message{ID: msg.ID, Result: json.RawMessage(resp)})
+		}
+	}()
+
+	params := &WorkspaceDiagnosticParams{}
+	if err := c.WorkspaceDiagnostics(params).Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if ids := <-received; len(ids) != 0 {
+		t.Errorf("first request: previousResultIds = %v; want empty", ids)
+	}
+	r := c.WorkspaceDiagnostics(params)
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	want := []PreviousResultID{
+		{URI: "file:///tmp/a.go", Value: "a1"},
+		{URI: "file:///tmp/b.go", Value: "b1"},
+	}
+	if ids := <-received; !reflect.DeepEqual(ids, want) {
+		t.Errorf("second request: previousResultIds = %v; want %v", ids, want)
+	}
+	if params.PreviousResultIDs != nil {
+		t.Errorf("WorkspaceDiagnostics shouldn't modify params: %v", params.PreviousResultIDs)
+	}
+	item := r.Report.Items[0]
+	if len(item.Items) != 1 || item.Items[0].Message != "in b" {
+		t.Errorf("unchanged report = %+v; want the last full report", item)
+	}
+}
+
+func TestClientSubscribeDiagnostics(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer s.Close()
+
+	const uri = "file:///tmp/a.go"
+	ch := c.SubscribeDiagnostics(uri)
+	other := c.SubscribeDiagnostics("file:///tmp/c.go")
+	for _, p := range []string{
+		`{"uri":"file:///tmp/a.go","diagnostics":[{"message":"old"}]}`,
+		`{"uri":"file:///tmp/b.go","diagnostics":[{"message":"b"}]}`,
+		`{"uri":"file:///tmp/a.go","diagnostics":[{"message":"new"}]}`,
+	} {
+		if err := s.write(&Message{Method: "textDocument/publishDiagnostics", Params: json.RawMessage(p)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the global channel receives all documents; wait for the last one.
+	for p := range c.Diagnostics {
+		if p.URI == uri && p.Diagnostics[0].Message == "new" {
+			break
+		}
+	}
+	params := <-ch
+	if params.URI != uri || len(params.Diagnostics) != 1 || params.Diagnostics[0].Message != "new" {
+		t.Errorf("received %+v; want the latest diagnostics of %s", params, uri)
+	}
+	select {
+	case p := <-other:
+		t.Errorf("received %+v for another document", p)
+	default:
+	}
+
+	c.UnsubscribeDiagnostics(ch)
+	if _, ok := <-ch; ok {
+		t.Errorf("channel is not closed after UnsubscribeDiagnostics")
+	}
+	if n := len(c.subs.m[uri]); n != 0 {
+		t.Errorf("%d subscriptions remain", n)
+	}
+	c.Close()
+	if _, ok := <-other; ok {
+		t.Errorf("channel is not closed after Close")
+	}
+	if _, ok := <-c.SubscribeDiagnostics(uri); ok {
+		t.Errorf("SubscribeDiagnostics after Close returns an open channel")
+	}
+}
@@ -0,0 +1,701 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ApplyEdits returns the text that edits are applied to text.
+// Edits must not overlap each other. If some edits insert text at the same position,
+// they are inserted in the order of edits.
+func ApplyEdits(text string, edits []TextEdit) (string, error) {
+	type span struct {
+		start, end int
+		text       string
+	}
+	a := make([]span, len(edits))
+	for i, e := range edits {
+		a[i] = span{
+			start: runeOffset(text, e.Range.Start),
+			end:   runeOffset(text, e.Range.End),
+			text:  e.NewText,
+		}
+		if a[i].start > a[i].end {
+			return "", xerrors.Errorf("invalid range: %v", e.Range)
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool {
+		return a[i].start < a[j].start
+	})
+	for i := 1; i < len(a); i++ {
+		if a[i].start < a[i-1].end {
+			return "", xerrors.Errorf("overlapped edits: #%d,#%d and #%d,#%d", a[i-1].start, a[i-1].end, a[i].start, a[i].end)
+		}
+	}
+	s := []rune(text)
+	var b strings.Builder
+	var p int
+	for _, v := range a {
+		b.WriteString(string(s[p:v.start]))
+		b.WriteString(v.text)
+		p = v.end
+	}
+	b.WriteString(string(s[p:]))
+	return b.String(), nil
+}
+
+// WorkspaceEdit represents the interface described in the specification.
+type WorkspaceEdit struct {
+	Changes         map[DocumentURI][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []DocumentChange           `json:"documentChanges,omitempty"`
+}
+
+// TextEdits returns edits of edit that change the document of uri.
+func (edit *WorkspaceEdit) TextEdits(uri DocumentURI) []TextEdit {
+	var a []TextEdit
+	a = append(a, edit.Changes[uri]...)
+	for _, d := range edit.DocumentChanges {
+		if e := d.TextDocumentEdit; e != nil && e.TextDocument.URI == uri {
+			a = append(a, e.Edits...)
+		}
+	}
+	return a
+}
+
+// ApplyWorkspaceEditParams represents the interface described in the specification.
+type ApplyWorkspaceEditParams struct {
+	Label string        `json:"label,omitempty"`
+	Edit  WorkspaceEdit `json:"edit"`
+}
+
+// ApplyWorkspaceEditResult represents the interface described in the specification.
+type ApplyWorkspaceEditResult struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+// ConfirmApplyEdit returns an option to ask f before the default handler of
+// workspace/applyEdit applies an edit. The edit is applied only if f returns true.
+// The label is the one that the server sent, and may be empty.
+// f runs on the goroutine of the handler, so it can wait for the user.
+func ConfirmApplyEdit(f func(label string, p *EditPreview) bool) Option {
+	return func(c *Client) {
+		c.confirmEdit = f
+	}
+}
+
+// applyEdit is the default handler of workspace/applyEdit requests.
+// It applies the edit like ApplyWorkspaceEdit, and reports the failure to the server if any.
+// Edits to open documents are sent back as didChange notifications before the response.
+func (c *Client) applyEdit(params json.RawMessage) (interface{}, error) {
+	var p ApplyWorkspaceEditParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &ResponseError{
+			Code:    CodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+	preview, err := c.PreviewWorkspaceEdit(&p.Edit)
+	if err != nil {
+		return &ApplyWorkspaceEditResult{FailureReason: err.Error()}, nil
+	}
+	if c.confirmEdit != nil && !c.confirmEdit(p.Label, preview) {
+		return &ApplyWorkspaceEditResult{FailureReason: "rejected by the user"}, nil
+	}
+	if err := preview.Apply(); err != nil {
+		return &ApplyWorkspaceEditResult{FailureReason: err.Error()}, nil
+	}
+	return &ApplyWorkspaceEditResult{Applied: true}, nil
+}
+
+// OptionalVersionedTextDocumentIdentifier represents the interface described in the specification.
+type OptionalVersionedTextDocumentIdentifier struct {
+	TextDocumentIdentifier
+	Version *int `json:"version"` // nil means the document is not open.
+}
+
+// TextDocumentEdit represents the interface described in the specification.
+type TextDocumentEdit struct {
+	TextDocument OptionalVersionedTextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit                              `json:"edits"`
+}
+
+// ResourceOperationKind values.
+const (
+	ResourceOperationKindCreate = "create"
+	ResourceOperationKindRename = "rename"
+	ResourceOperationKindDelete = "delete"
+)
+
+// CreateFile represents the interface described in the specification.
+type CreateFile struct {
+	Kind    string             `json:"kind"` // create
+	URI     DocumentURI        `json:"uri"`
+	Options *CreateFileOptions `json:"options,omitempty"`
+}
+
+// CreateFileOptions represents the interface described in the specification.
+type CreateFileOptions struct {
+	Overwrite      bool `json:"overwrite,omitempty"`
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+// RenameFile represents the interface described in the specification.
+type RenameFile struct {
+	Kind    string             `json:"kind"` // rename
+	OldURI  DocumentURI        `json:"oldUri"`
+	NewURI  DocumentURI        `json:"newUri"`
+	Options *RenameFileOptions `json:"options,omitempty"`
+}
+
+// RenameFileOptions represents the interface described in the specification.
+type RenameFileOptions struct {
+	Overwrite      bool `json:"overwrite,omitempty"`
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+// DeleteFile represents the interface described in the specification.
+type DeleteFile struct {
+	Kind    string             `json:"kind"` // delete
+	URI     DocumentURI        `json:"uri"`
+	Options *DeleteFileOptions `json:"options,omitempty"`
+}
+
+// DeleteFileOptions represents the interface described in the specification.
+type DeleteFileOptions struct {
+	Recursive         bool `json:"recursive,omitempty"`
+	IgnoreIfNotExists bool `json:"ignoreIfNotExists,omitempty"`
+}
+
+// DocumentChange represents an element of WorkspaceEdit.documentChanges.
+// Exactly one of the fields is not nil.
+type DocumentChange struct {
+	TextDocumentEdit *TextDocumentEdit
+	CreateFile       *CreateFile
+	RenameFile       *RenameFile
+	DeleteFile       *DeleteFile
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (d *DocumentChange) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*d = DocumentChange{}
+	switch v.Kind {
+	case "":
+		d.TextDocumentEdit = new(TextDocumentEdit)
+		return json.Unmarshal(b, d.TextDocumentEdit)
+	case ResourceOperationKindCreate:
+		d.CreateFile = new(CreateFile)
+		return json.Unmarshal(b, d.CreateFile)
+	case ResourceOperationKindRename:
+		d.RenameFile = new(RenameFile)
+		return json.Unmarshal(b, d.RenameFile)
+	case ResourceOperationKindDelete:
+		d.DeleteFile = new(DeleteFile)
+		return json.Unmarshal(b, d.DeleteFile)
+	default:
+		return xerrors.Errorf("unknown resource operation: %s", v.Kind)
+	}
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (d DocumentChange) MarshalJSON() ([]byte, error) {
+	switch {
+	case d.TextDocumentEdit != nil:
+		return json.Marshal(d.TextDocumentEdit)
+	case d.CreateFile != nil:
+		return json.Marshal(d.CreateFile)
+	case d.RenameFile != nil:
+		return json.Marshal(d.RenameFile)
+	case d.DeleteFile != nil:
+		return json.Marshal(d.DeleteFile)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+// ApplyWorkspaceEdit applies edit to files on disk.
+// Edits to documents that are opened by DidOpenTextDocument are applied to
+// the texts that c sent to the server instead, and are sent as didChange notifications;
+// their files on disk are not changed.
+// If an edit has the version of the document, it must be same as the version
+// that c sent to the server lastly.
+//
+// Document changes are applied in order. ApplyWorkspaceEdit validates
+// all of changes before it touches any files, so it doesn't change files
+// when some of changes can't be applied.
+func (c *Client) ApplyWorkspaceEdit(edit *WorkspaceEdit) error {
+	p, err := c.PreviewWorkspaceEdit(edit)
+	if err != nil {
+		return err
+	}
+	return p.Apply()
+}
+
+// PreviewWorkspaceEdit validates edit like ApplyWorkspaceEdit, but doesn't touch any files.
+// The caller can inspect the result, then apply it with Apply.
+func (c *Client) PreviewWorkspaceEdit(edit *WorkspaceEdit) (*EditPreview, error) {
+	e := &editor{
+		c:     c,
+		files: make(map[string]*editFile),
+		docs:  make(map[DocumentURI]string),
+	}
+	if err := e.plan(edit); err != nil {
+		return nil, err
+	}
+	return &EditPreview{
+		Changes: e.changes,
+		actions: e.actions,
+	}, nil
+}
+
+// FileOp values.
+const (
+	FileOpEdit   = "edit"
+	FileOpCreate = "create"
+	FileOpRename = "rename"
+	FileOpDelete = "delete"
+)
+
+// FileChange is a change to a file that WorkspaceEdit would make.
+type FileChange struct {
+	Op      string // one of FileOp values
+	File    string
+	NewFile string // destination of rename
+	Old     string // text before edit
+	New     string // text after edit
+}
+
+// EditPreview holds changes of WorkspaceEdit that are not applied yet.
+type EditPreview struct {
+	Changes []FileChange // in the order they are applied
+
+	actions []func() error
+}
+
+// Apply applies the changes to files on disk and open documents.
+// Edited files are overwritten with the texts computed by PreviewWorkspaceEdit.
+// Apply fails if an open document is changed after PreviewWorkspaceEdit.
+func (p *EditPreview) Apply() error {
+	for _, f := range p.actions {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff returns a summary of the changes. Edits of a file are shown as a hunk
+// of the lines between the first and the last changed lines, in unified diff style.
+func (p *EditPreview) Diff() string {
+	var b strings.Builder
+	for _, c := range p.Changes {
+		switch c.Op {
+		case FileOpEdit:
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", c.File, c.File)
+			b.WriteString(lineDiff(c.Old, c.New))
+		case FileOpRename:
+			fmt.Fprintf(&b, "rename %s to %s\n", c.File, c.NewFile)
+		default:
+			fmt.Fprintf(&b, "%s %s\n", c.Op, c.File)
+		}
+	}
+	return b.String()
+}
+
+// lineDiff returns a hunk that replaces the changed lines of old with ones of new.
+func lineDiff(old, new string) string {
+	a := strings.SplitAfter(old, "\n")
+	b := strings.SplitAfter(new, "\n")
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	j := 0
+	for j < len(a)-i && j < len(b)-i && a[len(a)-1-j] == b[len(b)-1-j] {
+		j++
+	}
+	a = a[i : len(a)-j]
+	b = b[i : len(b)-j]
+	if len(a) == 0 && len(b) == 0 {
+		return ""
+	}
+	var w strings.Builder
+	fmt.Fprintf(&w, "@@ -%d,%d +%d,%d @@\n", i+1, len(a), i+1, len(b))
+	for _, s := range a {
+		w.WriteString("-" + strings.TrimSuffix(s, "\n") + "\n")
+	}
+	for _, s := range b {
+		w.WriteString("+" + strings.TrimSuffix(s, "\n") + "\n")
+	}
+	return w.String()
+}
+
+// editor simulates changes of WorkspaceEdit, then records actions to apply them.
+type editor struct {
+	c       *Client
+	files   map[string]*editFile   // simulated files
+	docs    map[DocumentURI]string // simulated texts of open documents
+	renames [][2]string            // old and new paths
+	deleted []string               // deleted directories
+	actions []func() error
+	changes []FileChange
+}
+
+type editFile struct {
+	text   string
+	loaded bool // if false, text should be read from the origin on disk.
+	exists bool
+}
+
+func (e *editor) plan(edit *WorkspaceEdit) error {
+	if edit.DocumentChanges == nil {
+		uris := make([]string, 0, len(edit.Changes))
+		for uri := range edit.Changes {
+			uris = append(uris, string(uri))
+		}
+		sort.Strings(uris)
+		for _, uri := range uris {
+			if err := e.edit(DocumentURI(uri), edit.Changes[DocumentURI(uri)]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, d := range edit.DocumentChanges {
+		var err error
+		switch {
+		case d.TextDocumentEdit != nil:
+			doc := d.TextDocumentEdit.TextDocument
+			if err := e.c.checkVersion(doc.URI, doc.Version); err != nil {
+				return err
+			}
+			err = e.edit(doc.URI, d.TextDocumentEdit.Edits)
+		case d.CreateFile != nil:
+			err = e.create(d.CreateFile)
+		case d.RenameFile != nil:
+			err = e.rename(d.RenameFile)
+		case d.DeleteFile != nil:
+			err = e.delete(d.DeleteFile)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// origin returns the path of file on disk before renames.
+func (e *editor) origin(file string) string {
+	for i := len(e.renames) - 1; i >= 0; i-- {
+		old, new := e.renames[i][0], e.renames[i][1]
+		if file == new || strings.HasPrefix(file, new+"/") {
+			file = old + file[len(new):]
+		}
+	}
+	return file
+}
+
+func (e *editor) exists(file string) bool {
+	if f, ok := e.files[file]; ok {
+		return f.exists
+	}
+	for _, dir := range e.deleted {
+		if file == dir || strings.HasPrefix(file, dir+"/") {
+			return false
+		}
+	}
+	_, err := os.Stat(e.origin(file))
+	return err == nil
+}
+
+// read returns the simulated text of file that uri points to.
+// The text of a file that is neither changed nor renamed yet is read with Content,
+// so unsaved texts that the content provider holds are edited.
+func (e *editor) read(uri DocumentURI, file string) (string, error) {
+	if f, ok := e.files[file]; ok && f.loaded {
+		return f.text, nil
+	}
+	if !e.exists(file) {
+		return "", xerrors.Errorf("%s: %w", file, os.ErrNotExist)
+	}
+	if origin := e.origin(file); origin != file {
+		b, err := ioutil.ReadFile(origin)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return e.c.Content(uri)
+}
+
+func (e *editor) edit(uri DocumentURI, edits []TextEdit) error {
+	file, err := uriToPath(uri)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.c.version(uri); ok {
+		return e.editDocument(uri, file, edits)
+	}
+	old, err := e.read(uri, file)
+	if err != nil {
+		return err
+	}
+	text, err := ApplyEdits(old, edits)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", file, err)
+	}
+	e.files[file] = &editFile{text: text, loaded: true, exists: true}
+	e.changes = append(e.changes, FileChange{Op: FileOpEdit, File: file, Old: old, New: text})
+	e.actions = append(e.actions, func() error {
+		return writeFile(file, text)
+	})
+	return nil
+}
+
+// editDocument applies edits to the open document of uri, instead of the file on disk.
+func (e *editor) editDocument(uri DocumentURI, file string, edits []TextEdit) error {
+	old, ok := e.docs[uri]
+	if !ok {
+		var err error
+		if old, err = e.c.Content(uri); err != nil {
+			return err
+		}
+	}
+	text, err := ApplyEdits(old, edits)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", file, err)
+	}
+	e.docs[uri] = text
+	e.changes = append(e.changes, FileChange{Op: FileOpEdit, File: file, Old: old, New: text})
+	e.actions = append(e.actions, func() error {
+		return e.c.changeDocument(uri, old, text)
+	})
+	return nil
+}
+
+func (e *editor) create(op *CreateFile) error {
+	file, err := uriToPath(op.URI)
+	if err != nil {
+		return err
+	}
+	var opts CreateFileOptions
+	if op.Options != nil {
+		opts = *op.Options
+	}
+	if e.exists(file) && !opts.Overwrite {
+		if opts.IgnoreIfExists {
+			return nil
+		}
+		return xerrors.Errorf("can't create %s: %w", file, os.ErrExist)
+	}
+	e.files[file] = &editFile{loaded: true, exists: true}
+	e.changes = append(e.changes, FileChange{Op: FileOpCreate, File: file})
+	e.actions = append(e.actions, func() error {
+		if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+			return err
+		}
+		return writeFile(file, "")
+	})
+	return nil
+}
+
+func (e *editor) rename(op *RenameFile) error {
+	oldFile, err := uriToPath(op.OldURI)
+	if err != nil {
+		return err
+	}
+	newFile, err := uriToPath(op.NewURI)
+	if err != nil {
+		return err
+	}
+	var opts RenameFileOptions
+	if op.Options != nil {
+		opts = *op.Options
+	}
+	if !e.exists(oldFile) {
+		return xerrors.Errorf("can't rename %s: %w", oldFile, os.ErrNotExist)
+	}
+	if e.exists(newFile) && !opts.Overwrite {
+		if opts.IgnoreIfExists {
+			return nil
+		}
+		return xerrors.Errorf("can't rename to %s: %w", newFile, os.ErrExist)
+	}
+	moved := make(map[string]*editFile)
+	for file, f := range e.files {
+		if file == oldFile || strings.HasPrefix(file, oldFile+"/") {
+			moved[newFile+file[len(oldFile):]] = f
+			e.files[file] = &editFile{}
+		}
+	}
+	for file, f := range moved {
+		e.files[file] = f
+	}
+	if _, ok := moved[newFile]; !ok {
+		e.files[newFile] = &editFile{exists: true}
+	}
+	e.files[oldFile] = &editFile{}
+	e.renames = append(e.renames, [2]string{oldFile, newFile})
+	dirs := e.deleted[:0]
+	for _, dir := range e.deleted {
+		if dir != newFile && !strings.HasPrefix(dir, newFile+"/") {
+			dirs = append(dirs, dir)
+		}
+	}
+	e.deleted = append(dirs, oldFile)
+	e.changes = append(e.changes, FileChange{Op: FileOpRename, File: oldFile, NewFile: newFile})
+	e.actions = append(e.actions, func() error {
+		if err := os.MkdirAll(filepath.Dir(newFile), 0777); err != nil {
+			return err
+		}
+		return os.Rename(oldFile, newFile)
+	})
+	return nil
+}
+
+func (e *editor) delete(op *DeleteFile) error {
+	file, err := uriToPath(op.URI)
+	if err != nil {
+		return err
+	}
+	var opts DeleteFileOptions
+	if op.Options != nil {
+		opts = *op.Options
+	}
+	if !e.exists(file) {
+		if opts.IgnoreIfNotExists {
+			return nil
+		}
+		return xerrors.Errorf("can't delete %s: %w", file, os.ErrNotExist)
+	}
+	if !opts.Recursive {
+		empty, err := e.isEmpty(file)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return xerrors.Errorf("can't delete %s: directory is not empty", file)
+		}
+	}
+	for f := range e.files {
+		if f == file || strings.HasPrefix(f, file+"/") {
+			e.files[f] = &editFile{}
+		}
+	}
+	e.files[file] = &editFile{}
+	e.deleted = append(e.deleted, file)
+	e.changes = append(e.changes, FileChange{Op: FileOpDelete, File: file})
+	e.actions = append(e.actions, func() error {
+		if opts.Recursive {
+			return os.RemoveAll(file)
+		}
+		return os.Remove(file)
+	})
+	return nil
+}
+
+// isEmpty reports whether file is either a regular file or an empty directory
+// after simulated changes.
+func (e *editor) isEmpty(file string) (bool, error) {
+	for f, ef := range e.files {
+		if ef.exists && strings.HasPrefix(f, file+"/") {
+			return false, nil
+		}
+	}
+	if f, ok := e.files[file]; ok && f.loaded {
+		return true, nil
+	}
+	fi, err := os.Stat(e.origin(file))
+	if err != nil || !fi.IsDir() {
+		return true, nil
+	}
+	names, err := readDirNames(e.origin(file))
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if e.exists(file + "/" + name) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+func (c *Client) checkVersion(uri DocumentURI, version *int) error {
+	if version == nil {
+		return nil
+	}
+	v, ok := c.version(uri)
+	if !ok {
+		return xerrors.Errorf("%s: version %d is stale; the document is not opened", uri, *version)
+	}
+	if v != *version {
+		return xerrors.Errorf("%s: version %d is mismatched with %d", uri, *version, v)
+	}
+	return nil
+}
+
+// changeDocument sends text as the new content of the open document of uri.
+// It fails if the document is changed from old.
+func (c *Client) changeDocument(uri DocumentURI, old, text string) error {
+	v, ok := c.version(uri)
+	if !ok {
+		return xerrors.Errorf("%s: document is not opened", uri)
+	}
+	if s, ok := c.text(uri); ok && s != old {
+		return xerrors.Errorf("%s: document is changed during the edit", uri)
+	}
+	v++
+	return c.DidChangeTextDocument(&DidChangeTextDocumentParams{
+		TextDocument: VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+			Version:                &v,
+		},
+		ContentChanges: []TextDocumentContentChangeEvent{
+			{Text: text},
+		},
+	})
+}
+
+// uriToPath returns the path that uri points to. The path is percent-decoded.
+func uriToPath(uri DocumentURI) (string, error) {
+	u, err := url.Parse(string(uri))
+	if err != nil {
+		return "", xerrors.Errorf("%s: %w", uri, err)
+	}
+	if u.Scheme != "file" {
+		return "", xerrors.Errorf("%s: not a file URI", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+func writeFile(file, text string) error {
+	mode := os.FileMode(0666)
+	if fi, err := os.Stat(file); err == nil {
+		mode = fi.Mode()
+	}
+	return ioutil.WriteFile(file, []byte(text), mode)
+}
@@ -0,0 +1,521 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyEdits(t *testing.T) {
+	edit := func(l0, c0, l1, c1 int, s string) TextEdit {
+		return TextEdit{
+			Range: Range{
+				Start: Position{Line: l0, Character: c0},
+				End:   Position{Line: l1, Character: c1},
+			},
+			NewText: s,
+		}
+	}
+	tests := []struct {
+		text  string
+		edits []TextEdit
+		want  string
+	}{
+		{
+			text:  "package main\n",
+			edits: []TextEdit{edit(0, 8, 0, 12, "lsp")},
+			want:  "package lsp\n",
+		},
+		{
+			text: "a\nb\nc\n",
+			edits: []TextEdit{
+				edit(2, 0, 2, 1, "C"),
+				edit(0, 0, 0, 1, "A"),
+			},
+			want: "A\nb\nC\n",
+		},
+		{
+			text: "テスト😀x\n",
+			edits: []TextEdit{
+				edit(0, 3, 0, 5, ""),
+				edit(0, 6, 0, 6, "1"),
+				edit(0, 6, 0, 6, "2"),
+			},
+			want: "テストx12\n",
+		},
+	}
+	for _, tt := range tests {
+		s, err := ApplyEdits(tt.text, tt.edits)
+		if err != nil {
+			t.Errorf("ApplyEdits(%q): %v", tt.text, err)
+			continue
+		}
+		if s != tt.want {
+			t.Errorf("ApplyEdits(%q) = %q; want %q", tt.text, s, tt.want)
+		}
+	}
+
+	_, err := ApplyEdits("abcdef", []TextEdit{
+		edit(0, 0, 0, 3, ""),
+		edit(0, 2, 0, 4, ""),
+	})
+	if err == nil {
+		t.Errorf("ApplyEdits should fail with overlapped edits")
+	}
+}
+
+func TestApplyWorkspaceEdit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a\n\nvar x int\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var c Client
+	uri := DocumentURI(fileSchema + file)
+	version := 1
+	doc := &TextDocumentEdit{
+		TextDocument: OptionalVersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+			Version:                &version,
+		},
+		Edits: []TextEdit{
+			{
+				Range: Range{
+					Start: Position{Line: 2, Character: 4},
+					End:   Position{Line: 2, Character: 5},
+				},
+				NewText: "y",
+			},
+		},
+	}
+	edit := &WorkspaceEdit{
+		DocumentChanges: []DocumentChange{{TextDocumentEdit: doc}},
+	}
+	if err := c.ApplyWorkspaceEdit(edit); err == nil {
+		t.Errorf("ApplyWorkspaceEdit should fail if the document is not opened but the version is given")
+	}
+	doc.TextDocument.Version = nil
+	if err := c.ApplyWorkspaceEdit(edit); err != nil {
+		t.Fatalf("ApplyWorkspaceEdit: %v", err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, want := string(b), "package a\n\nvar y int\n"; s != want {
+		t.Errorf("content = %q; want %q", s, want)
+	}
+}
+
+func TestClientApplyWorkspaceEditOpenDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	const onDisk = "package a\n"
+	if err := ioutil.WriteFile(file, []byte(onDisk), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	uri := DocumentURI(fileSchema + file)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.DidOpenTextDocument(&DidOpenTextDocumentParams{
+			TextDocument: TextDocumentItem{URI: uri, Version: 2, Text: "package a\n\nvar x int\n"},
+		})
+	}()
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	version := 1
+	doc := &TextDocumentEdit{
+		TextDocument: OptionalVersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+			Version:                &version,
+		},
+		Edits: []TextEdit{
+			{
+				Range: Range{
+					Start: Position{Line: 2, Character: 4},
+					End:   Position{Line: 2, Character: 5},
+				},
+				NewText: "y",
+			},
+		},
+	}
+	edit := &WorkspaceEdit{
+		DocumentChanges: []DocumentChange{{TextDocumentEdit: doc}},
+	}
+	if err := c.ApplyWorkspaceEdit(edit); err == nil {
+		t.Errorf("ApplyWorkspaceEdit should fail if versions are mismatched")
+	}
+	version = 2
+	go func() {
+		errc <- c.ApplyWorkspaceEdit(edit)
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("ApplyWorkspaceEdit: %v", err)
+	}
+	if msg.Method != "textDocument/didChange" {
+		t.Fatalf("method = %q; want textDocument/didChange", msg.Method)
+	}
+	var params DidChangeTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	const want = "package a\n\nvar y int\n"
+	if v := params.TextDocument.Version; v == nil || *v != 3 {
+		t.Errorf("version = %v; want 3", v)
+	}
+	if len(params.ContentChanges) != 1 || params.ContentChanges[0].Text != want {
+		t.Errorf("contentChanges = %+v; want full text %q", params.ContentChanges, want)
+	}
+	if text, _ := c.text(uri); text != want {
+		t.Errorf("tracked text = %q; want %q", text, want)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != onDisk {
+		t.Errorf("file of the open document is changed: %q", s)
+	}
+
+	// the edit is stale now.
+	if err := c.ApplyWorkspaceEdit(edit); err == nil {
+		t.Errorf("ApplyWorkspaceEdit should fail with a stale version")
+	}
+}
+
+func TestApplyWorkspaceEditEscapedURI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "my dir", "a.go")
+	if err := os.Mkdir(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var c Client
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(file)}
+	uri := DocumentURI(u.String())
+	if !strings.Contains(string(uri), "%20") {
+		t.Fatalf("%s should be escaped", uri)
+	}
+	edit := &WorkspaceEdit{
+		Changes: map[DocumentURI][]TextEdit{
+			uri: {
+				{
+					Range: Range{
+						Start: Position{Line: 0, Character: 8},
+						End:   Position{Line: 0, Character: 9},
+					},
+					NewText: "b",
+				},
+			},
+		},
+	}
+	if err := c.ApplyWorkspaceEdit(edit); err != nil {
+		t.Fatalf("ApplyWorkspaceEdit: %v", err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, want := string(b), "package b\n"; s != want {
+		t.Errorf("content = %q; want %q", s, want)
+	}
+}
+
+func TestApplyWorkspaceEditResourceOperations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, s string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uri := func(name string) DocumentURI {
+		return DocumentURI(fileSchema + filepath.Join(dir, name))
+	}
+	write("a.go", "package a\n")
+	write("b.go", "package b\n")
+
+	var c Client
+	edit := &WorkspaceEdit{
+		DocumentChanges: []DocumentChange{
+			{RenameFile: &RenameFile{Kind: "rename", OldURI: uri("a.go"), NewURI: uri("pkg/c.go")}},
+			{
+				TextDocumentEdit: &TextDocumentEdit{
+					TextDocument: OptionalVersionedTextDocumentIdentifier{
+						TextDocumentIdentifier: TextDocumentIdentifier{URI: uri("pkg/c.go")},
+					},
+					Edits: []TextEdit{
+						{
+							Range: Range{
+								Start: Position{Line: 0, Character: 8},
+								End:   Position{Line: 0, Character: 9},
+							},
+							NewText: "c",
+						},
+					},
+				},
+			},
+			{CreateFile: &CreateFile{Kind: "create", URI: uri("b.go"), Options: &CreateFileOptions{IgnoreIfExists: true}}},
+			{DeleteFile: &DeleteFile{Kind: "delete", URI: uri("d.go"), Options: &DeleteFileOptions{IgnoreIfNotExists: true}}},
+		},
+	}
+	if err := c.ApplyWorkspaceEdit(edit); err != nil {
+		t.Fatalf("ApplyWorkspaceEdit: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.go")); !os.IsNotExist(err) {
+		t.Errorf("a.go should be renamed: %v", err)
+	}
+	tests := map[string]string{
+		"pkg/c.go": "package c\n",
+		"b.go":     "package b\n",
+	}
+	for name, want := range tests {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if s := string(b); s != want {
+			t.Errorf("%s = %q; want %q", name, s, want)
+		}
+	}
+
+	edit = &WorkspaceEdit{
+		DocumentChanges: []DocumentChange{
+			{DeleteFile: &DeleteFile{Kind: "delete", URI: uri("b.go")}},
+			{CreateFile: &CreateFile{Kind: "create", URI: uri("pkg/c.go")}},
+		},
+	}
+	if err := c.ApplyWorkspaceEdit(edit); err == nil {
+		t.Errorf("ApplyWorkspaceEdit should fail to create existing file")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.go")); err != nil {
+		t.Errorf("b.go shouldn't be deleted when the edit fails: %v", err)
+	}
+
+	edit = &WorkspaceEdit{
+		DocumentChanges: []DocumentChange{
+			{DeleteFile: &DeleteFile{Kind: "delete", URI: uri("b.go")}},
+			{DeleteFile: &DeleteFile{Kind: "delete", URI: uri("pkg")}},
+		},
+	}
+	if err := c.ApplyWorkspaceEdit(edit); err == nil {
+		t.Errorf("ApplyWorkspaceEdit should fail to delete non-empty directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.go")); err != nil {
+		t.Errorf("b.go shouldn't be deleted when the edit fails: %v", err)
+	}
+
+	edit = &WorkspaceEdit{
+		DocumentChanges: []DocumentChange{
+			{DeleteFile: &DeleteFile{Kind: "delete", URI: uri("pkg/c.go")}},
+			{DeleteFile: &DeleteFile{Kind: "delete", URI: uri("pkg")}},
+		},
+	}
+	if err := c.ApplyWorkspaceEdit(edit); err != nil {
+		t.Errorf("ApplyWorkspaceEdit: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pkg")); !os.IsNotExist(err) {
+		t.Errorf("pkg should be deleted: %v", err)
+	}
+}
+
+func TestClientApplyEditRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a\n\nvar x int\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	uri := DocumentURI(fileSchema + file)
+	tests := []struct {
+		version string
+		applied bool
+	}{
+		{"1", false}, // the document is not opened
+		{"null", true},
+	}
+	for i, tt := range tests {
+		params := fmt.Sprintf(`{"edit":{"documentChanges":[{
+			"textDocument":{"uri":%q,"version":%s},
+			"edits":[{"range":{"start":{"line":2,"character":4},"end":{"line":2,"character":5}},"newText":"y"}]
+		}]}}`, string(uri), tt.version)
+		err := s.write(&Message{ID: i + 1, Method: "workspace/applyEdit", Params: json.RawMessage(params)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result ApplyWorkspaceEditResult
+		if err := json.Unmarshal(msg.Result, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Applied != tt.applied {
+			t.Errorf("version %s: applied = %v (%s); want %v", tt.version, result.Applied, result.FailureReason, tt.applied)
+		}
+		if !result.Applied && result.FailureReason == "" {
+			t.Errorf("version %s: failureReason is empty", tt.version)
+		}
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, want := string(b), "package a\n\nvar y int\n"; s != want {
+		t.Errorf("file = %q; want %q", s, want)
+	}
+}
+
+func TestPreviewWorkspaceEdit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	const text = "package a\n\nvar x int\n\nfunc f() {}\n"
+	if err := ioutil.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var c Client
+	uri := DocumentURI(fileSchema + file)
+	newURI := DocumentURI(fileSchema + filepath.Join(dir, "b.go"))
+	edit := &WorkspaceEdit{
+		DocumentChanges: []DocumentChange{
+			{
+				TextDocumentEdit: &TextDocumentEdit{
+					TextDocument: OptionalVersionedTextDocumentIdentifier{
+						TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+					},
+					Edits: []TextEdit{
+						{
+							Range: Range{
+								Start: Position{Line: 2, Character: 4},
+								End:   Position{Line: 2, Character: 5},
+							},
+							NewText: "y",
+						},
+					},
+				},
+			},
+			{RenameFile: &RenameFile{Kind: "rename", OldURI: uri, NewURI: newURI}},
+		},
+	}
+	p, err := c.PreviewWorkspaceEdit(edit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- " + file + "\n+++ " + file + "\n" +
+		"@@ -3,1 +3,1 @@\n-var x int\n+var y int\n" +
+		"rename " + file + " to " + filepath.Join(dir, "b.go") + "\n"
+	if s := p.Diff(); s != want {
+		t.Errorf("Diff = %q; want %q", s, want)
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != text {
+		t.Errorf("preview changed %s: %q, %v", file, b, err)
+	}
+	if err := p.Apply(); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "b.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, want := string(b), strings.Replace(text, "x", "y", 1); s != want {
+		t.Errorf("b.go = %q; want %q", s, want)
+	}
+}
+
+func TestClientConfirmApplyEdit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	const text = "package a\n"
+	if err := ioutil.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := make(chan string, 1)
+	c, s := newPipeClient(t, ConfirmApplyEdit(func(label string, p *EditPreview) bool {
+		labels <- label
+		return false
+	}))
+	defer c.Close()
+	defer s.Close()
+
+	params := fmt.Sprintf(`{"label":"rename","edit":{"changes":{%q:[
+		{"range":{"start":{"line":0,"character":8},"end":{"line":0,"character":9}},"newText":"b"}
+	]}}}`, fileSchema+file)
+	if err := s.write(&Message{ID: 1, Method: "workspace/applyEdit", Params: json.RawMessage(params)}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result ApplyWorkspaceEditResult
+	if err := json.Unmarshal(msg.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied {
+		t.Errorf("rejected edit is applied")
+	}
+	if label := <-labels; label != "rename" {
+		t.Errorf("label = %q; want rename", label)
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != text {
+		t.Errorf("rejected edit changed %s: %q, %v", file, b, err)
+	}
+}
@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"os"
+	"strconv"
+)
+
+// FormattingOptions represents the interface described in the specification.
+type FormattingOptions struct {
+	TabSize                int  `json:"tabSize"`
+	InsertSpaces           bool `json:"insertSpaces"`
+	TrimTrailingWhitespace bool `json:"trimTrailingWhitespace,omitempty"`
+	InsertFinalNewline     bool `json:"insertFinalNewline,omitempty"`
+	TrimFinalNewlines      bool `json:"trimFinalNewlines,omitempty"`
+}
+
+// DefaultFormattingOptions returns options that match settings of acme.
+// TabSize is taken from $tabstop; it is 4 if $tabstop is not a positive number.
+func DefaultFormattingOptions() FormattingOptions {
+	tabSize := 4
+	if n, err := strconv.Atoi(os.Getenv("tabstop")); err == nil && n > 0 {
+		tabSize = n
+	}
+	return FormattingOptions{
+		TabSize:      tabSize,
+		InsertSpaces: false,
+	}
+}
+
+// FormattingOverrides represents user settings that override FormattingOptions.
+// Nil fields are left as is.
+type FormattingOverrides struct {
+	TabSize                *int
+	InsertSpaces           *bool
+	TrimTrailingWhitespace *bool
+	InsertFinalNewline     *bool
+	TrimFinalNewlines      *bool
+}
+
+// Merge returns a copy of o that v is applied to.
+func (o FormattingOptions) Merge(v *FormattingOverrides) FormattingOptions {
+	if v == nil {
+		return o
+	}
+	if v.TabSize != nil {
+		o.TabSize = *v.TabSize
+	}
+	if v.InsertSpaces != nil {
+		o.InsertSpaces = *v.InsertSpaces
+	}
+	if v.TrimTrailingWhitespace != nil {
+		o.TrimTrailingWhitespace = *v.TrimTrailingWhitespace
+	}
+	if v.InsertFinalNewline != nil {
+		o.InsertFinalNewline = *v.InsertFinalNewline
+	}
+	if v.TrimFinalNewlines != nil {
+		o.TrimFinalNewlines = *v.TrimFinalNewlines
+	}
+	return o
+}
+
+// DocumentFormattingParams represents the interface described in the specification.
+type DocumentFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Options      FormattingOptions      `json:"options"`
+}
+
+// Formatting sends the document formatting request to the server.
+func (c *Client) Formatting(params *DocumentFormattingParams) *TextEditsResult {
+	const method = "textDocument/formatting"
+	var result TextEditsResult
+	result.c = c
+	if !c.cap.DocumentFormattingProvider {
+		result.call = c.unsupported(method, params, &result.TextEdits)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.TextEdits)
+	return &result
+}
+
+// DocumentRangeFormattingParams represents the interface described in the specification.
+type DocumentRangeFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+	Options      FormattingOptions      `json:"options"`
+}
+
+// RangeFormatting sends the document range formatting request to the server.
+// The result edits only touch the text within params.Range.
+func (c *Client) RangeFormatting(params *DocumentRangeFormattingParams) *TextEditsResult {
+	const method = "textDocument/rangeFormatting"
+	var result TextEditsResult
+	result.c = c
+	if !c.cap.DocumentRangeFormattingProvider {
+		result.call = c.unsupported(method, params, &result.TextEdits)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.TextEdits)
+	return &result
+}
+
+// DocumentOnTypeFormattingOptions represents the interface described in the specification.
+type DocumentOnTypeFormattingOptions struct {
+	FirstTriggerCharacter string   `json:"firstTriggerCharacter"`
+	MoreTriggerCharacter  []string `json:"moreTriggerCharacter,omitempty"`
+}
+
+// OnTypeFormattingTriggerCharacters returns characters that should trigger OnTypeFormatting.
+// It returns nil if the server doesn't support the feature.
+func (c *Client) OnTypeFormattingTriggerCharacters() []string {
+	opts := c.cap.DocumentOnTypeFormattingProvider
+	if opts == nil {
+		return nil
+	}
+	a := []string{opts.FirstTriggerCharacter}
+	return append(a, opts.MoreTriggerCharacter...)
+}
+
+// DocumentOnTypeFormattingParams represents the interface described in the specification.
+type DocumentOnTypeFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+	Ch           string                 `json:"ch"`
+	Options      FormattingOptions      `json:"options"`
+}
+
+// OnTypeFormatting sends the document on type formatting request to the server.
+// The result edits should be applied at the position the character was typed.
+func (c *Client) OnTypeFormatting(params *DocumentOnTypeFormattingParams) *TextEditsResult {
+	const method = "textDocument/onTypeFormatting"
+	var result TextEditsResult
+	result.c = c
+	if c.cap.DocumentOnTypeFormattingProvider == nil {
+		result.call = c.unsupported(method, params, &result.TextEdits)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.TextEdits)
+	return &result
+}
@@ -0,0 +1,70 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultFormattingOptions(t *testing.T) {
+	tests := []struct {
+		tabstop string
+		want    int
+	}{
+		{"", 4},
+		{"8", 8},
+		{"0", 4},
+		{"x", 4},
+	}
+	for _, tt := range tests {
+		t.Setenv("tabstop", tt.tabstop)
+		o := DefaultFormattingOptions()
+		if o.TabSize != tt.want || o.InsertSpaces {
+			t.Errorf("DefaultFormattingOptions() with $tabstop=%q = %+v; want TabSize=%d with tabs", tt.tabstop, o, tt.want)
+		}
+	}
+}
+
+func TestFormattingOptionsMerge(t *testing.T) {
+	o := FormattingOptions{TabSize: 4, TrimTrailingWhitespace: true}
+	tabSize := 2
+	yes, no := true, false
+	v := o.Merge(&FormattingOverrides{
+		TabSize:                &tabSize,
+		InsertSpaces:           &yes,
+		TrimTrailingWhitespace: &no,
+	})
+	want := FormattingOptions{TabSize: 2, InsertSpaces: true}
+	if v != want {
+		t.Errorf("Merge = %+v; want %+v", v, want)
+	}
+	if o.TabSize != 4 || !o.TrimTrailingWhitespace {
+		t.Errorf("Merge modified the receiver: %+v", o)
+	}
+	if v := o.Merge(nil); v != o {
+		t.Errorf("Merge(nil) = %+v; want %+v", v, o)
+	}
+}
+
+func TestOnTypeFormattingTriggerCharacters(t *testing.T) {
+	tests := []struct {
+		cap  string
+		want []string
+	}{
+		{`{}`, nil},
+		{`{"documentOnTypeFormattingProvider":{"firstTriggerCharacter":"}"}}`, []string{"}"}},
+		{
+			`{"documentOnTypeFormattingProvider":{"firstTriggerCharacter":"}","moreTriggerCharacter":[";","\n"]}}`,
+			[]string{"}", ";", "\n"},
+		},
+	}
+	for _, tt := range tests {
+		var c Client
+		if err := json.Unmarshal([]byte(tt.cap), &c.cap); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tt.cap, err)
+		}
+		if a := c.OnTypeFormattingTriggerCharacters(); !reflect.DeepEqual(a, tt.want) {
+			t.Errorf("OnTypeFormattingTriggerCharacters() with %s = %q; want %q", tt.cap, a, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package lsp
+
+// GoplsSettings represents commonly used settings of gopls.
+// It is sent as InitializationOptions of initialize.
+// See https://github.com/golang/tools/blob/master/gopls/doc/settings.md for details.
+type GoplsSettings struct {
+	// Build
+	BuildFlags       []string          `json:"buildFlags,omitempty"`
+	Env              map[string]string `json:"env,omitempty"`
+	DirectoryFilters []string          `json:"directoryFilters,omitempty"`
+
+	// Formatting
+	Local   string `json:"local,omitempty"`
+	Gofumpt bool   `json:"gofumpt,omitempty"`
+
+	// Completion
+	UsePlaceholders    bool  `json:"usePlaceholders,omitempty"`
+	CompleteUnimported *bool `json:"completeUnimported,omitempty"`
+
+	// Diagnostics
+	Analyses    map[string]bool `json:"analyses,omitempty"`
+	Staticcheck bool            `json:"staticcheck,omitempty"`
+
+	// Documentation
+	HoverKind    string `json:"hoverKind,omitempty"` // FullDocumentation, NoDocumentation, SingleLine, Structured or SynopsisDocumentation
+	LinksInHover *bool  `json:"linksInHover,omitempty"`
+
+	Codelenses     map[string]bool `json:"codelenses,omitempty"`
+	Hints          map[string]bool `json:"hints,omitempty"`
+	SemanticTokens bool            `json:"semanticTokens,omitempty"`
+}
@@ -0,0 +1,38 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClientInitializationOptions(t *testing.T) {
+	c, s := newPipeClient(t, ManualInitialized())
+	defer c.Close()
+	defer s.Close()
+
+	off := false
+	c.Initialize(&InitializeParams{
+		RootURI: "file:///home/me/a",
+		InitializationOptions: &GoplsSettings{
+			BuildFlags:   []string{"-tags=integration"},
+			Analyses:     map[string]bool{"unusedparams": true},
+			Staticcheck:  true,
+			HoverKind:    "SynopsisDocumentation",
+			LinksInHover: &off,
+		},
+	})
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params struct {
+		InitializationOptions json.RawMessage `json:"initializationOptions"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"buildFlags":["-tags=integration"],"analyses":{"unusedparams":true},"staticcheck":true,"hoverKind":"SynopsisDocumentation","linksInHover":false}`
+	if s := string(params.InitializationOptions); s != want {
+		t.Errorf("initializationOptions = %s; want %s", s, want)
+	}
+}
@@ -0,0 +1,207 @@
+package lsp
+
+import "encoding/json"
+
+// SymbolTag values.
+const (
+	SymbolTagDeprecated = 1
+)
+
+// CallHierarchyItem represents the interface described in the specification.
+type CallHierarchyItem struct {
+	Name           string          `json:"name"`
+	Kind           int             `json:"kind"`
+	Tags           []int           `json:"tags,omitempty"`
+	Detail         string          `json:"detail,omitempty"`
+	URI            DocumentURI     `json:"uri"`
+	Range          Range           `json:"range"`
+	SelectionRange Range           `json:"selectionRange"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// CallHierarchyItemsResult represents a result object for methods returning an array of CallHierarchyItem.
+type CallHierarchyItemsResult struct {
+	Items []CallHierarchyItem
+
+	c    *Client
+	call *Call
+}
+
+// PrepareCallHierarchy sends the prepare call hierarchy request to the server.
+func (c *Client) PrepareCallHierarchy(params *TextDocumentPositionParams) *CallHierarchyItemsResult {
+	const method = "textDocument/prepareCallHierarchy"
+	var result CallHierarchyItemsResult
+	result.c = c
+	if !c.cap.CallHierarchyProvider {
+		result.call = c.unsupported(method, params, &result.Items)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Items)
+	return &result
+}
+
+// Wait waits for a response of prepare call hierarchy request.
+// Items will be empty if there is nothing at the position.
+func (r *CallHierarchyItemsResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Items == nil {
+		r.Items = []CallHierarchyItem{}
+	}
+	return nil
+}
+
+// CallHierarchyIncomingCallsParams represents the interface described in the specification.
+type CallHierarchyIncomingCallsParams struct {
+	Item CallHierarchyItem `json:"item"`
+}
+
+// CallHierarchyIncomingCall represents the interface described in the specification.
+type CallHierarchyIncomingCall struct {
+	From       CallHierarchyItem `json:"from"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+// CallHierarchyIncomingCallsResult represents a result object for incoming calls request.
+type CallHierarchyIncomingCallsResult struct {
+	Calls []CallHierarchyIncomingCall
+
+	c    *Client
+	call *Call
+}
+
+// IncomingCalls sends the incoming calls request to the server.
+func (c *Client) IncomingCalls(params *CallHierarchyIncomingCallsParams) *CallHierarchyIncomingCallsResult {
+	const method = "callHierarchy/incomingCalls"
+	var result CallHierarchyIncomingCallsResult
+	result.c = c
+	if !c.cap.CallHierarchyProvider {
+		result.call = c.unsupported(method, params, &result.Calls)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Calls)
+	return &result
+}
+
+// Wait waits for a response of incoming calls request.
+func (r *CallHierarchyIncomingCallsResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Calls == nil {
+		r.Calls = []CallHierarchyIncomingCall{}
+	}
+	return nil
+}
+
+// CallHierarchyOutgoingCallsParams represents the interface described in the specification.
+type CallHierarchyOutgoingCallsParams struct {
+	Item CallHierarchyItem `json:"item"`
+}
+
+// CallHierarchyOutgoingCall represents the interface described in the specification.
+type CallHierarchyOutgoingCall struct {
+	To         CallHierarchyItem `json:"to"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+// CallHierarchyOutgoingCallsResult represents a result object for outgoing calls request.
+type CallHierarchyOutgoingCallsResult struct {
+	Calls []CallHierarchyOutgoingCall
+
+	c    *Client
+	call *Call
+}
+
+// OutgoingCalls sends the outgoing calls request to the server.
+func (c *Client) OutgoingCalls(params *CallHierarchyOutgoingCallsParams) *CallHierarchyOutgoingCallsResult {
+	const method = "callHierarchy/outgoingCalls"
+	var result CallHierarchyOutgoingCallsResult
+	result.c = c
+	if !c.cap.CallHierarchyProvider {
+		result.call = c.unsupported(method, params, &result.Calls)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Calls)
+	return &result
+}
+
+// Wait waits for a response of outgoing calls request.
+func (r *CallHierarchyOutgoingCallsResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Calls == nil {
+		r.Calls = []CallHierarchyOutgoingCall{}
+	}
+	return nil
+}
+
+// TypeHierarchyItem represents the interface described in the specification.
+type TypeHierarchyItem struct {
+	Name           string          `json:"name"`
+	Kind           int             `json:"kind"`
+	Tags           []int           `json:"tags,omitempty"`
+	Detail         string          `json:"detail,omitempty"`
+	URI            DocumentURI     `json:"uri"`
+	Range          Range           `json:"range"`
+	SelectionRange Range           `json:"selectionRange"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// TypeHierarchyItemsResult represents a result object for methods returning an array of TypeHierarchyItem.
+type TypeHierarchyItemsResult struct {
+	Items []TypeHierarchyItem
+
+	c    *Client
+	call *Call
+}
+
+// PrepareTypeHierarchy sends the prepare type hierarchy request to the server.
+func (c *Client) PrepareTypeHierarchy(params *TextDocumentPositionParams) *TypeHierarchyItemsResult {
+	return c.callTypeHierarchy("textDocument/prepareTypeHierarchy", params)
+}
+
+// TypeHierarchySupertypesParams represents the interface described in the specification.
+type TypeHierarchySupertypesParams struct {
+	Item TypeHierarchyItem `json:"item"`
+}
+
+// Supertypes sends the type hierarchy supertypes request to the server.
+func (c *Client) Supertypes(params *TypeHierarchySupertypesParams) *TypeHierarchyItemsResult {
+	return c.callTypeHierarchy("typeHierarchy/supertypes", params)
+}
+
+// TypeHierarchySubtypesParams represents the interface described in the specification.
+type TypeHierarchySubtypesParams struct {
+	Item TypeHierarchyItem `json:"item"`
+}
+
+// Subtypes sends the type hierarchy subtypes request to the server.
+func (c *Client) Subtypes(params *TypeHierarchySubtypesParams) *TypeHierarchyItemsResult {
+	return c.callTypeHierarchy("typeHierarchy/subtypes", params)
+}
+
+func (c *Client) callTypeHierarchy(method string, params interface{}) *TypeHierarchyItemsResult {
+	var result TypeHierarchyItemsResult
+	result.c = c
+	if !c.cap.TypeHierarchyProvider {
+		result.call = c.unsupported(method, params, &result.Items)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Items)
+	return &result
+}
+
+// Wait waits for a response of type hierarchy requests.
+// Items will be empty if the server responds null.
+func (r *TypeHierarchyItemsResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Items == nil {
+		r.Items = []TypeHierarchyItem{}
+	}
+	return nil
+}
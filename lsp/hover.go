@@ -0,0 +1,193 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Hover represents the interface described in the specification.
+type Hover struct {
+	// Contents is converted to markdown if the server sends MarkedString or MarkedString[].
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// markedString represents MarkedString described in the specification.
+type markedString struct {
+	Language string `json:"language"`
+	Value    string `json:"value"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (s *markedString) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err == nil {
+		*s = markedString{Value: v}
+		return nil
+	}
+	type marked markedString
+	return json.Unmarshal(b, (*marked)(s))
+}
+
+func (s markedString) markdown() string {
+	if s.Language == "" {
+		return s.Value
+	}
+	return "```" + s.Language + "\n" + s.Value + "\n```"
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// Contents of the deprecated MarkedString and MarkedString[] are converted to markdown.
+func (h *Hover) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Contents json.RawMessage `json:"contents"`
+		Range    *Range          `json:"range,omitempty"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*h = Hover{Range: v.Range}
+	c := bytes.TrimSpace(v.Contents)
+	switch {
+	case len(c) == 0 || bytes.Equal(c, []byte("null")):
+		return nil
+	case c[0] == '[':
+		var a []markedString
+		if err := json.Unmarshal(c, &a); err != nil {
+			return err
+		}
+		s := make([]string, len(a))
+		for i, m := range a {
+			s[i] = m.markdown()
+		}
+		h.Contents = MarkupContent{Kind: MarkupKindMarkdown, Value: strings.Join(s, "\n\n")}
+		return nil
+	case c[0] == '{':
+		var m struct {
+			Kind     *string `json:"kind"`
+			Language string  `json:"language"`
+			Value    string  `json:"value"`
+		}
+		if err := json.Unmarshal(c, &m); err != nil {
+			return err
+		}
+		if m.Kind != nil {
+			h.Contents = MarkupContent{Kind: *m.Kind, Value: m.Value}
+			return nil
+		}
+		s := markedString{Language: m.Language, Value: m.Value}
+		h.Contents = MarkupContent{Kind: MarkupKindMarkdown, Value: s.markdown()}
+		return nil
+	}
+	var s markedString
+	if err := json.Unmarshal(c, &s); err != nil {
+		return err
+	}
+	h.Contents = MarkupContent{Kind: MarkupKindMarkdown, Value: s.markdown()}
+	return nil
+}
+
+// HoverResult represents a result object for hover request.
+type HoverResult struct {
+	Hover *Hover // nil if the server has nothing to show
+
+	c    *Client
+	call *Call
+}
+
+// Hover sends the hover request to the server.
+func (c *Client) Hover(params *TextDocumentPositionParams) *HoverResult {
+	const method = "textDocument/hover"
+	var result HoverResult
+	result.c = c
+	if !c.Supports(method) {
+		result.call = c.unsupported(method, params, &result.Hover)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Hover)
+	return &result
+}
+
+// Wait waits for a response of hover request.
+func (r *HoverResult) Wait() error {
+	return r.c.Wait(r.call)
+}
+
+var (
+	markdownHeader   = regexp.MustCompile(`^ {0,3}#{1,6}(\s+|$)`)
+	markdownLink     = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]*)[^)]*\)`)
+	markdownEmphasis = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__|\*(\S(?:.*?\S)?)\*`)
+	markdownCode     = regexp.MustCompile("`+([^`]*)`+")
+	markdownEscape   = regexp.MustCompile("\\\\([!-/:-@\\[-`{-~])")
+)
+
+// RenderHover returns the contents of h as plain text for acme.
+// Markdown is converted to readable text: headers, emphasis and backticks are stripped,
+// links are written as "text (url)", and code blocks are kept with their indentation.
+// If h is nil, RenderHover returns an empty string.
+func RenderHover(h *Hover) string {
+	if h == nil {
+		return ""
+	}
+	if h.Contents.Kind != MarkupKindMarkdown {
+		return h.Contents.Value
+	}
+	var (
+		b     strings.Builder
+		fence string // the fence of the current code block
+	)
+	lines := strings.Split(strings.ReplaceAll(h.Contents.Value, "\r\n", "\n"), "\n")
+	for _, s := range lines {
+		t := strings.TrimSpace(s)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+				fence = ""
+				continue
+			}
+			b.WriteString(s)
+		case strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~"):
+			fence = t[:3]
+			continue
+		case strings.HasPrefix(s, "    ") || strings.HasPrefix(s, "\t"):
+			b.WriteString(s) // indented code block
+		default:
+			s = markdownHeader.ReplaceAllString(s, "")
+			b.WriteString(renderInline(s))
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// renderInline strips inline markups of markdown from s.
+// Code spans are kept as is except their backticks.
+func renderInline(s string) string {
+	s = markdownLink.ReplaceAllStringFunc(s, func(m string) string {
+		a := markdownLink.FindStringSubmatch(m)
+		text := renderInline(a[1])
+		if a[2] == "" || a[2] == text {
+			return text
+		}
+		return text + " (" + a[2] + ")"
+	})
+	var b strings.Builder
+	for {
+		loc := markdownCode.FindStringSubmatchIndex(s)
+		if loc == nil {
+			b.WriteString(renderText(s))
+			return b.String()
+		}
+		b.WriteString(renderText(s[:loc[0]]))
+		b.WriteString(s[loc[2]:loc[3]])
+		s = s[loc[1]:]
+	}
+}
+
+// renderText strips emphasis and backslash escapes from s.
+func renderText(s string) string {
+	s = markdownEmphasis.ReplaceAllString(s, "${1}${2}${3}")
+	return markdownEscape.ReplaceAllString(s, "$1")
+}
@@ -0,0 +1,108 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHoverUnmarshal(t *testing.T) {
+	tests := []struct {
+		s    string
+		want MarkupContent
+	}{
+		{`{"contents":{"kind":"markdown","value":"**x**"}}`, MarkupContent{Kind: MarkupKindMarkdown, Value: "**x**"}},
+		{`{"contents":"*x*"}`, MarkupContent{Kind: MarkupKindMarkdown, Value: "*x*"}},
+		{`{"contents":{"language":"go","value":"var x int"}}`, MarkupContent{Kind: MarkupKindMarkdown, Value: "```go\nvar x int\n```"}},
+		{
+			`{"contents":[{"language":"go","value":"var x int"},"doc"]}`,
+			MarkupContent{Kind: MarkupKindMarkdown, Value: "```go\nvar x int\n```\n\ndoc"},
+		},
+	}
+	for _, tt := range tests {
+		var h Hover
+		if err := json.Unmarshal([]byte(tt.s), &h); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.s, err)
+			continue
+		}
+		if h.Contents != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v; want %+v", tt.s, h.Contents, tt.want)
+		}
+	}
+}
+
+func TestRenderHover(t *testing.T) {
+	const doc = "```go\n" +
+		"func fmt.Println(a ...any) (n int, err error)\n" +
+		"```\n" +
+		"\n" +
+		"---\n" +
+		"\n" +
+		"## Println\n" +
+		"\n" +
+		"Println formats using the **default** formats for its operands and writes to *standard output*\\.\n" +
+		"It calls `fmt.Fprintln` with `os.Stdout`, see [`fmt.Println` on pkg.go.dev](https://pkg.go.dev/fmt#Println).\n" +
+		"\n" +
+		"    if err != nil {\n" +
+		"    \treturn err\n" +
+		"    }\n" +
+		"\n" +
+		"The snake_case \\_x\\_ and a * b stay."
+	const want = "func fmt.Println(a ...any) (n int, err error)\n" +
+		"\n" +
+		"---\n" +
+		"\n" +
+		"Println\n" +
+		"\n" +
+		"Println formats using the default formats for its operands and writes to standard output.\n" +
+		"It calls fmt.Fprintln with os.Stdout, see fmt.Println on pkg.go.dev (https://pkg.go.dev/fmt#Println).\n" +
+		"\n" +
+		"    if err != nil {\n" +
+		"    \treturn err\n" +
+		"    }\n" +
+		"\n" +
+		"The snake_case _x_ and a * b stay."
+	h := &Hover{Contents: MarkupContent{Kind: MarkupKindMarkdown, Value: doc}}
+	if s := RenderHover(h); s != want {
+		t.Errorf("RenderHover = %q; want %q", s, want)
+	}
+
+	plain := &Hover{Contents: MarkupContent{Kind: MarkupKindPlainText, Value: "**as is**"}}
+	if s := RenderHover(plain); s != "**as is**" {
+		t.Errorf("RenderHover(plaintext) = %q; want %q", s, "**as is**")
+	}
+	if s := RenderHover(nil); s != "" {
+		t.Errorf("RenderHover(nil) = %q; want empty", s)
+	}
+}
+
+func TestClientHover(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	if err := c.Hover(&TextDocumentPositionParams{}).Wait(); err == nil {
+		t.Errorf("Hover without hoverProvider: succeeded")
+	}
+	c.cap.HoverProvider = true
+	r := c.Hover(&TextDocumentPositionParams{})
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "textDocument/hover" {
+		t.Errorf("method = %q; want textDocument/hover", msg.Method)
+	}
+	result := `{"contents":{"kind":"markdown","value":"` + "`x`" + `"},"range":{"start":{"line":1,"character":2},"end":{"line":1,"character":3}}}`
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(result)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Hover == nil || r.Hover.Range == nil || r.Hover.Range.Start.Line != 1 {
+		t.Fatalf("Hover = %+v; want the range", r.Hover)
+	}
+	if s := RenderHover(r.Hover); s != "x" {
+		t.Errorf("RenderHover = %q; want x", s)
+	}
+}
@@ -0,0 +1,126 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// InlayHintKind values.
+const (
+	InlayHintKindType      = 1
+	InlayHintKindParameter = 2
+)
+
+// InlayHintParams represents the interface described in the specification.
+type InlayHintParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+}
+
+// InlayHint represents the interface described in the specification.
+type InlayHint struct {
+	Position     Position        `json:"position"`
+	Label        InlayHintLabel  `json:"label"`
+	Kind         int             `json:"kind,omitempty"`
+	TextEdits    []TextEdit      `json:"textEdits,omitempty"`
+	Tooltip      *MarkupContent  `json:"tooltip,omitempty"`
+	PaddingLeft  bool            `json:"paddingLeft,omitempty"`
+	PaddingRight bool            `json:"paddingRight,omitempty"`
+	Data         json.RawMessage `json:"data,omitempty"`
+}
+
+// InlayHintLabel represents the label of InlayHint.
+// The server may send it either string or InlayHintLabelPart[];
+// a string is decoded as a single part.
+type InlayHintLabel []InlayHintLabelPart
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (l *InlayHintLabel) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = InlayHintLabel{{Value: s}}
+		return nil
+	}
+	var parts []InlayHintLabelPart
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return err
+	}
+	*l = parts
+	return nil
+}
+
+// String returns concatenated values of l.
+func (l InlayHintLabel) String() string {
+	var b strings.Builder
+	for _, p := range l {
+		b.WriteString(p.Value)
+	}
+	return b.String()
+}
+
+// InlayHintLabelPart represents the interface described in the specification.
+type InlayHintLabelPart struct {
+	Value    string         `json:"value"`
+	Tooltip  *MarkupContent `json:"tooltip,omitempty"`
+	Location *Location      `json:"location,omitempty"`
+	Command  *Command       `json:"command,omitempty"`
+}
+
+// InlayHintsResult represents a result object for inlay hint request.
+type InlayHintsResult struct {
+	Hints []InlayHint
+
+	c    *Client
+	call *Call
+}
+
+// InlayHint sends the inlay hint request to the server.
+func (c *Client) InlayHint(params *InlayHintParams) *InlayHintsResult {
+	const method = "textDocument/inlayHint"
+	var result InlayHintsResult
+	result.c = c
+	if !c.cap.InlayHintProvider.Provider {
+		result.call = c.unsupported(method, params, &result.Hints)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Hints)
+	return &result
+}
+
+// Wait waits for a response of inlay hint request.
+func (r *InlayHintsResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Hints == nil {
+		r.Hints = []InlayHint{}
+	}
+	return nil
+}
+
+// InlayHintResult represents a result object for inlay hint resolve request.
+type InlayHintResult struct {
+	Hint InlayHint
+
+	c    *Client
+	call *Call
+}
+
+// ResolveInlayHint sends the inlay hint resolve request to the server.
+// It fills properties such as Tooltip of hint lazily.
+func (c *Client) ResolveInlayHint(hint *InlayHint) *InlayHintResult {
+	const method = "inlayHint/resolve"
+	var result InlayHintResult
+	result.c = c
+	if !c.cap.InlayHintProvider.ResolveProvider {
+		result.call = c.unsupported(method, hint, &result.Hint)
+		return &result
+	}
+	result.call = c.Call(method, hint, &result.Hint)
+	return &result
+}
+
+// Wait waits for a response of inlay hint resolve request.
+func (r *InlayHintResult) Wait() error {
+	return r.c.Wait(r.call)
+}
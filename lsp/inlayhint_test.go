@@ -0,0 +1,30 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInlayHintLabel(t *testing.T) {
+	tests := []struct {
+		body  string
+		parts int
+		want  string
+	}{
+		{body: `"int"`, parts: 1, want: "int"},
+		{body: `[{"value":"map[string]"},{"value":"int"}]`, parts: 2, want: "map[string]int"},
+		{body: `[]`, parts: 0, want: ""},
+	}
+	for _, tt := range tests {
+		var l InlayHintLabel
+		if err := json.Unmarshal([]byte(tt.body), &l); err != nil {
+			t.Fatalf("can't unmarshal: '%v': %v", tt.body, err)
+		}
+		if n := len(l); n != tt.parts {
+			t.Errorf("Unmarshal('%v'): len = %d; want %d", tt.body, n, tt.parts)
+		}
+		if s := l.String(); s != tt.want {
+			t.Errorf("Unmarshal('%v').String() = %q; want %q", tt.body, s, tt.want)
+		}
+	}
+}
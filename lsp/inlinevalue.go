@@ -0,0 +1,102 @@
+package lsp
+
+import "encoding/json"
+
+// InlineValueParams represents the interface described in the specification.
+type InlineValueParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+	Context      InlineValueContext     `json:"context"`
+}
+
+// InlineValueContext represents the interface described in the specification.
+type InlineValueContext struct {
+	FrameID         int   `json:"frameId"`
+	StoppedLocation Range `json:"stoppedLocation"`
+}
+
+// InlineValue kinds. The specification defines InlineValue as a union of three interfaces;
+// Kind of InlineValue reports which one the server sent.
+const (
+	InlineValueKindText                  = 1 // InlineValueText
+	InlineValueKindVariableLookup        = 2 // InlineValueVariableLookup
+	InlineValueKindEvaluatableExpression = 3 // InlineValueEvaluatableExpression
+)
+
+// InlineValue represents the union of InlineValueText, InlineValueVariableLookup
+// and InlineValueEvaluatableExpression described in the specification.
+type InlineValue struct {
+	Kind  int
+	Range Range
+
+	Text                string // InlineValueKindText
+	VariableName        string // InlineValueKindVariableLookup
+	CaseSensitiveLookup bool   // InlineValueKindVariableLookup
+	Expression          string // InlineValueKindEvaluatableExpression
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (v *InlineValue) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	var w struct {
+		Range               Range  `json:"range"`
+		Text                string `json:"text"`
+		VariableName        string `json:"variableName"`
+		CaseSensitiveLookup bool   `json:"caseSensitiveLookup"`
+		Expression          string `json:"expression"`
+	}
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
+	}
+	*v = InlineValue{
+		Range:               w.Range,
+		Text:                w.Text,
+		VariableName:        w.VariableName,
+		CaseSensitiveLookup: w.CaseSensitiveLookup,
+		Expression:          w.Expression,
+	}
+	switch {
+	case m["text"] != nil:
+		v.Kind = InlineValueKindText
+	case m["caseSensitiveLookup"] != nil || m["variableName"] != nil:
+		v.Kind = InlineValueKindVariableLookup
+	default:
+		v.Kind = InlineValueKindEvaluatableExpression
+	}
+	return nil
+}
+
+// InlineValuesResult represents a result object for inline value request.
+type InlineValuesResult struct {
+	Values []InlineValue
+
+	c    *Client
+	call *Call
+}
+
+// InlineValue sends the inline value request to the server.
+func (c *Client) InlineValue(params *InlineValueParams) *InlineValuesResult {
+	const method = "textDocument/inlineValue"
+	var result InlineValuesResult
+	result.c = c
+	if !c.cap.InlineValueProvider {
+		result.call = c.unsupported(method, params, &result.Values)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Values)
+	return &result
+}
+
+// Wait waits for a response of inline value request.
+func (r *InlineValuesResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Values == nil {
+		r.Values = []InlineValue{}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInlineValue(t *testing.T) {
+	r := Range{
+		Start: Position{Line: 1, Character: 2},
+		End:   Position{Line: 1, Character: 3},
+	}
+	const rs = `"range":{"start":{"line":1,"character":2},"end":{"line":1,"character":3}}`
+	tests := []struct {
+		s    string
+		want InlineValue
+	}{
+		{
+			s:    `{` + rs + `,"text":"x = 1"}`,
+			want: InlineValue{Kind: InlineValueKindText, Range: r, Text: "x = 1"},
+		},
+		{
+			s:    `{` + rs + `,"text":""}`,
+			want: InlineValue{Kind: InlineValueKindText, Range: r},
+		},
+		{
+			s:    `{` + rs + `,"variableName":"x","caseSensitiveLookup":true}`,
+			want: InlineValue{Kind: InlineValueKindVariableLookup, Range: r, VariableName: "x", CaseSensitiveLookup: true},
+		},
+		{
+			s:    `{` + rs + `,"caseSensitiveLookup":false}`,
+			want: InlineValue{Kind: InlineValueKindVariableLookup, Range: r},
+		},
+		{
+			s:    `{` + rs + `,"expression":"a[i]"}`,
+			want: InlineValue{Kind: InlineValueKindEvaluatableExpression, Range: r, Expression: "a[i]"},
+		},
+		{
+			s:    `{` + rs + `}`,
+			want: InlineValue{Kind: InlineValueKindEvaluatableExpression, Range: r},
+		},
+	}
+	for _, tt := range tests {
+		var v InlineValue
+		if err := json.Unmarshal([]byte(tt.s), &v); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.s, err)
+			continue
+		}
+		if v != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v; want %+v", tt.s, v, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package lsp
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// LanguageIDs maps file extensions to language identifiers described in the specification.
+// Users can add or replace entries before opening documents;
+// it must not be modified concurrently with LanguageIDForPath.
+var LanguageIDs = map[string]string{
+	".bat":   "bat",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cxx":   "cpp",
+	".hh":    "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".css":   "css",
+	".dart":  "dart",
+	".diff":  "diff",
+	".patch": "diff",
+	".erl":   "erlang",
+	".ex":    "elixir",
+	".exs":   "elixir",
+	".go":    "go",
+	".hs":    "haskell",
+	".html":  "html",
+	".htm":   "html",
+	".java":  "java",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".jsx":   "javascriptreact",
+	".json":  "json",
+	".lua":   "lua",
+	".md":    "markdown",
+	".ml":    "ocaml",
+	".mli":   "ocaml",
+	".php":   "php",
+	".pl":    "perl",
+	".py":    "python",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".scala": "scala",
+	".sh":    "shellscript",
+	".bash":  "shellscript",
+	".sql":   "sql",
+	".swift": "swift",
+	".tex":   "latex",
+	".ts":    "typescript",
+	".tsx":   "typescriptreact",
+	".xml":   "xml",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".zig":   "zig",
+}
+
+// LanguageIDForPath returns the language identifier of file detected from its extension.
+// The extension is looked up in LanguageIDs as is, then in lower case.
+// It returns an empty string if the extension is unknown.
+func LanguageIDForPath(file string) string {
+	ext := filepath.Ext(file)
+	if id, ok := LanguageIDs[ext]; ok {
+		return id
+	}
+	return LanguageIDs[strings.ToLower(ext)]
+}
@@ -0,0 +1,32 @@
+package lsp
+
+import "testing"
+
+func TestLanguageIDForPath(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"/a/b.go", "go"},
+		{"b.py", "python"},
+		{"lib.rs", "rust"},
+		{"x.H", "c"},
+		{"Main.CPP", "cpp"},
+		{"app.tsx", "typescriptreact"},
+		{"Makefile", ""},
+		{"a.unknown", ""},
+	}
+	for _, tt := range tests {
+		if id := LanguageIDForPath(tt.file); id != tt.want {
+			t.Errorf("LanguageIDForPath(%q) = %q; want %q", tt.file, id, tt.want)
+		}
+	}
+}
+
+func TestLanguageIDsOverride(t *testing.T) {
+	LanguageIDs[".myl"] = "mylang"
+	defer delete(LanguageIDs, ".myl")
+	if id := LanguageIDForPath("a.myl"); id != "mylang" {
+		t.Errorf("LanguageIDForPath = %q; want mylang", id)
+	}
+}
@@ -0,0 +1,169 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// MessageType represents the type of messages sent by window/logMessage and window/showMessage.
+type MessageType int
+
+// MessageType values.
+const (
+	MessageTypeError   MessageType = 1
+	MessageTypeWarning MessageType = 2
+	MessageTypeInfo    MessageType = 3
+	MessageTypeLog     MessageType = 4
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeError:
+		return "Error"
+	case MessageTypeWarning:
+		return "Warning"
+	case MessageTypeInfo:
+		return "Info"
+	case MessageTypeLog:
+		return "Log"
+	}
+	return fmt.Sprintf("MessageType(%d)", int(t))
+}
+
+// LogMessageParams represents the interface described in the specification.
+type LogMessageParams struct {
+	Type    MessageType `json:"type"`
+	Message string      `json:"message"`
+}
+
+// LogMessages returns an option to write window/logMessage notifications to w
+// instead of delivering them to Event. Each message is written as a line
+// prefixed with the time and its type.
+//
+// Writes are made from the goroutine that reads responses,
+// so w should not block; RotatingFile is suitable for long sessions.
+func LogMessages(w io.Writer) Option {
+	return func(c *Client) {
+		c.logw = w
+	}
+}
+
+// logMessage writes the message in msg to c.logw.
+// It returns false if msg can't be decoded.
+func (c *Client) logMessage(msg *Message) bool {
+	var params LogMessageParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return false
+	}
+	t := time.Now().Format("2006/01/02 15:04:05")
+	fmt.Fprintf(c.logw, "%s [%v] %s\n", t, params.Type, params.Message)
+	return true
+}
+
+// RotatingFile is an io.WriteCloser that writes to a file and rotates it by size.
+// When a write would grow the file beyond the limit, the file is renamed to name.1,
+// older backups are shifted to name.2, name.3, and so on, and a new file is created.
+type RotatingFile struct {
+	name    string
+	maxSize int64
+	backups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens name for appending. The file is rotated when it exceeds maxSize bytes,
+// and at most backups rotated files are kept.
+func OpenRotatingFile(name string, maxSize int64, backups int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		return nil, xerrors.Errorf("%s: invalid max size %d", name, maxSize)
+	}
+	r := &RotatingFile{
+		name:    name,
+		maxSize: maxSize,
+		backups: backups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = fi.Size()
+	return nil
+}
+
+// Write implements io.Writer interface.
+// A single write is never split across files.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	if r.backups <= 0 {
+		if err := os.Remove(r.name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.backups - 1; i > 0; i-- {
+		err := os.Rename(r.backupName(i), r.backupName(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.name, r.backupName(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", r.name, i)
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestClientLogMessages(t *testing.T) {
+	var w syncBuffer
+	c, s := newPipeClient(t, LogMessages(&w))
+	defer c.Close()
+	defer s.Close()
+
+	msgs := []*Message{
+		{Method: "window/logMessage", Params: json.RawMessage(`{"type":3,"message":"loaded packages"}`)},
+		{Method: "window/logMessage", Params: json.RawMessage(`{"type":1,"message":"failed"}`)},
+		{Method: "test/notify", Params: json.RawMessage(`{}`)},
+	}
+	for _, msg := range msgs {
+		if err := s.write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msg := <-c.Event; msg.Method != "test/notify" {
+		t.Errorf("Event = %q; want test/notify", msg.Method)
+	}
+	lines := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+	want := []string{"[Info] loaded packages", "[Error] failed"}
+	if len(lines) != len(want) {
+		t.Fatalf("log = %q; want %d lines", lines, len(want))
+	}
+	for i, s := range want {
+		if !strings.HasSuffix(lines[i], s) {
+			t.Errorf("log[%d] = %q; want suffix %q", i, lines[i], s)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "gopls.log")
+	f, err := OpenRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		name:        "gggg\n",
+		name + ".1": "eeee\nffff\n",
+		name + ".2": "cccc\ndddd\n",
+	}
+	for file, want := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("ReadFile: %v", err)
+			continue
+		}
+		if s := string(b); s != want {
+			t.Errorf("%s = %q; want %q", filepath.Base(file), s, want)
+		}
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 should not exist: %v", filepath.Base(name), err)
+	}
+}
@@ -0,0 +1,141 @@
+package lsp
+
+import (
+	"sort"
+)
+
+// capabilityChecks maps methods that Client has wrappers for
+// to functions that report whether the server advertises them.
+// A nil function means the method doesn't depend on server capabilities.
+var capabilityChecks = map[string]func(cap *ServerCapabilities) bool{
+	"initialize":  nil,
+	"initialized": nil,
+	"shutdown":    nil,
+	"exit":        nil,
+
+	"textDocument/didOpen":   nil,
+	"textDocument/didChange": nil,
+	"textDocument/didClose":  nil,
+	"textDocument/willSave": func(cap *ServerCapabilities) bool {
+		return cap.TextDocumentSync.WillSave
+	},
+	"textDocument/willSaveWaitUntil": func(cap *ServerCapabilities) bool {
+		return cap.TextDocumentSync.WillSaveWaitUntil
+	},
+	"textDocument/didSave": func(cap *ServerCapabilities) bool {
+		return bool(cap.TextDocumentSync.Save.Provider)
+	},
+
+	"textDocument/completion": func(cap *ServerCapabilities) bool {
+		return bool(cap.CompletionProvider.Provider)
+	},
+	"completionItem/resolve": func(cap *ServerCapabilities) bool {
+		return cap.CompletionProvider.ResolveProvider
+	},
+	"textDocument/hover": func(cap *ServerCapabilities) bool {
+		return bool(cap.HoverProvider)
+	},
+	"textDocument/definition": func(cap *ServerCapabilities) bool {
+		return bool(cap.DefinitionProvider)
+	},
+	"textDocument/references": func(cap *ServerCapabilities) bool {
+		return bool(cap.ReferencesProvider)
+	},
+	"textDocument/documentLink": nil,
+	"textDocument/codeAction": func(cap *ServerCapabilities) bool {
+		return bool(cap.CodeActionProvider.Provider)
+	},
+	"codeAction/resolve": func(cap *ServerCapabilities) bool {
+		return cap.CodeActionProvider.ResolveProvider
+	},
+	"textDocument/formatting": func(cap *ServerCapabilities) bool {
+		return bool(cap.DocumentFormattingProvider)
+	},
+	"textDocument/rangeFormatting": func(cap *ServerCapabilities) bool {
+		return bool(cap.DocumentRangeFormattingProvider)
+	},
+	"textDocument/onTypeFormatting": func(cap *ServerCapabilities) bool {
+		return cap.DocumentOnTypeFormattingProvider != nil
+	},
+	"textDocument/documentColor": func(cap *ServerCapabilities) bool {
+		return bool(cap.ColorProvider)
+	},
+	"textDocument/colorPresentation": func(cap *ServerCapabilities) bool {
+		return bool(cap.ColorProvider)
+	},
+	"textDocument/prepareCallHierarchy": func(cap *ServerCapabilities) bool {
+		return bool(cap.CallHierarchyProvider)
+	},
+	"callHierarchy/incomingCalls": func(cap *ServerCapabilities) bool {
+		return bool(cap.CallHierarchyProvider)
+	},
+	"callHierarchy/outgoingCalls": func(cap *ServerCapabilities) bool {
+		return bool(cap.CallHierarchyProvider)
+	},
+	"textDocument/prepareTypeHierarchy": func(cap *ServerCapabilities) bool {
+		return bool(cap.TypeHierarchyProvider)
+	},
+	"typeHierarchy/supertypes": func(cap *ServerCapabilities) bool {
+		return bool(cap.TypeHierarchyProvider)
+	},
+	"typeHierarchy/subtypes": func(cap *ServerCapabilities) bool {
+		return bool(cap.TypeHierarchyProvider)
+	},
+	"textDocument/inlayHint": func(cap *ServerCapabilities) bool {
+		return bool(cap.InlayHintProvider.Provider)
+	},
+	"inlayHint/resolve": func(cap *ServerCapabilities) bool {
+		return cap.InlayHintProvider.ResolveProvider
+	},
+	"textDocument/inlineValue": func(cap *ServerCapabilities) bool {
+		return bool(cap.InlineValueProvider)
+	},
+	"textDocument/moniker": func(cap *ServerCapabilities) bool {
+		return bool(cap.MonikerProvider)
+	},
+	"textDocument/linkedEditingRange": func(cap *ServerCapabilities) bool {
+		return bool(cap.LinkedEditingRangeProvider)
+	},
+	"textDocument/diagnostic": func(cap *ServerCapabilities) bool {
+		return cap.DiagnosticProvider != nil
+	},
+	"workspace/diagnostic": func(cap *ServerCapabilities) bool {
+		return cap.DiagnosticProvider != nil && cap.DiagnosticProvider.WorkspaceDiagnostics
+	},
+	"workspace/executeCommand": func(cap *ServerCapabilities) bool {
+		return len(cap.ExecuteCommandProvider.Commands) > 0
+	},
+	"workspace/didChangeWorkspaceFolders": func(cap *ServerCapabilities) bool {
+		return cap.Workspace.WorkspaceFolders.Supported
+	},
+}
+
+// Methods returns methods that Client has wrappers for, in sorted order.
+func Methods() []string {
+	a := make([]string, 0, len(capabilityChecks))
+	for method := range capabilityChecks {
+		a = append(a, method)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// SupportedMethods returns methods that Client has wrappers for
+// and the server advertises, in sorted order.
+// Before initialize completes, it returns only methods that don't depend on capabilities.
+func (c *Client) SupportedMethods() []string {
+	var a []string
+	for _, method := range Methods() {
+		if c.Supports(method) {
+			a = append(a, method)
+		}
+	}
+	return a
+}
+
+// Supports reports whether the server advertises method.
+// It returns true for methods that don't depend on capabilities or that Client doesn't know.
+func (c *Client) Supports(method string) bool {
+	f := capabilityChecks[method]
+	return f == nil || f(&c.cap)
+}
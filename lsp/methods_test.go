@@ -0,0 +1,59 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestClientSupportedMethods(t *testing.T) {
+	var c Client
+	c.cap.CompletionProvider.Provider = true
+	c.cap.CodeActionProvider.Provider = true
+	supported := make(map[string]bool)
+	for _, method := range c.SupportedMethods() {
+		supported[method] = true
+	}
+	tests := map[string]bool{
+		"initialize":              true,
+		"textDocument/didOpen":    true,
+		"textDocument/completion": true,
+		"textDocument/codeAction": true,
+		"codeAction/resolve":      false,
+		"textDocument/formatting": false,
+		"workspace/diagnostic":    false,
+	}
+	for method, want := range tests {
+		if supported[method] != want {
+			t.Errorf("SupportedMethods() contains %s = %t; want %t", method, supported[method], want)
+		}
+	}
+	if n, m := len(c.SupportedMethods()), len(Methods()); n >= m {
+		t.Errorf("SupportedMethods() returns %d methods; want less than %d", n, m)
+	}
+}
+
+func TestClientUnsupported(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	var params TextDocumentPositionParams
+	tests := map[string]Waiter{
+		"textDocument/definition":        c.GotoDefinition(&params),
+		"textDocument/references":        c.References(&ReferenceParams{}),
+		"textDocument/willSaveWaitUntil": c.WillSaveWaitUntilTextDocument(&WillSaveTextDocumentParams{}),
+		"workspace/executeCommand":       c.ExecuteCommand(&ExecuteCommandParams{Command: "x"}),
+	}
+	for method, w := range tests {
+		err := w.Wait()
+		if !xerrors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: Wait() = %v; want ErrUnsupported", method, err)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), method) {
+			t.Errorf("%s: error %q doesn't contain the method", method, err)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strings"
+
+	"golang.org/x/xerrors"
 )
 
 /*
@@ -30,7 +33,10 @@ func (u DocumentURI) String() string {
 }
 
 // SetRootURI updates c.BaseURL with s.
+// The s is either a path or a file URI such as "file:///home/me/proj".
+// Trailing slashes in s are ignored.
 func (c *Client) SetRootURI(s string) error {
+	s = strings.TrimPrefix(s, fileSchema)
 	if !path.IsAbs(s) {
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -40,13 +46,14 @@ func (c *Client) SetRootURI(s string) error {
 	}
 	var u url.URL
 	u.Scheme = "file"
-	u.Path = s
+	u.Path = path.Clean(s)
 	c.BaseURL = &u
 	return nil
 }
 
 // URL returns a document URI representation of s with c.BaseURL.
 // If c.BaseURL is nil, client will assume it to be current directory.
+// The result doesn't depend on whether c.BaseURL has a trailing slash.
 func (c *Client) URL(s string) DocumentURI {
 	if c.BaseURL == nil {
 		c.SetRootURI(".")
@@ -63,12 +70,35 @@ type Position struct {
 	Character int `json:"character"`
 }
 
+// Before reports whether p is located before other.
+func (p Position) Before(other Position) bool {
+	if p.Line != other.Line {
+		return p.Line < other.Line
+	}
+	return p.Character < other.Character
+}
+
 // Range represents the interface described in the specification.
 type Range struct {
 	Start Position `json:"start"`
 	End   Position `json:"end"`
 }
 
+// Contains reports whether pos is in r. The end of r is exclusive,
+// except that an empty range contains its start.
+func (r Range) Contains(pos Position) bool {
+	if r.Start == r.End {
+		return pos == r.Start
+	}
+	return !pos.Before(r.Start) && pos.Before(r.End)
+}
+
+// Overlaps reports whether r and other share any position.
+// Ranges that only touch at their ends don't overlap.
+func (r Range) Overlaps(other Range) bool {
+	return r.Start.Before(other.End) && other.Start.Before(r.End)
+}
+
 // Location represents the interface described in the specification.
 type Location struct {
 	URI   DocumentURI `json:"uri"`
@@ -89,6 +119,31 @@ type TextEdit struct {
 	NewText string `json:"newText"`
 }
 
+// MarkupContent represents the interface described in the specification.
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// Some fields are typed as string | MarkupContent; a string is decoded as plaintext.
+func (m *MarkupContent) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*m = MarkupContent{Kind: MarkupKindPlainText, Value: s}
+		return nil
+	}
+	type content MarkupContent
+	return json.Unmarshal(b, (*content)(m))
+}
+
+// Command represents the interface described in the specification.
+type Command struct {
+	Title     string            `json:"title"`
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
 // TextDocumentIdentifier represents the interface described in the specification.
 type TextDocumentIdentifier struct {
 	URI DocumentURI `json:"uri"`
@@ -99,18 +154,88 @@ type InitializeParams struct {
 	ProcessID *int        `json:"processId"`
 	RootURI   DocumentURI `json:"rootUri"`
 
-	Capabilities ClientCapabilities `json:"capabilities"`
+	// If Capabilities is nil, Initialize sends DefaultClientCapabilities.
+	Capabilities *ClientCapabilities `json:"capabilities"`
+
+	// If WorkspaceFolders is nil, Initialize sends the folders set by
+	// SetWorkspaceFolders when there are more than one.
+	WorkspaceFolders []WorkspaceFolder `json:"workspaceFolders,omitempty"`
 
 	Trace string `json:"trace,omitempty"` // off, message, verbose
+
+	// If Locale is empty, Initialize sends the locale of the environment.
+	Locale string `json:"locale,omitempty"`
+
+	// InitializationOptions are server specific options, such as *GoplsSettings.
+	InitializationOptions interface{} `json:"initializationOptions,omitempty"`
 }
 
+// envLocale returns the locale in IETF language tag, such as "en-US",
+// that is taken from LC_ALL, LC_MESSAGES or LANG environment variables.
+// It returns an empty string for the C or POSIX locale.
+func envLocale() string {
+	var s string
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if s = os.Getenv(name); s != "" {
+			break
+		}
+	}
+	if i := strings.IndexAny(s, ".@"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "C" || s == "POSIX" {
+		return ""
+	}
+	return strings.ReplaceAll(s, "_", "-")
+}
+
+// MarkupKind values.
+const (
+	MarkupKindPlainText = "plaintext"
+	MarkupKindMarkdown  = "markdown"
+)
+
 // ClientCapabilities represents the interface described in the specification.
 type ClientCapabilities struct {
+	Workspace    WorkspaceClientCapabilities    `json:"workspace,omitempty"`
 	TextDocument TextDocumentClientCapabilities `json:"textDocument,omitempty"`
 }
 
+// WorkspaceClientCapabilities represents the interface described in the specification.
+type WorkspaceClientCapabilities struct {
+	ApplyEdit        bool `json:"applyEdit,omitempty"`
+	WorkspaceFolders bool `json:"workspaceFolders,omitempty"`
+	WorkspaceEdit    struct {
+		DocumentChanges    bool     `json:"documentChanges,omitempty"`
+		ResourceOperations []string `json:"resourceOperations,omitempty"`
+		FailureHandling    string   `json:"failureHandling,omitempty"`
+	} `json:"workspaceEdit,omitempty"`
+}
+
 // TextDocumentClientCapabilities represents the interface described in the specification.
 type TextDocumentClientCapabilities struct {
+	Synchronization struct {
+		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+		WillSave            bool `json:"willSave,omitempty"`
+		WillSaveWaitUntil   bool `json:"willSaveWaitUntil,omitempty"`
+		DidSave             bool `json:"didSave,omitempty"`
+	} `json:"synchronization,omitempty"`
+	Completion struct {
+		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+		CompletionItem      struct {
+			SnippetSupport          bool     `json:"snippetSupport,omitempty"`
+			CommitCharactersSupport bool     `json:"commitCharactersSupport,omitempty"`
+			DocumentationFormat     []string `json:"documentationFormat,omitempty"`
+			DeprecatedSupport       bool     `json:"deprecatedSupport,omitempty"`
+			PreselectSupport        bool     `json:"preselectSupport,omitempty"`
+			InsertReplaceSupport    bool     `json:"insertReplaceSupport,omitempty"`
+		} `json:"completionItem,omitempty"`
+		ContextSupport bool `json:"contextSupport,omitempty"`
+	} `json:"completion,omitempty"`
+	Hover struct {
+		DynamicRegistration bool     `json:"dynamicRegistration,omitempty"`
+		ContentFormat       []string `json:"contentFormat,omitempty"`
+	} `json:"hover,omitempty"`
 	Declaration struct {
 		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
 		LinkSupport         bool `json:"linkSupport,omitempty"`
@@ -127,51 +252,237 @@ type TextDocumentClientCapabilities struct {
 		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
 		LinkSupport         bool `json:"linkSupport,omitempty"`
 	} `json:"implementation,omitempty"`
+	References struct {
+		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	} `json:"references,omitempty"`
+	DocumentSymbol struct {
+		DynamicRegistration               bool `json:"dynamicRegistration,omitempty"`
+		HierarchicalDocumentSymbolSupport bool `json:"hierarchicalDocumentSymbolSupport,omitempty"`
+	} `json:"documentSymbol,omitempty"`
+	DocumentLink struct {
+		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	} `json:"documentLink,omitempty"`
+	CodeAction struct {
+		DynamicRegistration      bool `json:"dynamicRegistration,omitempty"`
+		CodeActionLiteralSupport *struct {
+			CodeActionKind struct {
+				ValueSet []string `json:"valueSet"`
+			} `json:"codeActionKind"`
+		} `json:"codeActionLiteralSupport,omitempty"`
+		IsPreferredSupport bool `json:"isPreferredSupport,omitempty"`
+		DataSupport        bool `json:"dataSupport,omitempty"`
+		ResolveSupport     *struct {
+			Properties []string `json:"properties"`
+		} `json:"resolveSupport,omitempty"`
+	} `json:"codeAction,omitempty"`
+	PublishDiagnostics struct {
+		RelatedInformation bool `json:"relatedInformation,omitempty"`
+		TagSupport         *struct {
+			ValueSet []DiagnosticTag `json:"valueSet"`
+		} `json:"tagSupport,omitempty"`
+		CodeDescriptionSupport bool `json:"codeDescriptionSupport,omitempty"`
+	} `json:"publishDiagnostics,omitempty"`
+
+	// Diagnostic enables pull diagnostics. It is nil by default
+	// because some servers stop publishing diagnostics if it is set.
+	Diagnostic *struct {
+		DynamicRegistration    bool `json:"dynamicRegistration,omitempty"`
+		RelatedDocumentSupport bool `json:"relatedDocumentSupport,omitempty"`
+	} `json:"diagnostic,omitempty"`
+
+	omit map[ClientFeature]bool // set by ClientCapabilitiesBuilder
+}
+
+// DefaultClientCapabilities returns capabilities that describe what this client supports.
+// Acme displays plain text, so it prefers plaintext over markdown.
+// Snippets are advertised since CompletionItem.Text strips their placeholders.
+func DefaultClientCapabilities() *ClientCapabilities {
+	var c ClientCapabilities
+	c.Workspace.ApplyEdit = true
+	c.Workspace.WorkspaceFolders = true
+	c.Workspace.WorkspaceEdit.DocumentChanges = true
+	c.Workspace.WorkspaceEdit.ResourceOperations = []string{
+		ResourceOperationKindCreate,
+		ResourceOperationKindRename,
+		ResourceOperationKindDelete,
+	}
+	c.Workspace.WorkspaceEdit.FailureHandling = "abort"
+	t := &c.TextDocument
+	t.Synchronization.WillSave = true
+	// willSaveWaitUntil isn't advertised because the client doesn't apply its edits.
+	t.Synchronization.DidSave = true
+	t.Completion.CompletionItem.SnippetSupport = true
+	t.Completion.CompletionItem.DocumentationFormat = []string{MarkupKindPlainText}
+	t.Completion.CompletionItem.DeprecatedSupport = true
+	t.Completion.CompletionItem.InsertReplaceSupport = true
+	t.Completion.ContextSupport = true
+	t.Hover.ContentFormat = []string{MarkupKindPlainText, MarkupKindMarkdown}
+	t.DocumentSymbol.HierarchicalDocumentSymbolSupport = true
+	t.CodeAction.CodeActionLiteralSupport = &struct {
+		CodeActionKind struct {
+			ValueSet []string `json:"valueSet"`
+		} `json:"codeActionKind"`
+	}{}
+	t.CodeAction.CodeActionLiteralSupport.CodeActionKind.ValueSet = []string{
+		CodeActionKindEmpty,
+		CodeActionKindQuickFix,
+		CodeActionKindRefactor,
+		CodeActionKindRefactorExtract,
+		CodeActionKindRefactorInline,
+		CodeActionKindRefactorRewrite,
+		CodeActionKindSource,
+		CodeActionKindSourceOrganizeImports,
+		CodeActionKindSourceFixAll,
+	}
+	t.CodeAction.IsPreferredSupport = true
+	t.CodeAction.DataSupport = true
+	t.CodeAction.ResolveSupport = &struct {
+		Properties []string `json:"properties"`
+	}{
+		Properties: []string{"edit"},
+	}
+	t.PublishDiagnostics.RelatedInformation = true
+	t.PublishDiagnostics.TagSupport = &struct {
+		ValueSet []DiagnosticTag `json:"valueSet"`
+	}{
+		ValueSet: []DiagnosticTag{DiagnosticTagUnnecessary, DiagnosticTagDeprecated},
+	}
+	t.PublishDiagnostics.CodeDescriptionSupport = true
+	return &c
 }
 
 // InitializeResult represents the interface described in the specification.
 type InitializeResult struct {
 	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   *ServerInfo        `json:"serverInfo,omitempty"`
 
 	c    *Client
 	call *Call
 }
 
+// ServerInfo represents the interface described in the specification.
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// ServerInfo returns the name and the version the server reported in initialize.
+// Both are empty if the server didn't report them or the initialize request hasn't completed.
+func (c *Client) ServerInfo() (name, version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.serverInfo == nil {
+		return "", ""
+	}
+	return c.serverInfo.Name, c.serverInfo.Version
+}
+
 // ServerCapabilities represents the interface described in the specification.
 type ServerCapabilities struct {
-	// TODO(lufia): textDocumentSync is: TextDocumentSyncOption | number
 	// TODO(lufia): missing
 	// typeDefinitionProvider
 	// implementationProvider
-	// codeActionProvider
 	// codeLensProvider
-	// documentOnTypeFormattingProvider
-	// renameProvider
 	// documentLinkProvider
-	// colorProvider
 	// foldingRangeProvider
 	// declarationProvider
-	// workspace
 	// experimental
 
-	TextDocumentSync                TextDocumentSyncOptions `json:"textDocumentSync"`
-	HoverProvider                   bool                    `json:"hoverProvider,omitempty"`
-	CompletionProvider              CompletionOptions       `json:"completionProvider,omitempty"`
-	SignatureHelpProvider           SignatureHelpOptions    `json:"signatureHelpProvider,omitempty"`
-	DefinitionProvider              bool                    `json:"definitionProvider,omitempty"`
-	ReferencesProvider              bool                    `json:"referencesProvider,omitempty"`
-	DocumentHighlightProvider       bool                    `json:"documentHighlightProvider,omitempty"`
-	DocumentSymbolProvider          bool                    `json:"documentSymbolProvider,omitempty"`
-	WorkspaceSymbolProvider         bool                    `json:"workspaceSymbolProvider,omitempty"`
-	DocumentFormattingProvider      bool                    `json:"documentFormattingProvider,omitempty"`
-	DocumentRangeFormattingProvider bool                    `json:"documentRangeFormattingProvider,omitempty"`
-	ExecuteCommandProvider          ExecuteCommandOptions   `json:"executeCommandProvider,omitempty"`
+	TextDocumentSync                 TextDocumentSyncOptions          `json:"textDocumentSync"`
+	HoverProvider                    Provider                         `json:"hoverProvider,omitempty"`
+	CompletionProvider               CompletionOptions                `json:"completionProvider,omitempty"`
+	SignatureHelpProvider            SignatureHelpOptions             `json:"signatureHelpProvider,omitempty"`
+	DefinitionProvider               Provider                         `json:"definitionProvider,omitempty"`
+	ReferencesProvider               Provider                         `json:"referencesProvider,omitempty"`
+	DocumentHighlightProvider        Provider                         `json:"documentHighlightProvider,omitempty"`
+	DocumentSymbolProvider           Provider                         `json:"documentSymbolProvider,omitempty"`
+	WorkspaceSymbolProvider          Provider                         `json:"workspaceSymbolProvider,omitempty"`
+	DocumentFormattingProvider       Provider                         `json:"documentFormattingProvider,omitempty"`
+	DocumentRangeFormattingProvider  Provider                         `json:"documentRangeFormattingProvider,omitempty"`
+	DocumentOnTypeFormattingProvider *DocumentOnTypeFormattingOptions `json:"documentOnTypeFormattingProvider,omitempty"`
+	RenameProvider                   RenameOptions                    `json:"renameProvider,omitempty"`
+	ExecuteCommandProvider           ExecuteCommandOptions            `json:"executeCommandProvider,omitempty"`
+	CodeActionProvider               CodeActionOptions                `json:"codeActionProvider,omitempty"`
+	CallHierarchyProvider            Provider                         `json:"callHierarchyProvider,omitempty"`
+	TypeHierarchyProvider            Provider                         `json:"typeHierarchyProvider,omitempty"`
+	InlayHintProvider                InlayHintOptions                 `json:"inlayHintProvider,omitempty"`
+	InlineValueProvider              Provider                         `json:"inlineValueProvider,omitempty"`
+	ColorProvider                    Provider                         `json:"colorProvider,omitempty"`
+	MonikerProvider                  Provider                         `json:"monikerProvider,omitempty"`
+	LinkedEditingRangeProvider       Provider                         `json:"linkedEditingRangeProvider,omitempty"`
+	DiagnosticProvider               *DiagnosticOptions               `json:"diagnosticProvider,omitempty"`
+	Workspace                        WorkspaceServerCapabilities      `json:"workspace,omitempty"`
+}
+
+// Provider represents a capability that is either boolean or an options object.
+// An options object means the server provides the feature.
+type Provider bool
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (p *Provider) UnmarshalJSON(b []byte) error {
+	var v bool
+	if err := json.Unmarshal(b, &v); err == nil {
+		*p = Provider(v)
+		return nil
+	}
+	var opts map[string]json.RawMessage
+	if err := json.Unmarshal(b, &opts); err != nil {
+		return err
+	}
+	*p = true
+	return nil
+}
+
+// unmarshalProvider decodes b that is either boolean or an options object.
+// If b is an object, it sets *p to true and decodes b into opts.
+func unmarshalProvider(b []byte, p *Provider, opts interface{}) error {
+	var v bool
+	if err := json.Unmarshal(b, &v); err == nil {
+		*p = Provider(v)
+		return nil
+	}
+	if err := json.Unmarshal(b, opts); err != nil {
+		return err
+	}
+	*p = true
+	return nil
+}
+
+// InlayHintOptions represents the interface described in the specification.
+type InlayHintOptions struct {
+	Provider        Provider `json:"-"`
+	ResolveProvider bool     `json:"resolveProvider,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (o *InlayHintOptions) UnmarshalJSON(b []byte) error {
+	type options InlayHintOptions
+	return unmarshalProvider(b, &o.Provider, (*options)(o))
+}
+
+// RenameOptions represents the interface described in the specification.
+type RenameOptions struct {
+	Provider        Provider `json:"-"`
+	PrepareProvider bool     `json:"prepareProvider,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (o *RenameOptions) UnmarshalJSON(b []byte) error {
+	type options RenameOptions
+	return unmarshalProvider(b, &o.Provider, (*options)(o))
 }
 
 //"documentLinkProvider"
 //"typeDefinitionProvider"
 //"workspace"
 
+// TextDocumentSyncKind values.
+const (
+	TextDocumentSyncKindNone        = 0
+	TextDocumentSyncKindFull        = 1
+	TextDocumentSyncKindIncremental = 2
+)
+
 // TextDocumentSyncOptions represents the interface described in the specification.
 type TextDocumentSyncOptions struct {
 	OpenClose         bool        `json:"openClose,omitempty"`
@@ -181,20 +492,73 @@ type TextDocumentSyncOptions struct {
 	Save              SaveOptions `json:"save,omitempty"`
 }
 
+// UnmarshalJSON implements json.Unmarshaler interface.
+// The server may respond either TextDocumentSyncKind or TextDocumentSyncOptions.
+// A kind other than None is treated as the server wants open, close and save
+// notifications without text.
+func (o *TextDocumentSyncOptions) UnmarshalJSON(b []byte) error {
+	var kind int
+	if err := json.Unmarshal(b, &kind); err == nil {
+		*o = TextDocumentSyncOptions{
+			OpenClose: kind != TextDocumentSyncKindNone,
+			Change:    kind,
+			Save: SaveOptions{
+				Provider: kind != TextDocumentSyncKindNone,
+			},
+		}
+		return nil
+	}
+	type options TextDocumentSyncOptions
+	var v options
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*o = TextDocumentSyncOptions(v)
+	return nil
+}
+
 // SaveOptions represents the interface described in the specification.
 type SaveOptions struct {
-	IncludeText bool `json:"includeText,omitempty"`
+	Provider    Provider `json:"-"`
+	IncludeText bool     `json:"includeText,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (o *SaveOptions) UnmarshalJSON(b []byte) error {
+	type options SaveOptions
+	return unmarshalProvider(b, &o.Provider, (*options)(o))
 }
 
 // CompletionOptions represents the interface described in the specification.
 type CompletionOptions struct {
+	Provider          Provider `json:"-"`
 	ResolveProvider   bool     `json:"resolveProvider"`
 	TriggerCharacters []string `json:"triggerCharacters"`
 }
 
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (o *CompletionOptions) UnmarshalJSON(b []byte) error {
+	type options CompletionOptions
+	return unmarshalProvider(b, &o.Provider, (*options)(o))
+}
+
 // SignatureHelpOptions represents the interface described in the specification.
 type SignatureHelpOptions struct {
-	TriggerCharacters []string `json:"triggerCharacters"`
+	TriggerCharacters   []string `json:"triggerCharacters"`
+	RetriggerCharacters []string `json:"retriggerCharacters,omitempty"`
+}
+
+// SignatureHelpTriggerCharacters returns characters that trigger signature help automatically.
+// It returns nil before the initialize request completes.
+func (c *Client) SignatureHelpTriggerCharacters() []string {
+	return copyStrings(c.cap.SignatureHelpProvider.TriggerCharacters)
+}
+
+func copyStrings(a []string) []string {
+	if len(a) == 0 {
+		return nil
+	}
+	return append([]string(nil), a...)
 }
 
 // ExecuteCommandOptions represents the interface described in the specification.
@@ -202,14 +566,78 @@ type ExecuteCommandOptions struct {
 	Commands []string `json:"commands"`
 }
 
+// ExecuteCommandParams represents the interface described in the specification.
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+// ExecuteCommandResult represents a result object for execute command request.
+type ExecuteCommandResult struct {
+	Result json.RawMessage
+
+	c    *Client
+	call *Call
+}
+
+// ExecuteCommand sends the execute command request to the server.
+// The server may send workspace/applyEdit requests to the client while it executes the command.
+// The command must be one of commands that the server advertises.
+func (c *Client) ExecuteCommand(params *ExecuteCommandParams) *ExecuteCommandResult {
+	const method = "workspace/executeCommand"
+	var result ExecuteCommandResult
+	result.c = c
+	if !c.hasCommand(params.Command) {
+		result.call = c.unsupported(method+" "+params.Command, params, &result.Result)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Result)
+	return &result
+}
+
+func (c *Client) hasCommand(name string) bool {
+	for _, s := range c.cap.ExecuteCommandProvider.Commands {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait waits for a response of execute command request.
+func (r *ExecuteCommandResult) Wait() error {
+	return r.c.Wait(r.call)
+}
+
 // Initialize sends the initialize request to the server.
+//
+// The specification requires the client to send the initialized notification
+// after the response of initialize, and before any other request or notification.
+// Wait of the result sends it automatically unless the client was created with ManualInitialized.
 func (c *Client) Initialize(params *InitializeParams) *InitializeResult {
+	if params.Capabilities == nil {
+		params.Capabilities = DefaultClientCapabilities()
+	}
 	// gopls don't support []LocationLink yet
 	params.Capabilities.TextDocument.Definition.LinkSupport = false
+	if params.Locale == "" {
+		params.Locale = envLocale()
+	}
+	if params.WorkspaceFolders == nil {
+		if a := c.workspaceFolders(); len(a) > 1 {
+			params.WorkspaceFolders = a
+		}
+	}
+
+	c.mu.Lock()
+	c.reinit.params = params
+	c.reinit.gen++
+	c.mu.Unlock()
 
 	var result InitializeResult
 	result.c = c
-	result.call = c.Call("initialize", params, &result)
+	c.setStatus(StatusInitializing)
+	result.call = c.callInitialize(params, &result)
 	return &result
 }
 
@@ -218,8 +646,15 @@ func (r *InitializeResult) Wait() error {
 	if err := r.c.Wait(r.call); err != nil {
 		return err
 	}
+	r.c.setStatus(StatusReady)
 	r.c.cap = r.Capabilities
-	return nil
+	r.c.mu.Lock()
+	r.c.serverInfo = r.ServerInfo
+	r.c.mu.Unlock()
+	if r.c.manualInitialized {
+		return nil
+	}
+	return r.c.Initialized(&InitializedParams{})
 }
 
 // InitializedParams represents the interface described in the specification.
@@ -227,7 +662,15 @@ type InitializedParams struct {
 }
 
 // Initialized sends the initialized notification to the server.
+// It does nothing if the notification has already been sent.
 func (c *Client) Initialized(params *InitializedParams) error {
+	c.mu.Lock()
+	sent := c.initialized
+	c.initialized = true
+	c.mu.Unlock()
+	if sent {
+		return nil
+	}
 	return c.Wait(c.Call("initialized", params, nil))
 }
 
@@ -241,6 +684,7 @@ type ShutdownResult struct {
 func (c *Client) Shutdown() *ShutdownResult {
 	var result ShutdownResult
 	result.c = c
+	c.setStatus(StatusShuttingDown)
 	result.call = c.Call("shutdown", nil, &result)
 	return &result
 }
@@ -251,6 +695,8 @@ func (r *ShutdownResult) Wait() error {
 }
 
 // Exit sends the exit notification to the server.
+// It doesn't wait for a reply because exit is a notification;
+// it returns after the notification is written.
 func (c *Client) Exit() error {
 	return c.Wait(c.Call("exit", nil, nil))
 }
@@ -271,7 +717,44 @@ type TextDocumentItem struct {
 // DidOpenTextDocument sends the document open notification to the server.
 func (c *Client) DidOpenTextDocument(params *DidOpenTextDocumentParams) error {
 	call := c.Call("textDocument/didOpen", params, nil)
-	return c.Wait(call)
+	if err := c.Wait(call); err != nil {
+		return err
+	}
+	c.setVersion(params.TextDocument.URI, params.TextDocument.Version)
+	c.setText(params.TextDocument.URI, params.TextDocument.Text)
+	c.setLanguage(params.TextDocument.URI, params.TextDocument.LanguageID)
+	return nil
+}
+
+// DidOpenFile reads the document of uri with Content and sends the document open notification to the server.
+// If languageID is empty, it is detected from the extension of the file.
+// The document is opened as version 1; it is an error if uri is already open.
+func (c *Client) DidOpenFile(uri DocumentURI, languageID string) error {
+	if _, ok := c.version(uri); ok {
+		return xerrors.Errorf("%s: already open", uri)
+	}
+	file, err := uriToPath(uri)
+	if err != nil {
+		return err
+	}
+	text, err := c.Content(uri)
+	if err != nil {
+		return err
+	}
+	if languageID == "" {
+		languageID = LanguageIDForPath(file)
+	}
+	if languageID == "" {
+		return xerrors.Errorf("%s: unknown language", uri)
+	}
+	return c.DidOpenTextDocument(&DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{
+			URI:        uri,
+			LanguageID: languageID,
+			Version:    1,
+			Text:       text,
+		},
+	})
 }
 
 // DidChangeTextDocumentParams represents the interface described in the specification.
@@ -288,15 +771,44 @@ type VersionedTextDocumentIdentifier struct {
 
 // TextDocumentContentChangeEvent represents the interface described in the specification.
 type TextDocumentContentChangeEvent struct {
-	Range       Range  `json:"range,omitempty"`
+	Range       *Range `json:"range,omitempty"` // nil means the whole document
 	RangeLength int    `json:"rangeLength,omitempty"`
 	Text        string `json:"text"`
 }
 
+// SyncKind returns how the server wants documents to be synced in didChange notifications.
+// It is one of TextDocumentSyncKind values.
+func (c *Client) SyncKind() int {
+	return c.cap.TextDocumentSync.Change
+}
+
 // DidChangeTextDocument sends the document change notification to the server.
+// If the document was opened by DidOpenTextDocument, ranges of the changes are validated
+// against the text the server knows; an invalid range is reported with ErrInvalidRange
+// before the notification is sent, so that the server doesn't go out of sync.
 func (c *Client) DidChangeTextDocument(params *DidChangeTextDocumentParams) error {
+	uri := params.TextDocument.URI
+	text, ok := c.text(uri)
+	if ok {
+		s, err := applyChanges(text, params.ContentChanges)
+		if err != nil {
+			return xerrors.Errorf("%s: %w", uri, err)
+		}
+		text = s
+	}
 	call := c.Call("textDocument/didChange", params, nil)
-	return c.Wait(call)
+	if err := c.Wait(call); err != nil {
+		return err
+	}
+	if v := params.TextDocument.Version; v != nil {
+		c.setVersion(uri, *v)
+	} else {
+		c.invalidateDocument(uri)
+	}
+	if ok {
+		c.setText(uri, text)
+	}
+	return nil
 }
 
 // TextDocumentSaveReason represents reasons why a text document is saved.
@@ -333,9 +845,14 @@ func (r *TextEditsResult) Wait() error {
 
 // WillSaveWaitUntilTextDocument sends the document will save request to the server.
 func (c *Client) WillSaveWaitUntilTextDocument(params *WillSaveTextDocumentParams) *TextEditsResult {
+	const method = "textDocument/willSaveWaitUntil"
 	var result TextEditsResult
 	result.c = c
-	result.call = c.Call("textDocument/willSaveWaitUntil", params, &result.TextEdits)
+	if !c.Supports(method) {
+		result.call = c.unsupported(method, params, &result.TextEdits)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.TextEdits)
 	return &result
 }
 
@@ -363,6 +880,21 @@ func (c *Client) DidSaveTextDocument(params *DidSaveTextDocumentParams) error {
 	return c.Wait(call)
 }
 
+// DidSave calls DidSaveTextDocument if the server wants save notifications.
+// The params.Text is sent only if the server requests it with includeText.
+func (c *Client) DidSave(params *DidSaveTextDocumentParams) error {
+	save := c.cap.TextDocumentSync.Save
+	if !save.Provider {
+		return nil
+	}
+	if !save.IncludeText && params.Text != "" {
+		p := *params
+		p.Text = ""
+		params = &p
+	}
+	return c.DidSaveTextDocument(params)
+}
+
 // DidCloseTextDocumentParams represents the interface described in the specification.
 type DidCloseTextDocumentParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
@@ -371,7 +903,11 @@ type DidCloseTextDocumentParams struct {
 // DidCloseTextDocument sends the document close notification to the server.
 func (c *Client) DidCloseTextDocument(params *DidCloseTextDocumentParams) error {
 	call := c.Call("textDocument/didClose", params, nil)
-	return c.Wait(call)
+	if err := c.Wait(call); err != nil {
+		return err
+	}
+	c.deleteVersion(params.TextDocument.URI)
+	return nil
 }
 
 // TextDocumentPositionParams represents the interface described in the specification.
@@ -384,26 +920,45 @@ type TextDocumentPositionParams struct {
 type LocationsResult struct {
 	Locations []Location
 
-	c    *Client
-	call *Call
+	c       *Client
+	call    *Call
+	partial []Location    // partial results received before the response
+	queue   *partialQueue // delivers partial results
 }
 
 // GotoDefinition sends the go to definition request to the server.
 func (c *Client) GotoDefinition(params *TextDocumentPositionParams) *LocationsResult {
+	const method = "textDocument/definition"
 	var result LocationsResult
 	result.c = c
-	result.call = c.Call("textDocument/definition", params, &result.Locations)
+	if !c.Supports(method) {
+		result.call = c.unsupported(method, params, &result.Locations)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Locations)
 	return &result
 }
 
 // Wait waits for a response of any request.
+// If partial results were received, Locations contains them followed by the final result.
+// It returns after the callback of partial results has returned for all of them.
 func (r *LocationsResult) Wait() error {
-	return r.c.Wait(r.call)
+	err := r.c.Wait(r.call)
+	r.queue.wait()
+	if err != nil {
+		return err
+	}
+	if len(r.partial) > 0 {
+		r.Locations = append(r.partial, r.Locations...)
+		r.partial = nil
+	}
+	return nil
 }
 
 // ReferenceParams represents the interface described in the specification.
 type ReferenceParams struct {
 	TextDocumentPositionParams
+	PartialResultParams
 	Context ReferenceContext `json:"context"`
 }
 
@@ -412,13 +967,140 @@ type ReferenceContext struct {
 	IncludeDeclaration bool `json:"includeDeclaration"`
 }
 
+// References sends the find references request to the server.
 func (c *Client) References(params *ReferenceParams) *LocationsResult {
+	const method = "textDocument/references"
+	var result LocationsResult
+	result.c = c
+	if !c.Supports(method) {
+		result.call = c.unsupported(method, params, &result.Locations)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Locations)
+	return &result
+}
+
+// ReferencesPartial is like References, but the server may stream results.
+// The f is called in order with each chunk of locations on another goroutine;
+// it may wait for responses of other requests, but not for the result itself.
+// If params.PartialResultToken is empty, a new token is used.
+func (c *Client) ReferencesPartial(params *ReferenceParams, f func(locations []Location)) *LocationsResult {
+	const method = "textDocument/references"
 	var result LocationsResult
 	result.c = c
-	result.call = c.Call("textDocument/references", params, &result.Locations)
+	if !c.Supports(method) {
+		result.call = c.unsupported(method, params, &result.Locations)
+		return &result
+	}
+	p := *params
+	if p.PartialResultToken == "" {
+		p.PartialResultToken = c.newProgressToken()
+	}
+	result.call, result.queue = c.callPartial(method, &p, &result.Locations, p.PartialResultToken, func(value json.RawMessage) {
+		var locations []Location
+		if err := json.Unmarshal(value, &locations); err != nil {
+			c.debugf("can't decode partial result of references: %v\n", err)
+			return
+		}
+		result.partial = append(result.partial, locations...)
+		f(locations)
+	})
 	return &result
 }
 
+// UniquenessLevel values.
+const (
+	UniquenessLevelDocument = "document"
+	UniquenessLevelProject  = "project"
+	UniquenessLevelGroup    = "group"
+	UniquenessLevelScheme   = "scheme"
+	UniquenessLevelGlobal   = "global"
+)
+
+// MonikerKind values.
+const (
+	MonikerKindImport = "import"
+	MonikerKindExport = "export"
+	MonikerKindLocal  = "local"
+)
+
+// Moniker represents the interface described in the specification.
+type Moniker struct {
+	Scheme     string `json:"scheme"`
+	Identifier string `json:"identifier"`
+	Unique     string `json:"unique"`
+	Kind       string `json:"kind,omitempty"`
+}
+
+// MonikersResult represents a result object for moniker request.
+type MonikersResult struct {
+	Monikers []Moniker
+
+	c    *Client
+	call *Call
+}
+
+// Moniker sends the moniker request to the server.
+func (c *Client) Moniker(params *TextDocumentPositionParams) *MonikersResult {
+	const method = "textDocument/moniker"
+	var result MonikersResult
+	result.c = c
+	if !c.Supports(method) {
+		result.call = c.unsupported(method, params, &result.Monikers)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Monikers)
+	return &result
+}
+
+// Wait waits for a response of moniker request.
+// Monikers will be empty if the server responds null.
+func (r *MonikersResult) Wait() error {
+	if err := r.c.Wait(r.call); err != nil {
+		return err
+	}
+	if r.Monikers == nil {
+		r.Monikers = []Moniker{}
+	}
+	return nil
+}
+
+// LinkedEditingRanges represents the interface described in the specification.
+type LinkedEditingRanges struct {
+	Ranges []Range `json:"ranges"`
+
+	// WordPattern is a regular expression that describes valid contents
+	// for the ranges. It is empty if the server doesn't specify it.
+	WordPattern string `json:"wordPattern,omitempty"`
+}
+
+// LinkedEditingRangesResult represents a result object for linked editing range request.
+type LinkedEditingRangesResult struct {
+	// Ranges is nil if there are no linked ranges at the position.
+	Ranges *LinkedEditingRanges
+
+	c    *Client
+	call *Call
+}
+
+// LinkedEditingRanges sends the linked editing range request to the server.
+func (c *Client) LinkedEditingRanges(params *TextDocumentPositionParams) *LinkedEditingRangesResult {
+	const method = "textDocument/linkedEditingRange"
+	var result LinkedEditingRangesResult
+	result.c = c
+	if !c.Supports(method) {
+		result.call = c.unsupported(method, params, &result.Ranges)
+		return &result
+	}
+	result.call = c.Call(method, params, &result.Ranges)
+	return &result
+}
+
+// Wait waits for a response of linked editing range request.
+func (r *LinkedEditingRangesResult) Wait() error {
+	return r.c.Wait(r.call)
+}
+
 // DocumentLinkParams represents the interface described in the specification.
 type DocumentLinkParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
@@ -461,13 +1143,20 @@ type PublishDiagnosticsParams struct {
 // Diagnostics represents the interface described in the specification.
 type Diagnostic struct {
 	Range              Range                          `json:"range"`
-	Severity           int                            `json:"severity,omitempty"`
-	Code               string                         `json:"code,omitempty"`
+	Severity           DiagnosticSeverity             `json:"severity,omitempty"`
+	Code               *DiagnosticCode                `json:"code,omitempty"`
+	CodeDescription    *CodeDescription               `json:"codeDescription,omitempty"`
 	Source             string                         `json:"source,omitempty"`
 	Message            string                         `json:"message"`
+	Tags               []DiagnosticTag                `json:"tags,omitempty"`
 	RelatedInformation []DiagnosticRelatedInformation `json:"relatedInformation,omitempty"`
 }
 
+// CodeDescription represents the interface described in the specification.
+type CodeDescription struct {
+	Href string `json:"href"`
+}
+
 // DiagnosticRelatedInformation represents the interface described in the specification.
 type DiagnosticRelatedInformation struct {
 	Location Location `json:"location"`
@@ -0,0 +1,638 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestClientURL(t *testing.T) {
+	tests := []struct {
+		root string
+		file string
+		want DocumentURI
+	}{
+		{"/home/me/proj", "a.go", "file:///home/me/proj/a.go"},
+		{"/home/me/proj/", "a.go", "file:///home/me/proj/a.go"},
+		{"file:///home/me/proj", "a.go", "file:///home/me/proj/a.go"},
+		{"file:///home/me/proj/", "a.go", "file:///home/me/proj/a.go"},
+		{"file:///home/me/proj/", ".", "file:///home/me/proj"},
+		{"/home/me/proj/", "/tmp/b.go", "file:///tmp/b.go"},
+	}
+	for _, tt := range tests {
+		var c Client
+		if err := c.SetRootURI(tt.root); err != nil {
+			t.Fatalf("SetRootURI(%q): %v", tt.root, err)
+		}
+		if u := c.URL(tt.file); u != tt.want {
+			t.Errorf("SetRootURI(%q); URL(%q) = %q; want %q", tt.root, tt.file, u, tt.want)
+		}
+	}
+
+	c := Client{BaseURL: &url.URL{Scheme: "file", Path: "/home/me/proj/"}}
+	if u, want := c.URL("a.go"), DocumentURI("file:///home/me/proj/a.go"); u != want {
+		t.Errorf("URL(%q) = %q; want %q", "a.go", u, want)
+	}
+}
+
+func TestTextDocumentSyncOptions(t *testing.T) {
+	tests := []struct {
+		s    string
+		want TextDocumentSyncOptions
+	}{
+		{
+			s:    `0`,
+			want: TextDocumentSyncOptions{},
+		},
+		{
+			s: `2`,
+			want: TextDocumentSyncOptions{
+				OpenClose: true,
+				Change:    TextDocumentSyncKindIncremental,
+				Save:      SaveOptions{Provider: true},
+			},
+		},
+		{
+			s: `{"openClose": true, "change": 1, "save": true}`,
+			want: TextDocumentSyncOptions{
+				OpenClose: true,
+				Change:    TextDocumentSyncKindFull,
+				Save:      SaveOptions{Provider: true},
+			},
+		},
+		{
+			s: `{"change": 2, "willSave": true, "save": {"includeText": true}}`,
+			want: TextDocumentSyncOptions{
+				Change:   TextDocumentSyncKindIncremental,
+				WillSave: true,
+				Save:     SaveOptions{Provider: true, IncludeText: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		var o TextDocumentSyncOptions
+		if err := json.Unmarshal([]byte(tt.s), &o); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.s, err)
+			continue
+		}
+		if o != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v; want %+v", tt.s, o, tt.want)
+		}
+	}
+}
+
+func TestServerCapabilitiesProviders(t *testing.T) {
+	tests := []struct {
+		s    string
+		want ServerCapabilities
+	}{
+		{
+			s: `{"hoverProvider": true, "documentSymbolProvider": false, "renameProvider": true}`,
+			want: ServerCapabilities{
+				HoverProvider:  true,
+				RenameProvider: RenameOptions{Provider: true},
+			},
+		},
+		{
+			s: `{
+				"hoverProvider": {"workDoneProgress": true},
+				"definitionProvider": {},
+				"referencesProvider": {},
+				"documentSymbolProvider": {"label": "gopls"},
+				"documentHighlightProvider": {},
+				"workspaceSymbolProvider": {"resolveProvider": true},
+				"renameProvider": {"prepareProvider": true}
+			}`,
+			want: ServerCapabilities{
+				HoverProvider:             true,
+				DefinitionProvider:        true,
+				ReferencesProvider:        true,
+				DocumentSymbolProvider:    true,
+				DocumentHighlightProvider: true,
+				WorkspaceSymbolProvider:   true,
+				RenameProvider:            RenameOptions{Provider: true, PrepareProvider: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		var cap ServerCapabilities
+		if err := json.Unmarshal([]byte(tt.s), &cap); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(cap, tt.want) {
+			t.Errorf("Unmarshal(%s) = %+v; want %+v", tt.s, cap, tt.want)
+		}
+	}
+}
+
+func TestClientDidOpenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.py")
+	if err := ioutil.WriteFile(file, []byte("print(1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	uri := DocumentURI("file://" + filepath.ToSlash(file))
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.DidOpenFile(uri, "")
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	var params DidOpenTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	want := TextDocumentItem{
+		URI:        uri,
+		LanguageID: "python",
+		Version:    1,
+		Text:       "print(1)\n",
+	}
+	if params.TextDocument != want {
+		t.Errorf("didOpen = %+v; want %+v", params.TextDocument, want)
+	}
+	if err := c.DidOpenFile(uri, ""); err == nil {
+		t.Errorf("DidOpenFile twice: succeeded")
+	}
+}
+
+func TestClientDidChangeValidatesRanges(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	const uri = "file:///home/me/a.go"
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.DidOpenTextDocument(&DidOpenTextDocumentParams{
+			TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: "package a\n"},
+		})
+	}()
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	change := func(version int, r Range, text string) *DidChangeTextDocumentParams {
+		return &DidChangeTextDocumentParams{
+			TextDocument: VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+				Version:                &version,
+			},
+			ContentChanges: []TextDocumentContentChangeEvent{{Range: &r, Text: text}},
+		}
+	}
+	// line 1 is empty after the newline; character 1 of it doesn't exist.
+	bad := change(2, Range{Start: Position{Line: 1, Character: 1}, End: Position{Line: 1, Character: 1}}, "x")
+	if err := c.DidChangeTextDocument(bad); !xerrors.Is(err, ErrInvalidRange) {
+		t.Fatalf("DidChangeTextDocument = %v; want %v", err, ErrInvalidRange)
+	}
+	if v, _ := c.version(uri); v != 1 {
+		t.Errorf("version = %d after the invalid change; want 1", v)
+	}
+
+	// the invalid change must not be sent; the next message is the valid one.
+	good := change(2, Range{Start: Position{Line: 1}, End: Position{Line: 1}}, "var x int\n")
+	go func() {
+		errc <- c.DidChangeTextDocument(good)
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	var params DidChangeTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if v := params.TextDocument.Version; v == nil || *v != 2 {
+		t.Errorf("sent version = %v; want 2", v)
+	}
+	if text, _ := c.text(uri); text != "package a\nvar x int\n" {
+		t.Errorf("tracked text = %q; want the changed one", text)
+	}
+}
+
+func TestClientInitializeSendsInitialized(t *testing.T) {
+	tests := []struct {
+		opts []Option
+		want string // method sent after initialize
+	}{
+		{nil, "initialized"},
+		{[]Option{ManualInitialized()}, "test/request"},
+	}
+	for _, tt := range tests {
+		c, s := newPipeClient(t, tt.opts...)
+		r := c.Initialize(&InitializeParams{RootURI: "file:///home/me/a"})
+		msg, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`{"capabilities":{}}`)}); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			if r.Wait() == nil {
+				c.Call("test/request", nil, nil)
+				c.Initialized(&InitializedParams{})
+			}
+		}()
+		msg, err = s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != tt.want {
+			t.Errorf("method = %q; want %q", msg.Method, tt.want)
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestClientServerInfo(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	if name, version := c.ServerInfo(); name != "" || version != "" {
+		t.Errorf("ServerInfo before initialize = %q, %q; want empty", name, version)
+	}
+	s.initialize(t, c, `{"capabilities":{},"serverInfo":{"name":"gopls","version":"v0.14.2"}}`)
+	if name, version := c.ServerInfo(); name != "gopls" || version != "v0.14.2" {
+		t.Errorf("ServerInfo = %q, %q; want %q, %q", name, version, "gopls", "v0.14.2")
+	}
+}
+
+func TestClientInitializeResult(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	resp := `{
+		"capabilities": {
+			"textDocumentSync": 2,
+			"hoverProvider": true,
+			"definitionProvider": {"workDoneProgress": true},
+			"completionProvider": {"triggerCharacters": ["."]}
+		},
+		"serverInfo": {"name": "gopls"}
+	}`
+	r := s.initialize(t, c, resp)
+	if r.ServerInfo == nil || r.ServerInfo.Name != "gopls" {
+		t.Errorf("ServerInfo = %+v; want gopls", r.ServerInfo)
+	}
+	if k := c.SyncKind(); k != TextDocumentSyncKindIncremental {
+		t.Errorf("SyncKind = %d; want %d", k, TextDocumentSyncKindIncremental)
+	}
+	for _, method := range []string{"textDocument/definition", "textDocument/completion"} {
+		if !c.Supports(method) {
+			t.Errorf("Supports(%q) = false; want true", method)
+		}
+	}
+	if c.Supports("textDocument/references") {
+		t.Errorf("Supports(%q) = true; want false", "textDocument/references")
+	}
+}
+
+func TestPositionBefore(t *testing.T) {
+	tests := []struct {
+		p, q Position
+		want bool
+	}{
+		{Position{1, 2}, Position{1, 3}, true},
+		{Position{1, 3}, Position{1, 2}, false},
+		{Position{1, 9}, Position{2, 0}, true},
+		{Position{1, 2}, Position{1, 2}, false},
+	}
+	for _, tt := range tests {
+		if v := tt.p.Before(tt.q); v != tt.want {
+			t.Errorf("%v.Before(%v) = %t; want %t", tt.p, tt.q, v, tt.want)
+		}
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	r := Range{Start: Position{1, 2}, End: Position{2, 0}}
+	tests := []struct {
+		r    Range
+		pos  Position
+		want bool
+	}{
+		{r, Position{1, 2}, true},
+		{r, Position{1, 50}, true},
+		{r, Position{2, 0}, false},
+		{r, Position{1, 1}, false},
+		{Range{Start: Position{3, 4}, End: Position{3, 4}}, Position{3, 4}, true},
+		{Range{Start: Position{3, 4}, End: Position{3, 4}}, Position{3, 5}, false},
+	}
+	for _, tt := range tests {
+		if v := tt.r.Contains(tt.pos); v != tt.want {
+			t.Errorf("%v.Contains(%v) = %t; want %t", tt.r, tt.pos, v, tt.want)
+		}
+	}
+}
+
+func TestRangeOverlaps(t *testing.T) {
+	tests := []struct {
+		r1, r2 Range
+		want   bool
+	}{
+		{Range{Position{1, 0}, Position{1, 5}}, Range{Position{1, 3}, Position{2, 0}}, true},
+		{Range{Position{1, 0}, Position{1, 5}}, Range{Position{1, 5}, Position{2, 0}}, false},
+		{Range{Position{1, 0}, Position{3, 0}}, Range{Position{2, 0}, Position{2, 1}}, true},
+		{Range{Position{1, 0}, Position{1, 1}}, Range{Position{2, 0}, Position{2, 1}}, false},
+	}
+	for _, tt := range tests {
+		if v := tt.r1.Overlaps(tt.r2); v != tt.want {
+			t.Errorf("%v.Overlaps(%v) = %t; want %t", tt.r1, tt.r2, v, tt.want)
+		}
+		if v := tt.r2.Overlaps(tt.r1); v != tt.want {
+			t.Errorf("%v.Overlaps(%v) = %t; want %t", tt.r2, tt.r1, v, tt.want)
+		}
+	}
+}
+
+func TestEnvLocale(t *testing.T) {
+	tests := []struct {
+		all, messages, lang string
+		want                string
+	}{
+		{lang: "ja_JP.UTF-8", want: "ja-JP"},
+		{lang: "de_DE@euro", want: "de-DE"},
+		{lang: "en", want: "en"},
+		{lang: "C", want: ""},
+		{lang: "POSIX", want: ""},
+		{messages: "fr_FR.UTF-8", lang: "en_US.UTF-8", want: "fr-FR"},
+		{all: "C.UTF-8", lang: "en_US.UTF-8", want: ""},
+		{want: ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("LC_ALL", tt.all)
+		t.Setenv("LC_MESSAGES", tt.messages)
+		t.Setenv("LANG", tt.lang)
+		if s := envLocale(); s != tt.want {
+			t.Errorf("envLocale() with LC_ALL=%q LC_MESSAGES=%q LANG=%q = %q; want %q", tt.all, tt.messages, tt.lang, s, tt.want)
+		}
+	}
+}
+
+// wrapperTest describes a request wrapper for TestClientRequestWrappers.
+type wrapperTest struct {
+	method string
+	enable func(cap *ServerCapabilities)
+
+	// call sends the request, then returns a function to wait for it and the result.
+	call   func(c *Client) (wait func() error, result func() interface{})
+	params string // params on the wire
+
+	reply string      // populated result from the server
+	want  interface{} // result of reply
+	empty interface{} // result of null
+}
+
+var wrapperTests = []wrapperTest{
+	{
+		method: "textDocument/prepareCallHierarchy",
+		enable: func(cap *ServerCapabilities) { cap.CallHierarchyProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.PrepareCallHierarchy(&TextDocumentPositionParams{
+				TextDocument: TextDocumentIdentifier{URI: "file:///a.go"},
+				Position:     Position{Line: 1, Character: 2},
+			})
+			return r.Wait, func() interface{} { return r.Items }
+		},
+		params: `{"textDocument":{"uri":"file:///a.go"},"position":{"line":1,"character":2}}`,
+		reply:  `[{"name":"f","kind":12,"uri":"file:///a.go","data":{"id":1}}]`,
+		want:   []CallHierarchyItem{{Name: "f", Kind: 12, URI: "file:///a.go", Data: json.RawMessage(`{"id":1}`)}},
+		empty:  []CallHierarchyItem{},
+	},
+	{
+		method: "callHierarchy/incomingCalls",
+		enable: func(cap *ServerCapabilities) { cap.CallHierarchyProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.IncomingCalls(&CallHierarchyIncomingCallsParams{Item: CallHierarchyItem{Name: "f"}})
+			return r.Wait, func() interface{} { return r.Calls }
+		},
+		params: `{"item":{"name":"f","kind":0,"uri":"","range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"selectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}}}}`,
+		reply:  `[{"from":{"name":"g"},"fromRanges":[]}]`,
+		want:   []CallHierarchyIncomingCall{{From: CallHierarchyItem{Name: "g"}, FromRanges: []Range{}}},
+		empty:  []CallHierarchyIncomingCall{},
+	},
+	{
+		method: "callHierarchy/outgoingCalls",
+		enable: func(cap *ServerCapabilities) { cap.CallHierarchyProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.OutgoingCalls(&CallHierarchyOutgoingCallsParams{Item: CallHierarchyItem{Name: "f"}})
+			return r.Wait, func() interface{} { return r.Calls }
+		},
+		params: `{"item":{"name":"f","kind":0,"uri":"","range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"selectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}}}}`,
+		reply:  `[{"to":{"name":"h"},"fromRanges":[]}]`,
+		want:   []CallHierarchyOutgoingCall{{To: CallHierarchyItem{Name: "h"}, FromRanges: []Range{}}},
+		empty:  []CallHierarchyOutgoingCall{},
+	},
+	{
+		method: "textDocument/prepareTypeHierarchy",
+		enable: func(cap *ServerCapabilities) { cap.TypeHierarchyProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.PrepareTypeHierarchy(&TextDocumentPositionParams{
+				TextDocument: TextDocumentIdentifier{URI: "file:///a.go"},
+			})
+			return r.Wait, func() interface{} { return r.Items }
+		},
+		params: `{"textDocument":{"uri":"file:///a.go"},"position":{"line":0,"character":0}}`,
+		reply:  `[{"name":"T","kind":23,"uri":"file:///a.go"}]`,
+		want:   []TypeHierarchyItem{{Name: "T", Kind: 23, URI: "file:///a.go"}},
+		empty:  []TypeHierarchyItem{},
+	},
+	{
+		method: "typeHierarchy/supertypes",
+		enable: func(cap *ServerCapabilities) { cap.TypeHierarchyProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.Supertypes(&TypeHierarchySupertypesParams{Item: TypeHierarchyItem{Name: "T", Data: json.RawMessage(`1`)}})
+			return r.Wait, func() interface{} { return r.Items }
+		},
+		params: `{"item":{"name":"T","kind":0,"uri":"","range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"selectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"data":1}}`,
+		reply:  `[{"name":"I","kind":11}]`,
+		want:   []TypeHierarchyItem{{Name: "I", Kind: 11}},
+		empty:  []TypeHierarchyItem{},
+	},
+	{
+		method: "typeHierarchy/subtypes",
+		enable: func(cap *ServerCapabilities) { cap.TypeHierarchyProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.Subtypes(&TypeHierarchySubtypesParams{Item: TypeHierarchyItem{Name: "I"}})
+			return r.Wait, func() interface{} { return r.Items }
+		},
+		params: `{"item":{"name":"I","kind":0,"uri":"","range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"selectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}}}}`,
+		reply:  `[{"name":"T","kind":23}]`,
+		want:   []TypeHierarchyItem{{Name: "T", Kind: 23}},
+		empty:  []TypeHierarchyItem{},
+	},
+	{
+		method: "textDocument/documentColor",
+		enable: func(cap *ServerCapabilities) { cap.ColorProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.DocumentColor(&DocumentColorParams{TextDocument: TextDocumentIdentifier{URI: "file:///a.css"}})
+			return r.Wait, func() interface{} { return r.Colors }
+		},
+		params: `{"textDocument":{"uri":"file:///a.css"}}`,
+		reply:  `[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":4}},"color":{"red":1,"green":0.5,"blue":0,"alpha":1}}]`,
+		want: []ColorInformation{{
+			Range: Range{Start: Position{Line: 1}, End: Position{Line: 1, Character: 4}},
+			Color: Color{Red: 1, Green: 0.5, Alpha: 1},
+		}},
+		empty: []ColorInformation{},
+	},
+	{
+		method: "textDocument/colorPresentation",
+		enable: func(cap *ServerCapabilities) { cap.ColorProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.ColorPresentation(&ColorPresentationParams{
+				TextDocument: TextDocumentIdentifier{URI: "file:///a.css"},
+				Color:        Color{Red: 1, Alpha: 1},
+			})
+			return r.Wait, func() interface{} { return r.Presentations }
+		},
+		params: `{"textDocument":{"uri":"file:///a.css"},"color":{"red":1,"green":0,"blue":0,"alpha":1},"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}}}`,
+		reply:  `[{"label":"#ff0000"}]`,
+		want:   []ColorPresentation{{Label: "#ff0000"}},
+		empty:  []ColorPresentation{},
+	},
+	{
+		method: "textDocument/moniker",
+		enable: func(cap *ServerCapabilities) { cap.MonikerProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.Moniker(&TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: "file:///a.go"}})
+			return r.Wait, func() interface{} { return r.Monikers }
+		},
+		params: `{"textDocument":{"uri":"file:///a.go"},"position":{"line":0,"character":0}}`,
+		reply:  `[{"scheme":"gomod","identifier":"fmt.Println","unique":"global","kind":"import"}]`,
+		want:   []Moniker{{Scheme: "gomod", Identifier: "fmt.Println", Unique: UniquenessLevelGlobal, Kind: MonikerKindImport}},
+		empty:  []Moniker{},
+	},
+	{
+		method: "textDocument/linkedEditingRange",
+		enable: func(cap *ServerCapabilities) { cap.LinkedEditingRangeProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.LinkedEditingRanges(&TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: "file:///a.html"}})
+			return r.Wait, func() interface{} { return r.Ranges }
+		},
+		params: `{"textDocument":{"uri":"file:///a.html"},"position":{"line":0,"character":0}}`,
+		reply:  `{"ranges":[{"start":{"line":0,"character":1},"end":{"line":0,"character":4}}],"wordPattern":"[a-z]+"}`,
+		want: &LinkedEditingRanges{
+			Ranges:      []Range{{Start: Position{Character: 1}, End: Position{Character: 4}}},
+			WordPattern: "[a-z]+",
+		},
+		empty: (*LinkedEditingRanges)(nil), // no linked ranges
+	},
+	{
+		method: "textDocument/rangeFormatting",
+		enable: func(cap *ServerCapabilities) { cap.DocumentRangeFormattingProvider = true },
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.RangeFormatting(&DocumentRangeFormattingParams{
+				TextDocument: TextDocumentIdentifier{URI: "file:///a.go"},
+				Range:        Range{End: Position{Line: 2}},
+				Options:      FormattingOptions{TabSize: 8},
+			})
+			return r.Wait, func() interface{} { return r.TextEdits }
+		},
+		params: `{"textDocument":{"uri":"file:///a.go"},"range":{"start":{"line":0,"character":0},"end":{"line":2,"character":0}},"options":{"tabSize":8,"insertSpaces":false}}`,
+		reply:  `[{"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":4}},"newText":"\t"}]`,
+		want:   []TextEdit{{Range: Range{Start: Position{Line: 1}, End: Position{Line: 1, Character: 4}}, NewText: "\t"}},
+		empty:  []TextEdit(nil), // TextEditsResult leaves null as is
+	},
+	{
+		method: "textDocument/onTypeFormatting",
+		enable: func(cap *ServerCapabilities) {
+			cap.DocumentOnTypeFormattingProvider = &DocumentOnTypeFormattingOptions{FirstTriggerCharacter: "}"}
+		},
+		call: func(c *Client) (func() error, func() interface{}) {
+			r := c.OnTypeFormatting(&DocumentOnTypeFormattingParams{
+				TextDocument: TextDocumentIdentifier{URI: "file:///a.go"},
+				Position:     Position{Line: 3, Character: 1},
+				Ch:           "}",
+				Options:      FormattingOptions{TabSize: 4},
+			})
+			return r.Wait, func() interface{} { return r.TextEdits }
+		},
+		params: `{"textDocument":{"uri":"file:///a.go"},"position":{"line":3,"character":1},"ch":"}","options":{"tabSize":4,"insertSpaces":false}}`,
+		reply:  `[{"range":{"start":{"line":3,"character":0},"end":{"line":3,"character":0}},"newText":"\t"}]`,
+		want:   []TextEdit{{Range: Range{Start: Position{Line: 3}, End: Position{Line: 3}}, NewText: "\t"}},
+		empty:  []TextEdit(nil),
+	},
+}
+
+func TestClientRequestWrappers(t *testing.T) {
+	for _, tt := range wrapperTests {
+		t.Run(tt.method, func(t *testing.T) {
+			c, s := newPipeClient(t)
+			defer c.Close()
+			defer s.Close()
+
+			wait, _ := tt.call(c)
+			if err := wait(); !xerrors.Is(err, ErrUnsupported) {
+				t.Errorf("without capability: Wait = %v; want %v", err, ErrUnsupported)
+			}
+			tt.enable(&c.cap)
+			for _, reply := range []struct {
+				result string
+				want   interface{}
+			}{
+				{"null", tt.empty},
+				{tt.reply, tt.want},
+			} {
+				wait, result := tt.call(c)
+				msg, err := s.read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Method != tt.method {
+					t.Errorf("method = %q; want %q", msg.Method, tt.method)
+				}
+				var params, want interface{}
+				if err := json.Unmarshal(msg.Params, &params); err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal([]byte(tt.params), &want); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(params, want) {
+					t.Errorf("params = %s; want %s", msg.Params, tt.params)
+				}
+				if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(reply.result)}); err != nil {
+					t.Fatal(err)
+				}
+				if err := wait(); err != nil {
+					t.Fatalf("Wait: %v", err)
+				}
+				if v := result(); !reflect.DeepEqual(v, reply.want) {
+					t.Errorf("result of %s = %#v; want %#v", reply.result, v, reply.want)
+				}
+			}
+		})
+	}
+}
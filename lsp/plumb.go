@@ -0,0 +1,98 @@
+package lsp
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// LocationToPlumb returns a plumb message "file:line:col" that opens loc in acme.
+// Line and col are 1-based, and col is counted in runes.
+// The column is converted from UTF-16 code units with the file on disk;
+// if it can't be read, the column is used as is, which is exact for ASCII text.
+func LocationToPlumb(loc Location) (string, error) {
+	return locationToPlumb(loc, readURI)
+}
+
+// LocationToPlumb is like LocationToPlumb, but the column is converted with
+// the text that c.Content returns, so it is exact for documents that are not saved.
+func (c *Client) LocationToPlumb(loc Location) (string, error) {
+	return locationToPlumb(loc, c.Content)
+}
+
+func locationToPlumb(loc Location, read func(uri DocumentURI) (string, error)) (string, error) {
+	file, err := uriToPath(loc.URI)
+	if err != nil {
+		return "", err
+	}
+	pos := loc.Range.Start
+	col := pos.Character
+	if text, err := read(loc.URI); err == nil {
+		col = runeOffset(text, pos) - runeOffset(text, Position{Line: pos.Line})
+	}
+	return fmt.Sprintf("%s:%d:%d", file, pos.Line+1, col+1), nil
+}
+
+// NewPositionParams returns the params pointing line and col of file.
+// It is the inverse of LocationToPlumb: line and col are 1-based, and col is counted in runes.
+// A relative path is resolved from the current directory.
+// The column is converted to UTF-16 code units with the file on disk;
+// if it can't be read, the column is used as is.
+func NewPositionParams(file string, line, col int) (*TextDocumentPositionParams, error) {
+	return newPositionParams(file, line, col, readURI)
+}
+
+// NewPositionParams is like NewPositionParams, but the column is converted with
+// the text that c.Content returns, so it is exact for documents that are not saved.
+func (c *Client) NewPositionParams(file string, line, col int) (*TextDocumentPositionParams, error) {
+	return newPositionParams(file, line, col, c.Content)
+}
+
+func newPositionParams(file string, line, col int, read func(uri DocumentURI) (string, error)) (*TextDocumentPositionParams, error) {
+	if line < 1 || col < 1 {
+		return nil, xerrors.Errorf("invalid position %d:%d", line, col)
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	uri := DocumentURI(fileSchema + path.Clean(filepath.ToSlash(file)))
+	pos := Position{Line: line - 1, Character: col - 1}
+	if text, err := read(uri); err == nil {
+		pos.Character = utf16Column(text, pos)
+	}
+	return &TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     pos,
+	}, nil
+}
+
+// utf16Column returns the number of UTF-16 code units of the first pos.Character runes
+// of the line pos.Line in text.
+func utf16Column(text string, pos Position) int {
+	s := text
+	for line := 0; line < pos.Line; line++ {
+		_, next := lineEnd(s)
+		if next < 0 {
+			return pos.Character
+		}
+		s = s[next:]
+	}
+	if i, _ := lineEnd(s); i >= 0 {
+		s = s[:i]
+	}
+	var col int
+	for n := 0; n < pos.Character; n++ {
+		r, size := utf8.DecodeRuneInString(s)
+		if size == 0 {
+			// past the end of line; count the rest as is.
+			return col + pos.Character - n
+		}
+		col += utf16Len(r)
+		s = s[size:]
+	}
+	return col
+}
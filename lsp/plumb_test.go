@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocationToPlumb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a\n\nvar 😀, x int\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "b.go")
+
+	tests := []struct {
+		loc  Location
+		want string
+	}{
+		{Location{URI: DocumentURI(fileSchema + file)}, file + ":1:1"},
+		{
+			Location{
+				URI:   DocumentURI(fileSchema + file),
+				Range: Range{Start: Position{Line: 2, Character: 8}},
+			},
+			file + ":3:8",
+		},
+		{
+			Location{
+				URI:   DocumentURI(fileSchema + missing),
+				Range: Range{Start: Position{Line: 4, Character: 2}},
+			},
+			missing + ":5:3",
+		},
+	}
+	for _, tt := range tests {
+		s, err := LocationToPlumb(tt.loc)
+		if err != nil {
+			t.Errorf("LocationToPlumb(%v): %v", tt.loc, err)
+			continue
+		}
+		if s != tt.want {
+			t.Errorf("LocationToPlumb(%v) = %q; want %q", tt.loc, s, tt.want)
+		}
+	}
+	if _, err := LocationToPlumb(Location{URI: "https://example.com/a.go"}); err == nil {
+		t.Errorf("LocationToPlumb should fail for a non-file URI")
+	}
+}
+
+func TestNewPositionParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a\n\nvar 😀, x int\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "b.go")
+
+	tests := []struct {
+		file      string
+		line, col int
+		want      Position
+	}{
+		{file, 1, 1, Position{}},
+		{file, 3, 8, Position{Line: 2, Character: 8}},
+		{missing, 5, 3, Position{Line: 4, Character: 2}},
+	}
+	for _, tt := range tests {
+		p, err := NewPositionParams(tt.file, tt.line, tt.col)
+		if err != nil {
+			t.Errorf("NewPositionParams(%q, %d, %d): %v", tt.file, tt.line, tt.col, err)
+			continue
+		}
+		if uri := p.TextDocument.URI; uri != DocumentURI(fileSchema+tt.file) {
+			t.Errorf("NewPositionParams(%q, %d, %d).URI = %q; want %q", tt.file, tt.line, tt.col, string(uri), fileSchema+tt.file)
+		}
+		if p.Position != tt.want {
+			t.Errorf("NewPositionParams(%q, %d, %d).Position = %v; want %v", tt.file, tt.line, tt.col, p.Position, tt.want)
+		}
+		s, err := LocationToPlumb(Location{URI: p.TextDocument.URI, Range: Range{Start: p.Position}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("%s:%d:%d", tt.file, tt.line, tt.col); s != want {
+			t.Errorf("LocationToPlumb(NewPositionParams(...)) = %q; want %q", s, want)
+		}
+	}
+	if _, err := NewPositionParams(file, 0, 1); err == nil {
+		t.Errorf("NewPositionParams should fail for line 0")
+	}
+}
+
+func TestClientLocationToPlumb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.go") // not saved yet
+	uri := DocumentURI(fileSchema + file)
+
+	var c Client
+	c.SetContentProvider(ContentProviderFunc(func(u DocumentURI) (string, error) {
+		return "package a\n\nvar 😀, x int\n", nil
+	}))
+	p, err := c.NewPositionParams(file, 3, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TextDocument.URI != uri {
+		t.Errorf("URI = %q; want %q", string(p.TextDocument.URI), string(uri))
+	}
+	if want := (Position{Line: 2, Character: 8}); p.Position != want {
+		t.Errorf("Position = %v; want %v", p.Position, want)
+	}
+	s, err := c.LocationToPlumb(Location{URI: uri, Range: Range{Start: p.Position}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := file + ":3:8"; s != want {
+		t.Errorf("LocationToPlumb = %q; want %q", s, want)
+	}
+}
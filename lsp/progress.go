@@ -0,0 +1,236 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// ProgressToken represents the interface described in the specification.
+// A token of number is converted to its decimal string.
+type ProgressToken string
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (t *ProgressToken) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = ProgressToken(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*t = ProgressToken(n.String())
+	return nil
+}
+
+// PartialResultParams represents the interface described in the specification.
+type PartialResultParams struct {
+	PartialResultToken ProgressToken `json:"partialResultToken,omitempty"`
+}
+
+// WorkDoneProgressParams represents the interface described in the specification.
+type WorkDoneProgressParams struct {
+	WorkDoneToken ProgressToken `json:"workDoneToken,omitempty"`
+}
+
+// WorkDoneProgress kinds.
+const (
+	WorkDoneProgressBegin  = "begin"
+	WorkDoneProgressReport = "report"
+	WorkDoneProgressEnd    = "end"
+)
+
+// WorkDoneProgress represents WorkDoneProgressBegin, WorkDoneProgressReport
+// and WorkDoneProgressEnd described in the specification.
+type WorkDoneProgress struct {
+	Kind        string `json:"kind"`
+	Title       string `json:"title,omitempty"` // only for begin
+	Cancellable bool   `json:"cancellable,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Percentage  *int   `json:"percentage,omitempty"`
+}
+
+// ProgressParams represents the interface described in the specification.
+type ProgressParams struct {
+	Token ProgressToken   `json:"token"`
+	Value json.RawMessage `json:"value"`
+}
+
+// newProgressToken returns a token that is unique in c.
+func (c *Client) newProgressToken() ProgressToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastToken++
+	return ProgressToken("acme-lsp-" + strconv.Itoa(c.lastToken))
+}
+
+// callPartial calls the method like Call, then f is called with each value of
+// $/progress notifications for token until the response is received.
+// The f is called in order on a goroutine of the returned queue, so it can wait for other responses;
+// wait on the queue after the call to ensure f has returned for all values.
+func (c *Client) callPartial(method string, args, reply interface{}, token ProgressToken, f func(value json.RawMessage)) (*Call, *partialQueue) {
+	call, err := c.newCall(method, args, reply)
+	if err != nil {
+		return failedCall(method, args, reply, err), nil
+	}
+	q := c.addPartial(call, token, f)
+	return c.send(call), q
+}
+
+func (c *Client) addPartial(call *Call, token ProgressToken, f func(value json.RawMessage)) *partialQueue {
+	call.tokens = append(call.tokens, token)
+	q := newPartialQueue(f)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.partials == nil {
+		c.partials = make(map[ProgressToken]*partialQueue)
+	}
+	c.partials[token] = q
+	return q
+}
+
+// deletePartials unregisters the tokens of call. Their queues are closed
+// after values already received are passed to the callbacks.
+func (c *Client) deletePartials(call *Call) {
+	if len(call.tokens) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, token := range call.tokens {
+		if q := c.partials[token]; q != nil {
+			q.close()
+		}
+		delete(c.partials, token)
+	}
+}
+
+// progress passes the value in msg to the queue registered for its token.
+// It returns false if msg isn't a partial result of any active calls.
+func (c *Client) progress(msg *Message) bool {
+	var params ProgressParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return false
+	}
+	c.mu.Lock()
+	q := c.partials[params.Token]
+	c.mu.Unlock()
+	if q == nil {
+		return false
+	}
+	q.push(params.Value)
+	return true
+}
+
+// partialQueue passes values of $/progress notifications to a callback on its own goroutine,
+// so that the goroutine receiving messages isn't blocked by the callback.
+type partialQueue struct {
+	f     func(value json.RawMessage)
+	mu    sync.Mutex
+	a     []json.RawMessage
+	eof   bool
+	ready chan struct{}
+	done  chan struct{} // closed when all values are passed to f after close
+}
+
+func newPartialQueue(f func(value json.RawMessage)) *partialQueue {
+	q := &partialQueue{
+		f:     f,
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *partialQueue) push(value json.RawMessage) {
+	q.mu.Lock()
+	q.a = append(q.a, value)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// close stops q after the pending values are passed to f.
+func (q *partialQueue) close() {
+	q.mu.Lock()
+	q.eof = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *partialQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits for q to be closed and drained. It is no-op if q is nil.
+func (q *partialQueue) wait() {
+	if q != nil {
+		<-q.done
+	}
+}
+
+func (q *partialQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		a, eof := q.a, q.eof
+		q.a = nil
+		q.mu.Unlock()
+		for _, v := range a {
+			q.f(v)
+		}
+		if len(a) == 0 {
+			if eof {
+				return
+			}
+			<-q.ready
+		}
+	}
+}
+
+// ReportWorkDone returns an option to receive the progress of requests.
+// The client adds a workDoneToken to params of each request, and f is called with
+// the call and the value of $/progress notifications bearing the token.
+// Requests whose params are not JSON objects or already have a workDoneToken are sent as is.
+// The f is called in order on another goroutine, and it may be called for the last values
+// after the call completed.
+func ReportWorkDone(f func(call *Call, p *WorkDoneProgress)) Option {
+	return func(c *Client) {
+		c.workDone = f
+	}
+}
+
+// reportWorkDone adds a new workDoneToken to params of call.
+func (c *Client) reportWorkDone(call *Call) {
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(call.msg.Params, &params); err != nil || params == nil {
+		return
+	}
+	if _, ok := params["workDoneToken"]; ok {
+		return
+	}
+	token := c.newProgressToken()
+	b, err := json.Marshal(token)
+	if err != nil {
+		return
+	}
+	params["workDoneToken"] = b
+	b, err = json.Marshal(params)
+	if err != nil {
+		return
+	}
+	call.msg.Params = b
+	c.addPartial(call, token, func(value json.RawMessage) {
+		var p WorkDoneProgress
+		if err := json.Unmarshal(value, &p); err != nil {
+			c.debugf("can't decode work done progress of %s: %v\n", call.Method, err)
+			return
+		}
+		c.workDone(call, &p)
+	})
+}
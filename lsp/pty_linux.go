@@ -0,0 +1,118 @@
+//go:build linux
+// +build linux
+
+package lsp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/xerrors"
+)
+
+// OpenCommandPTY is like OpenCommand, but attaches stdin and stdout of the command
+// to a pseudo-terminal for servers that change behavior if they aren't on a terminal.
+// The terminal is in raw mode, so messages pass through it unchanged.
+// Stderr of the command is os.Stderr.
+func OpenCommandPTY(name string, args ...string) (*PipeConn, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, xerrors.Errorf("can't open pty for %s: %w", name, err)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    0, // stdin of the child
+	}
+	err = cmd.Start()
+	slave.Close()
+	if err != nil {
+		master.Close()
+		if xerrors.Is(err, exec.ErrNotFound) {
+			return nil, xerrors.Errorf("language server '%s' not found in PATH: %w", name, err)
+		}
+		return nil, xerrors.Errorf("can't start %s: %w", name, err)
+	}
+	return &PipeConn{cmd: cmd, r: ptyReader{master}, w: master}, nil
+}
+
+// ptyReader reads from the master of a pty. PipeConn closes both r and w,
+// so Close does nothing; the master is closed as w.
+type ptyReader struct {
+	f *os.File
+}
+
+// Read reports io.EOF instead of EIO that Linux returns after the slave is closed.
+func (r ptyReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if xerrors.Is(err, syscall.EIO) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r ptyReader) Close() error {
+	return nil
+}
+
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+		}
+	}()
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		return nil, nil, err
+	}
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		return nil, nil, err
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := makeRaw(slave.Fd()); err != nil {
+		slave.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// makeRaw sets the terminal of fd to raw mode like cfmakeraw(3).
+func makeRaw(fd uintptr) error {
+	var t syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&t)); err != nil {
+		return err
+	}
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	return ioctl(fd, syscall.TCSETS, unsafe.Pointer(&t))
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestOpenCommandPTY(t *testing.T) {
+	conn, err := OpenCommandPTY("cat")
+	if err != nil {
+		t.Skipf("OpenCommandPTY: %v", err)
+	}
+	defer conn.Close()
+
+	// cat echoes messages back; they pass through the terminal unchanged in raw mode.
+	c := &Client{conn: conn}
+	msg := &Message{Version: "2.0", ID: 1, Method: "test/echo", Params: json.RawMessage(`{"s":"a\r\nb"}`)}
+	if err := c.writeJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.readMessage(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != msg.Method || string(got.Params) != string(msg.Params) {
+		t.Errorf("echo = %+v; want %+v", got, msg)
+	}
+}
+
+func TestOpenCommandPTYIsTerminal(t *testing.T) {
+	conn, err := OpenCommandPTY("sh", "-c", "test -t 0 && test -t 1 && echo tty")
+	if err != nil {
+		t.Skipf("OpenCommandPTY: %v", err)
+	}
+	defer conn.Close()
+	b, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "tty\n" {
+		t.Errorf("output = %q; want %q", s, "tty\n")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package lsp
+
+import (
+	"runtime"
+
+	"golang.org/x/xerrors"
+)
+
+// OpenCommandPTY is like OpenCommand, but attaches stdin and stdout of the command
+// to a pseudo-terminal. It is supported only on Linux.
+func OpenCommandPTY(name string, args ...string) (*PipeConn, error) {
+	return nil, xerrors.Errorf("can't open pty for %s: not supported on %s", name, runtime.GOOS)
+}
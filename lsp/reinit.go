@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// ReinitializeOnReset returns an option to recover from a server that restarts
+// underneath a persistent connection. When a request fails with
+// CodeServerNotInitialized, the client sends initialize and initialized again
+// with the last InitializeParams, reopens documents that were open,
+// then retries the request once.
+// Documents are reopened with the texts and language identifiers that were sent to the server;
+// if the text of a document is not tracked, it is read with Content.
+// Do can't send $/cancelRequest for requests retried by this option.
+func ReinitializeOnReset() Option {
+	return func(c *Client) {
+		c.Use(c.reinitInterceptor)
+	}
+}
+
+// reinitState records the lifecycle to re-run initialize.
+type reinitState struct {
+	mu     sync.Mutex // serializes initialize
+	params *InitializeParams
+	gen    int // incremented by each initialize; guarded by Client.mu
+}
+
+// lifecycleMethods are passed through the interceptor without retries.
+var lifecycleMethods = map[string]bool{
+	"initialize":  true,
+	"initialized": true,
+	"shutdown":    true,
+	"exit":        true,
+}
+
+func (c *Client) reinitInterceptor(next CallFunc) CallFunc {
+	return func(method string, args, reply interface{}) *Call {
+		if reply == nil || lifecycleMethods[method] {
+			return next(method, args, reply)
+		}
+		gen := c.initGeneration()
+		call := &Call{
+			Method: method,
+			Args:   args,
+			Reply:  reply,
+			done:   make(chan *Call, 1),
+		}
+		go func() {
+			err := next(method, args, reply).Wait()
+			if isNotInitialized(err) {
+				if e := c.reinitialize(gen); e != nil {
+					err = xerrors.Errorf("%w (reinitialize: %v)", err, e)
+				} else {
+					err = next(method, args, reply).Wait()
+				}
+			}
+			call.Error = err
+			call.done <- call
+		}()
+		return call
+	}
+}
+
+func isNotInitialized(err error) bool {
+	var e *ResponseError
+	return xerrors.As(err, &e) && e.Code == CodeServerNotInitialized
+}
+
+func (c *Client) initGeneration() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reinit.gen
+}
+
+// reinitialize sends initialize and initialized again unless another call
+// has already done it since gen.
+func (c *Client) reinitialize(gen int) error {
+	c.reinit.mu.Lock()
+	defer c.reinit.mu.Unlock()
+	c.mu.Lock()
+	params := c.reinit.params
+	done := c.reinit.gen != gen
+	if !done {
+		c.initialized = false
+	}
+	docs := make([]TextDocumentItem, 0, len(c.versions))
+	for uri, v := range c.versions {
+		docs = append(docs, TextDocumentItem{
+			URI:        uri,
+			LanguageID: c.languages[uri],
+			Version:    v,
+		})
+	}
+	c.mu.Unlock()
+	if done {
+		return nil
+	}
+	if params == nil {
+		return xerrors.New("initialize has not been sent")
+	}
+	if err := c.Initialize(params).Wait(); err != nil {
+		return err
+	}
+	if err := c.Initialized(&InitializedParams{}); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		text, ok := c.text(doc.URI)
+		if !ok {
+			var err error
+			if text, err = c.Content(doc.URI); err != nil {
+				return err
+			}
+		}
+		doc.Text = text
+		if doc.LanguageID == "" {
+			file, err := uriToPath(doc.URI)
+			if err != nil {
+				return err
+			}
+			doc.LanguageID = LanguageIDForPath(file)
+		}
+		err := c.DidOpenTextDocument(&DidOpenTextDocumentParams{TextDocument: doc})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClientReinitializeOnReset(t *testing.T) {
+	c, s := newPipeClient(t, ReinitializeOnReset())
+	defer c.Close()
+	defer s.Close()
+
+	s.initialize(t, c, `{"capabilities":{}}`)
+	const uri = "file:///home/me/a/a.go"
+	c.setVersion(uri, 3)
+	c.SetContentProvider(ContentProviderFunc(func(DocumentURI) (string, error) {
+		return "package a\n", nil
+	}))
+
+	var reply string
+	call := c.Call("test/method", nil, &reply)
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.write(&Message{ID: msg.ID, Error: &ResponseError{
+		Code:    CodeServerNotInitialized,
+		Message: "not initialized",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "initialize" {
+		t.Fatalf("method = %q; want initialize", msg.Method)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`{"capabilities":{}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"initialized", "textDocument/didOpen"} {
+		msg, err = s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != want {
+			t.Fatalf("method = %q; want %q", msg.Method, want)
+		}
+	}
+	var params DidOpenTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	want := TextDocumentItem{URI: uri, LanguageID: "go", Version: 3, Text: "package a\n"}
+	if params.TextDocument != want {
+		t.Errorf("didOpen = %+v; want %+v", params.TextDocument, want)
+	}
+
+	msg, err = s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Method != "test/method" {
+		t.Fatalf("method = %q; want test/method", msg.Method)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`"ok"`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := call.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if reply != "ok" {
+		t.Errorf("reply = %q; want ok", reply)
+	}
+}
+
+func TestClientReinitializeOnResetEditedDocument(t *testing.T) {
+	c, s := newPipeClient(t, ReinitializeOnReset())
+	defer c.Close()
+	defer s.Close()
+
+	s.initialize(t, c, `{"capabilities":{}}`)
+	c.SetContentProvider(ContentProviderFunc(func(DocumentURI) (string, error) {
+		return "stale\n", nil
+	}))
+	const uri = "file:///home/me/a/a.tmpl"
+	notify := func(f func() error) {
+		t.Helper()
+		errc := make(chan error, 1)
+		go func() {
+			errc <- f()
+		}()
+		if _, err := s.read(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	notify(func() error {
+		return c.DidOpenTextDocument(&DidOpenTextDocumentParams{
+			TextDocument: TextDocumentItem{URI: uri, LanguageID: "gotmpl", Version: 1, Text: "{{.A}}\n"},
+		})
+	})
+	version := 2
+	notify(func() error {
+		return c.DidChangeTextDocument(&DidChangeTextDocumentParams{
+			TextDocument: VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+				Version:                &version,
+			},
+			ContentChanges: []TextDocumentContentChangeEvent{
+				{
+					Range: &Range{Start: Position{Character: 3}, End: Position{Character: 4}},
+					Text:  "B",
+				},
+			},
+		})
+	})
+
+	call := c.Call("test/method", nil, new(json.RawMessage))
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.write(&Message{ID: msg.ID, Error: &ResponseError{
+		Code:    CodeServerNotInitialized,
+		Message: "not initialized",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err = s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`{"capabilities":{}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"initialized", "textDocument/didOpen"} {
+		msg, err = s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != want {
+			t.Fatalf("method = %q; want %q", msg.Method, want)
+		}
+	}
+	var params DidOpenTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	want := TextDocumentItem{URI: uri, LanguageID: "gotmpl", Version: 2, Text: "{{.B}}\n"}
+	if params.TextDocument != want {
+		t.Errorf("didOpen = %+v; want %+v", params.TextDocument, want)
+	}
+
+	msg, err = s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := call.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
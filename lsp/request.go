@@ -0,0 +1,14 @@
+package lsp
+
+// Request calls the method with params, then waits for its response.
+// The result of the response is decoded into T.
+// If the server responds an error, the returned error is a *ResponseError.
+func Request[T any](c *Client, method string, params interface{}) (T, error) {
+	var result T
+	call := c.Call(method, params, &result)
+	if err := c.Wait(call); err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
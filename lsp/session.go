@@ -0,0 +1,82 @@
+package lsp
+
+import (
+	"io"
+	"time"
+)
+
+// sessionExitTimeout is how long Session.Close waits for the server to exit.
+const sessionExitTimeout = 5 * time.Second
+
+// Session is a client that has completed the initialization with the server.
+// All methods of Client are available through Session.
+type Session struct {
+	*Client
+
+	// Result is the response of initialize request.
+	Result *InitializeResult
+}
+
+// NewSession returns a session that communicates to the server with conn.
+// NewSession sends initialize and initialized to the server with rootURI,
+// which is either a path or a file URI.
+// If the initialization fails, conn is closed.
+func NewSession(conn io.ReadWriteCloser, rootURI string, opts ...Option) (*Session, error) {
+	c := NewClient(conn, opts...)
+	if err := c.SetRootURI(rootURI); err != nil {
+		c.Close()
+		return nil, err
+	}
+	r := c.Initialize(&InitializeParams{
+		RootURI: c.URL("."),
+	})
+	if err := r.Wait(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.Initialized(&InitializedParams{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &Session{Client: c, Result: r}, nil
+}
+
+// DidOpen sends the document open notification of uri with text to the server.
+// The document is opened as version 1.
+func (s *Session) DidOpen(uri DocumentURI, languageID, text string) error {
+	return s.DidOpenTextDocument(&DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{
+			URI:        uri,
+			LanguageID: languageID,
+			Version:    1,
+			Text:       text,
+		},
+	})
+}
+
+// DidClose cancels outstanding requests for uri, then sends the document close notification to the server.
+func (s *Session) DidClose(uri DocumentURI) error {
+	s.CancelDocument(uri)
+	return s.DidCloseTextDocument(&DidCloseTextDocumentParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+	})
+}
+
+// Close sends shutdown and exit to the server, waits for it to exit, then closes the connection.
+// The connection is closed even if the server doesn't respond.
+func (s *Session) Close() error {
+	err := s.Shutdown().Wait()
+	if err == nil {
+		err = s.Exit()
+	}
+	if err == nil {
+		select {
+		case <-s.Done():
+		case <-time.After(sessionExitTimeout):
+		}
+	}
+	if e := s.Client.Close(); err == nil {
+		err = e
+	}
+	return err
+}
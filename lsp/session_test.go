@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"bufio"
+	"net"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	s := &pipeServer{
+		conn: sconn,
+		r:    bufio.NewReader(sconn),
+		w:    &Client{conn: sconn},
+	}
+	methods := make(chan string, 10)
+	go func() {
+		defer close(methods)
+		defer s.Close()
+		for {
+			msg, err := s.read()
+			if err != nil {
+				return
+			}
+			methods <- msg.Method
+			switch msg.Method {
+			case "initialize":
+				s.write(&Message{ID: msg.ID, Result: []byte(`{"capabilities":{}}`)})
+			case "shutdown":
+				s.write(&Message{ID: msg.ID, Result: []byte(`null`)})
+			case "exit":
+				return
+			}
+		}
+	}()
+
+	session, err := NewSession(cconn, "/tmp/proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := session.URL("a.go")
+	if err := session.DidOpen(uri, "go", "package a\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.DidClose(uri); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Err(); err != ErrServerExited {
+		t.Errorf("Err() = %v; want ErrServerExited", err)
+	}
+
+	var a []string
+	for method := range methods {
+		a = append(a, method)
+	}
+	want := []string{
+		"initialize",
+		"initialized",
+		"textDocument/didOpen",
+		"textDocument/didClose",
+		"shutdown",
+		"exit",
+	}
+	if len(a) != len(want) {
+		t.Fatalf("methods = %v; want %v", a, want)
+	}
+	for i := range a {
+		if a[i] != want[i] {
+			t.Errorf("methods[%d] = %s; want %s", i, a[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package lsp
+
+import (
+	"fmt"
+)
+
+// Status represents the state of the connection and the lifecycle of a client.
+type Status int
+
+// Status values.
+const (
+	StatusConnecting   Status = iota // connected, but initialize is not sent yet
+	StatusInitializing               // waiting for the response of initialize
+	StatusReady                      // initialized
+	StatusShuttingDown               // shutdown is sent
+	StatusDead                       // the connection to the server is lost
+	StatusDisconnected               // the client is closed
+)
+
+var statusNames = []string{
+	StatusConnecting:   "connecting",
+	StatusInitializing: "initializing",
+	StatusReady:        "ready",
+	StatusShuttingDown: "shutting down",
+	StatusDead:         "dead",
+	StatusDisconnected: "disconnected",
+}
+
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+	return statusNames[s]
+}
+
+// Status returns the current state of c.
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// setStatus updates the state of c. Once the client is dead or disconnected,
+// only the transition to StatusDisconnected is accepted.
+func (c *Client) setStatus(s Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.status {
+	case StatusDisconnected:
+		return
+	case StatusDead:
+		if s != StatusDisconnected {
+			return
+		}
+	}
+	c.status = s
+}
@@ -0,0 +1,35 @@
+package lsp
+
+import (
+	"testing"
+)
+
+func TestClientStatus(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	if st := c.Status(); st != StatusConnecting {
+		t.Errorf("Status = %v; want %v", st, StatusConnecting)
+	}
+	s.initialize(t, c, `{"capabilities":{}}`)
+	if st := c.Status(); st != StatusReady {
+		t.Errorf("Status = %v; want %v", st, StatusReady)
+	}
+	c.Shutdown()
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Status(); st != StatusShuttingDown {
+		t.Errorf("Status = %v; want %v", st, StatusShuttingDown)
+	}
+	s.Close()
+	<-c.Done()
+	if st := c.Status(); st != StatusDead {
+		t.Errorf("Status = %v; want %v", st, StatusDead)
+	}
+	c.Close()
+	if st := c.Status(); st != StatusDisconnected {
+		t.Errorf("Status = %v; want %v", st, StatusDisconnected)
+	}
+}
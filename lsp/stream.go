@@ -0,0 +1,139 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// streamTextSize is the minimum length of texts in didOpen and didChange
+// that are written to the connection without building the whole message in memory.
+const streamTextSize = 64 << 10
+
+// textSentinel marks the place of a streamed text in the marshaled params.
+// It can't appear in marshaled texts because encoding/json escapes NUL.
+const textSentinel = "\x00acme-lsp-text\x00"
+
+// streamedText returns args that the large text is replaced with textSentinel, and the text.
+// If args don't have such a text, it returns args as is and nil.
+func streamedText(method string, args interface{}) (interface{}, *string) {
+	switch p := args.(type) {
+	case *DidOpenTextDocumentParams:
+		if method != "textDocument/didOpen" || len(p.TextDocument.Text) < streamTextSize {
+			break
+		}
+		q := *p
+		text := p.TextDocument.Text
+		q.TextDocument.Text = textSentinel
+		return &q, &text
+	case *DidChangeTextDocumentParams:
+		if method != "textDocument/didChange" || len(p.ContentChanges) != 1 || len(p.ContentChanges[0].Text) < streamTextSize {
+			break
+		}
+		q := *p
+		q.ContentChanges = []TextDocumentContentChangeEvent{p.ContentChanges[0]}
+		text := p.ContentChanges[0].Text
+		q.ContentChanges[0].Text = textSentinel
+		return &q, &text
+	}
+	return args, nil
+}
+
+// writeCall writes the message of call. A streamed text is escaped directly into the connection.
+func (c *Client) writeCall(call *Call) error {
+	if call.text == nil {
+		return c.writeJSON(call.msg)
+	}
+	p, err := json.Marshal(call.msg)
+	if err != nil {
+		return xerrors.Errorf("can't marshal: %w", err)
+	}
+	sentinel, err := json.Marshal(textSentinel)
+	if err != nil {
+		return xerrors.Errorf("can't marshal: %w", err)
+	}
+	sentinel = sentinel[1 : len(sentinel)-1] // trim quotes
+	i := bytes.Index(p, sentinel)
+	if i < 0 {
+		return xerrors.New("can't find the place of the text")
+	}
+	prefix, suffix := p[:i], p[i+len(sentinel):]
+	text := *call.text
+	if c.Debug || c.wireTap() != nil {
+		// the whole message is needed anyway.
+		var b bytes.Buffer
+		b.Write(prefix)
+		writeEscaped(&b, text)
+		b.Write(suffix)
+		return c.writeJSON(json.RawMessage(b.Bytes()))
+	}
+	n := len(prefix) + escapedLen(text) + len(suffix)
+	w := bufio.NewWriter(c.conn)
+	fmt.Fprintf(w, "Content-Length: %d\r\n%s\r\n", n, c.extraHeader)
+	w.Write(prefix)
+	writeEscaped(w, text)
+	w.Write(suffix)
+	if err := w.Flush(); err != nil {
+		return xerrors.Errorf("can't write: %w", err)
+	}
+	return nil
+}
+
+// escapedLen returns the length of s escaped by writeEscaped.
+func escapedLen(s string) int {
+	var n int
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if e := escapeRune(r, size); e != "" {
+			n += len(e)
+		} else {
+			n += size
+		}
+		i += size
+	}
+	return n
+}
+
+// writeEscaped writes s escaped as the content of a JSON string, without quotes.
+func writeEscaped(w io.Writer, s string) {
+	start := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if e := escapeRune(r, size); e != "" {
+			io.WriteString(w, s[start:i])
+			io.WriteString(w, e)
+			start = i + size
+		}
+		i += size
+	}
+	io.WriteString(w, s[start:])
+}
+
+// escapeRune returns the escape sequence of r, or "" if r is written as is.
+// An invalid byte is replaced with U+FFFD like encoding/json.
+func escapeRune(r rune, size int) string {
+	switch {
+	case r == '"':
+		return `\"`
+	case r == '\\':
+		return `\\`
+	case r == '\n':
+		return `\n`
+	case r == '\r':
+		return `\r`
+	case r == '\t':
+		return `\t`
+	case r < 0x20:
+		return fmt.Sprintf(`\u%04x`, r)
+	case r == utf8.RuneError && size == 1:
+		return `\ufffd`
+	case r == '\u2028' || r == '\u2029':
+		return fmt.Sprintf(`\u%04x`, r)
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteEscaped(t *testing.T) {
+	tests := []string{
+		"",
+		"package main\n",
+		"\"quoted\" \\ \t\r\n\x00\x1f <&> 😀   ",
+		"invalid \xff\xfe utf-8",
+	}
+	for _, s := range tests {
+		var b bytes.Buffer
+		writeEscaped(&b, s)
+		if n := escapedLen(s); n != b.Len() {
+			t.Errorf("escapedLen(%q) = %d; want %d", s, n, b.Len())
+		}
+		var got, want string
+		if err := json.Unmarshal([]byte(`"`+b.String()+`"`), &got); err != nil {
+			t.Errorf("writeEscaped(%q) = %q: %v", s, b.String(), err)
+			continue
+		}
+		p, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(p, &want); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("writeEscaped(%q) decodes to %q; want %q", s, got, want)
+		}
+	}
+}
+
+func TestClientStreamText(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	text := strings.Repeat("\"a\" 😀\t\\\n", streamTextSize/8)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.DidOpenTextDocument(&DidOpenTextDocumentParams{
+			TextDocument: TextDocumentItem{
+				URI:        "file:///home/me/a.go",
+				LanguageID: "go",
+				Version:    1,
+				Text:       text,
+			},
+		})
+	}()
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	var p DidOpenTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		t.Fatalf("can't decode %.100s: %v", msg.Params, err)
+	}
+	if msg.Method != "textDocument/didOpen" || p.TextDocument.URI != "file:///home/me/a.go" || p.TextDocument.Version != 1 {
+		t.Errorf("message = %s %s version %d", msg.Method, string(p.TextDocument.URI), p.TextDocument.Version)
+	}
+	if p.TextDocument.Text != text {
+		t.Errorf("streamed text differs from the original")
+	}
+
+	v := 2
+	go func() {
+		errc <- c.DidChangeTextDocument(&DidChangeTextDocumentParams{
+			TextDocument: VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: TextDocumentIdentifier{URI: "file:///home/me/a.go"},
+				Version:                &v,
+			},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: text + "x"}},
+		})
+	}()
+	msg, err = s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	var q DidChangeTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &q); err != nil {
+		t.Fatalf("can't decode %.100s: %v", msg.Params, err)
+	}
+	if len(q.ContentChanges) != 1 || q.ContentChanges[0].Text != text+"x" {
+		t.Errorf("streamed change differs from the original")
+	}
+}
@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// TCPConn represents a connection to a server listening on TCP.
+type TCPConn struct {
+	*net.TCPConn
+
+	mu          sync.Mutex
+	readTimeout time.Duration
+}
+
+// OpenTCP returns a connection to the server listening on addr.
+func OpenTCP(addr string) (*TCPConn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, xerrors.Errorf("can't connect to %s: %w", addr, err)
+	}
+	return &TCPConn{TCPConn: conn.(*net.TCPConn)}, nil
+}
+
+// SetKeepAliveInterval enables TCP keepalive with interval d,
+// so that the OS detects the peer that disappeared.
+// If d is zero, keepalive is disabled.
+// OpenTCP enables keepalive with the system default interval.
+func (c *TCPConn) SetKeepAliveInterval(d time.Duration) error {
+	if d == 0 {
+		return c.TCPConn.SetKeepAlive(false)
+	}
+	if err := c.TCPConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return c.TCPConn.SetKeepAlivePeriod(d)
+}
+
+// SetReadTimeout sets the duration that each Read waits for data.
+// If d is zero, Read waits forever.
+//
+// A Client treats the timeout as benign while no requests are waiting for responses,
+// otherwise it fails the requests as the connection is lost.
+// This detects a peer that disappeared silently.
+func (c *TCPConn) SetReadTimeout(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readTimeout = d
+}
+
+// Read reads data from c within the read timeout.
+func (c *TCPConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	d := c.readTimeout
+	c.mu.Unlock()
+	if d > 0 {
+		if err := c.TCPConn.SetReadDeadline(time.Now().Add(d)); err != nil {
+			return 0, err
+		}
+	}
+	return c.TCPConn.Read(b)
+}
+
+// isTimeout reports whether err is caused by a deadline.
+func isTimeout(err error) bool {
+	var e net.Error
+	return xerrors.As(err, &e) && e.Timeout()
+}
@@ -0,0 +1,73 @@
+package lsp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+func TestTCPConnReadTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// read requests but never respond like a vanished peer.
+		b := make([]byte, 1024)
+		for {
+			if _, err := conn.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := OpenTCP(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadTimeout(50 * time.Millisecond)
+	c := NewClient(conn)
+	defer c.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := c.Err(); err != nil {
+		t.Fatalf("Err() while idle = %v; want nil", err)
+	}
+	err = c.Call("test/request", nil, new(int)).Wait()
+	if !xerrors.Is(err, ErrServerLost) {
+		t.Errorf("Wait() = %v; want ErrServerLost", err)
+	}
+}
+
+func TestTCPConnSetKeepAliveInterval(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := OpenTCP(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, d := range []time.Duration{10 * time.Second, 0} {
+		if err := conn.SetKeepAliveInterval(d); err != nil {
+			t.Errorf("SetKeepAliveInterval(%v): %v", d, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// runeOffset returns the offset in runes of text pointed by pos.
+// Character of pos is counted in UTF-16 code units as described in the specification.
+// If pos is out of text, runeOffset returns the nearest offset.
+func runeOffset(text string, pos Position) int {
+	var n int
+	s := text
+	for line := 0; line < pos.Line; line++ {
+		_, next := lineEnd(s)
+		if next < 0 {
+			return n + utf8.RuneCountInString(s)
+		}
+		n += utf8.RuneCountInString(s[:next])
+		s = s[next:]
+	}
+	if i, _ := lineEnd(s); i >= 0 {
+		s = s[:i]
+	}
+	var col int
+	for _, r := range s {
+		if col >= pos.Character {
+			break
+		}
+		col += utf16Len(r)
+		n++
+	}
+	return n
+}
+
+// lineEnd returns the index of the line terminator in s and the index of the next line.
+// A line is terminated by LF, CRLF or CR as described in the specification.
+// If s has no terminators, both are -1.
+func lineEnd(s string) (i, next int) {
+	i = strings.IndexAny(s, "\r\n")
+	if i < 0 {
+		return -1, -1
+	}
+	if strings.HasPrefix(s[i:], "\r\n") {
+		return i, i + 2
+	}
+	return i, i + 1
+}
+
+// AcmeOffsetToPosition returns the position of text at off in runes,
+// that is acme's #off address. LF, CRLF and CR terminate a line.
+// If off points the LF of CRLF, the position is at the end of the line.
+func AcmeOffsetToPosition(text string, off int) Position {
+	var pos Position
+	for i, n := 0, 0; i < len(text) && n < off; n++ {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == '\r' && strings.HasPrefix(text[i+size:], "\n"):
+			// CR of CRLF isn't a character of the line.
+		case r == '\n' || r == '\r':
+			pos.Line++
+			pos.Character = 0
+		default:
+			pos.Character += utf16Len(r)
+		}
+		i += size
+	}
+	return pos
+}
+
+// PositionToAcmeOffset returns the offset in runes of text pointed by pos.
+// It is the inverse of AcmeOffsetToPosition.
+// If pos is out of text, PositionToAcmeOffset returns the nearest offset.
+func PositionToAcmeOffset(text string, pos Position) int {
+	return runeOffset(text, pos)
+}
+
+// utf16Len returns the number of UTF-16 code units of r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// DiagnosticToAddr returns the range of d as offsets in runes of text.
+// The results can be used as acme's address such as #start,#end.
+func DiagnosticToAddr(text string, d Diagnostic) (start, end int) {
+	start = runeOffset(text, d.Range.Start)
+	end = runeOffset(text, d.Range.End)
+	return
+}
+
+// ErrInvalidRange is returned when a range of didChange doesn't fit the document.
+var ErrInvalidRange = xerrors.New("lsp: invalid range")
+
+// checkPosition returns an error if pos is out of text.
+// The end of each line, and the end of text, are valid positions.
+func checkPosition(text string, pos Position) error {
+	if pos.Line < 0 || pos.Character < 0 {
+		return xerrors.Errorf("%w: negative position %d:%d", ErrInvalidRange, pos.Line, pos.Character)
+	}
+	s := text
+	for line := 0; line < pos.Line; line++ {
+		_, next := lineEnd(s)
+		if next < 0 {
+			return xerrors.Errorf("%w: line %d is out of %d lines", ErrInvalidRange, pos.Line, line+1)
+		}
+		s = s[next:]
+	}
+	if i, _ := lineEnd(s); i >= 0 {
+		s = s[:i]
+	}
+	var n int
+	for _, r := range s {
+		n += utf16Len(r)
+	}
+	if pos.Character > n {
+		return xerrors.Errorf("%w: character %d is out of line %d of length %d", ErrInvalidRange, pos.Character, pos.Line, n)
+	}
+	return nil
+}
+
+// applyChanges returns text that changes are applied to in order.
+// It returns an error wrapping ErrInvalidRange if a range is reversed or out of the text
+// that previous changes are applied to.
+func applyChanges(text string, changes []TextDocumentContentChangeEvent) (string, error) {
+	for i, e := range changes {
+		if e.Range == nil {
+			text = e.Text
+			continue
+		}
+		r := *e.Range
+		if r.End.Before(r.Start) {
+			return "", xerrors.Errorf("change #%d: %w: %v is reversed", i, ErrInvalidRange, r)
+		}
+		for _, pos := range []Position{r.Start, r.End} {
+			if err := checkPosition(text, pos); err != nil {
+				return "", xerrors.Errorf("change #%d: %w", i, err)
+			}
+		}
+		s, err := ApplyEdits(text, []TextEdit{{Range: r, NewText: e.Text}})
+		if err != nil {
+			return "", xerrors.Errorf("change #%d: %w", i, err)
+		}
+		text = s
+	}
+	return text, nil
+}
@@ -0,0 +1,174 @@
+package lsp
+
+import (
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+func TestDiagnosticToAddr(t *testing.T) {
+	const text = "package main\n\nvar s = \"テスト😀\" + x\n"
+	tests := []struct {
+		r          Range
+		start, end int
+	}{
+		{
+			r: Range{
+				Start: Position{Line: 0, Character: 8},
+				End:   Position{Line: 0, Character: 12},
+			},
+			start: 8, end: 12,
+		},
+		{
+			// 😀 is 2 code units in UTF-16
+			r: Range{
+				Start: Position{Line: 2, Character: 12},
+				End:   Position{Line: 2, Character: 14},
+			},
+			start: 26, end: 27,
+		},
+		{
+			r: Range{
+				Start: Position{Line: 2, Character: 100},
+				End:   Position{Line: 10, Character: 0},
+			},
+			start: 32, end: 33,
+		},
+	}
+	for _, tt := range tests {
+		start, end := DiagnosticToAddr(text, Diagnostic{Range: tt.r})
+		if start != tt.start || end != tt.end {
+			t.Errorf("DiagnosticToAddr(%v) = #%d,#%d; want #%d,#%d", tt.r, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestAcmeOffsetToPosition(t *testing.T) {
+	tests := []struct {
+		text string
+		off  int
+		pos  Position
+	}{
+		{text: "ab\ncd\n", off: 0, pos: Position{Line: 0, Character: 0}},
+		{text: "ab\ncd\n", off: 2, pos: Position{Line: 0, Character: 2}},
+		{text: "ab\ncd\n", off: 4, pos: Position{Line: 1, Character: 1}},
+		{text: "ab\r\ncd\r\n", off: 2, pos: Position{Line: 0, Character: 2}},
+		{text: "ab\r\ncd\r\n", off: 5, pos: Position{Line: 1, Character: 1}},
+		{text: "😀a\r\nb", off: 2, pos: Position{Line: 0, Character: 3}},
+		{text: "😀a\r\nb", off: 5, pos: Position{Line: 1, Character: 1}},
+	}
+	for _, tt := range tests {
+		pos := AcmeOffsetToPosition(tt.text, tt.off)
+		if pos != tt.pos {
+			t.Errorf("AcmeOffsetToPosition(%q, %d) = %v; want %v", tt.text, tt.off, pos, tt.pos)
+		}
+		if off := PositionToAcmeOffset(tt.text, pos); off != tt.off {
+			t.Errorf("PositionToAcmeOffset(%q, %v) = %d; want %d", tt.text, pos, off, tt.off)
+		}
+	}
+
+	// the LF of CRLF is the end of line.
+	if pos, want := AcmeOffsetToPosition("ab\r\ncd", 3), (Position{Line: 0, Character: 2}); pos != want {
+		t.Errorf("AcmeOffsetToPosition at LF of CRLF = %v; want %v", pos, want)
+	}
+	// the end of line doesn't include CR.
+	if off := PositionToAcmeOffset("ab\r\ncd", Position{Line: 0, Character: 10}); off != 2 {
+		t.Errorf("PositionToAcmeOffset beyond CRLF = %d; want 2", off)
+	}
+}
+
+func TestMixedLineEndings(t *testing.T) {
+	// lines: "a😀b", "cd", "e", "fg"
+	const text = "a😀b\r\ncd\ne\rfg"
+	tests := []struct {
+		off int
+		pos Position
+	}{
+		{off: 2, pos: Position{Line: 0, Character: 3}},
+		{off: 3, pos: Position{Line: 0, Character: 4}},
+		{off: 5, pos: Position{Line: 1, Character: 0}},
+		{off: 7, pos: Position{Line: 1, Character: 2}},
+		{off: 8, pos: Position{Line: 2, Character: 0}},
+		{off: 10, pos: Position{Line: 3, Character: 0}},
+		{off: 12, pos: Position{Line: 3, Character: 2}},
+	}
+	for _, tt := range tests {
+		if pos := AcmeOffsetToPosition(text, tt.off); pos != tt.pos {
+			t.Errorf("AcmeOffsetToPosition(#%d) = %v; want %v", tt.off, pos, tt.pos)
+		}
+		if off := PositionToAcmeOffset(text, tt.pos); off != tt.off {
+			t.Errorf("PositionToAcmeOffset(%v) = #%d; want #%d", tt.pos, off, tt.off)
+		}
+	}
+
+	d := Diagnostic{
+		Range: Range{
+			Start: Position{Line: 2, Character: 0},
+			End:   Position{Line: 2, Character: 5},
+		},
+	}
+	if start, end := DiagnosticToAddr(text, d); start != 8 || end != 9 {
+		t.Errorf("DiagnosticToAddr(%v) = #%d,#%d; want #8,#9", d.Range, start, end)
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	const text = "package a\r\n\nvar 😀 int\n"
+	rng := func(l1, c1, l2, c2 int) *Range {
+		return &Range{Start: Position{Line: l1, Character: c1}, End: Position{Line: l2, Character: c2}}
+	}
+	tests := []struct {
+		changes []TextDocumentContentChangeEvent
+		want    string
+		err     bool
+	}{
+		{
+			changes: []TextDocumentContentChangeEvent{{Range: rng(0, 8, 0, 9), Text: "b"}},
+			want:    "package b\r\n\nvar 😀 int\n",
+		},
+		{
+			// the emoji is 2 UTF-16 code units; the end of the last line is valid.
+			changes: []TextDocumentContentChangeEvent{
+				{Range: rng(2, 4, 2, 6), Text: "x"},
+				{Range: rng(2, 5, 2, 5), Text: "y"},
+				{Range: rng(3, 0, 3, 0), Text: "// end\n"},
+			},
+			want: "package a\r\n\nvar xy int\n// end\n",
+		},
+		{
+			// a later change is validated against the result of earlier ones.
+			changes: []TextDocumentContentChangeEvent{
+				{Text: "x"},
+				{Range: rng(0, 1, 0, 1), Text: "y"},
+			},
+			want: "xy",
+		},
+		{changes: []TextDocumentContentChangeEvent{{Range: rng(0, 5, 0, 2)}}, err: true},
+		{changes: []TextDocumentContentChangeEvent{{Range: rng(0, 0, 0, 10)}}, err: true},
+		{changes: []TextDocumentContentChangeEvent{{Range: rng(4, 0, 4, 0)}}, err: true},
+		{changes: []TextDocumentContentChangeEvent{{Range: rng(2, 0, 2, 11)}}, err: true},
+		{
+			changes: []TextDocumentContentChangeEvent{
+				{Text: "x"},
+				{Range: rng(1, 0, 1, 0)},
+			},
+			err: true,
+		},
+	}
+	for i, tt := range tests {
+		s, err := applyChanges(text, tt.changes)
+		if tt.err {
+			if !xerrors.Is(err, ErrInvalidRange) {
+				t.Errorf("#%d: applyChanges = %q, %v; want %v", i, s, err, ErrInvalidRange)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: applyChanges: %v", i, err)
+			continue
+		}
+		if s != tt.want {
+			t.Errorf("#%d: applyChanges = %q; want %q", i, s, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"encoding/json"
+	"path"
+)
+
+// WorkspaceFolder represents the interface described in the specification.
+type WorkspaceFolder struct {
+	URI  DocumentURI `json:"uri"`
+	Name string      `json:"name"`
+}
+
+// WorkspaceServerCapabilities represents the workspace field of ServerCapabilities.
+type WorkspaceServerCapabilities struct {
+	WorkspaceFolders WorkspaceFoldersServerCapabilities `json:"workspaceFolders,omitempty"`
+}
+
+// WorkspaceFoldersServerCapabilities represents the interface described in the specification.
+type WorkspaceFoldersServerCapabilities struct {
+	Supported bool `json:"supported,omitempty"`
+
+	// ChangeNotifications is either boolean or a registration id.
+	ChangeNotifications json.RawMessage `json:"changeNotifications,omitempty"`
+}
+
+// SetWorkspaceFolders sets roots of the workspace. Each root is either a path or a file URI.
+// If there are more than one root, Initialize sends them as workspaceFolders.
+// It must be called before Initialize.
+func (c *Client) SetWorkspaceFolders(roots ...string) error {
+	a := make([]WorkspaceFolder, 0, len(roots))
+	for _, root := range roots {
+		folder, err := c.newWorkspaceFolder(root)
+		if err != nil {
+			return err
+		}
+		a = append(a, folder)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.folders = a
+	return nil
+}
+
+func (c *Client) newWorkspaceFolder(root string) (WorkspaceFolder, error) {
+	var tmp Client
+	if err := tmp.SetRootURI(root); err != nil {
+		return WorkspaceFolder{}, err
+	}
+	return WorkspaceFolder{
+		URI:  tmp.URL("."),
+		Name: path.Base(tmp.BaseURL.Path),
+	}, nil
+}
+
+func (c *Client) workspaceFolders() []WorkspaceFolder {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.folders) == 0 {
+		return nil
+	}
+	return append([]WorkspaceFolder(nil), c.folders...)
+}
+
+// DidChangeWorkspaceFoldersParams represents the interface described in the specification.
+type DidChangeWorkspaceFoldersParams struct {
+	Event WorkspaceFoldersChangeEvent `json:"event"`
+}
+
+// WorkspaceFoldersChangeEvent represents the interface described in the specification.
+type WorkspaceFoldersChangeEvent struct {
+	Added   []WorkspaceFolder `json:"added"`
+	Removed []WorkspaceFolder `json:"removed"`
+}
+
+// DidChangeWorkspaceFolders sends the workspace folders change notification to the server.
+// It also updates the folders set by SetWorkspaceFolders.
+func (c *Client) DidChangeWorkspaceFolders(params *DidChangeWorkspaceFoldersParams) error {
+	const method = "workspace/didChangeWorkspaceFolders"
+	if !c.cap.Workspace.WorkspaceFolders.Supported {
+		return c.Wait(c.unsupported(method, params, nil))
+	}
+	if err := c.Wait(c.Call(method, params, nil)); err != nil {
+		return err
+	}
+	removed := make(map[DocumentURI]bool)
+	for _, f := range params.Event.Removed {
+		removed[f.URI] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a := make([]WorkspaceFolder, 0, len(c.folders)+len(params.Event.Added))
+	for _, f := range c.folders {
+		if !removed[f.URI] {
+			a = append(a, f)
+		}
+	}
+	c.folders = append(a, params.Event.Added...)
+	return nil
+}
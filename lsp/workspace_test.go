@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestClientWorkspaceFolders(t *testing.T) {
+	c, s := newPipeClient(t)
+	defer c.Close()
+	defer s.Close()
+
+	if err := c.SetWorkspaceFolders("/home/me/a", "file:///home/me/b/"); err != nil {
+		t.Fatal(err)
+	}
+	r := c.Initialize(&InitializeParams{RootURI: "file:///home/me/a"})
+	msg, err := s.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params InitializeParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	want := []WorkspaceFolder{
+		{URI: "file:///home/me/a", Name: "a"},
+		{URI: "file:///home/me/b", Name: "b"},
+	}
+	if !reflect.DeepEqual(params.WorkspaceFolders, want) {
+		t.Errorf("workspaceFolders = %v; want %v", params.WorkspaceFolders, want)
+	}
+	if !params.Capabilities.Workspace.WorkspaceFolders {
+		t.Errorf("workspace.workspaceFolders capability is not advertised")
+	}
+	resp := `{"capabilities":{"workspace":{"workspaceFolders":{"supported":true,"changeNotifications":true}}}}`
+	if err := s.write(&Message{ID: msg.ID, Result: json.RawMessage(resp)}); err != nil {
+		t.Fatal(err)
+	}
+	waitc := make(chan error, 1)
+	go func() {
+		waitc <- r.Wait()
+	}()
+	if msg, err := s.read(); err != nil {
+		t.Fatal(err)
+	} else if msg.Method != "initialized" {
+		t.Errorf("method = %q; want initialized", msg.Method)
+	}
+	if err := <-waitc; err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.DidChangeWorkspaceFolders(&DidChangeWorkspaceFoldersParams{
+			Event: WorkspaceFoldersChangeEvent{
+				Added:   []WorkspaceFolder{{URI: "file:///home/me/c", Name: "c"}},
+				Removed: []WorkspaceFolder{{URI: "file:///home/me/a", Name: "a"}},
+			},
+		})
+	}()
+	if _, err := s.read(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("DidChangeWorkspaceFolders: %v", err)
+	}
+	want = []WorkspaceFolder{
+		{URI: "file:///home/me/b", Name: "b"},
+		{URI: "file:///home/me/c", Name: "c"},
+	}
+	if a := c.workspaceFolders(); !reflect.DeepEqual(a, want) {
+		t.Errorf("workspace folders = %v; want %v", a, want)
+	}
+}
@@ -36,8 +36,9 @@ func initialize(c *lsp.Client) error {
 	if err := r.Wait(); err != nil {
 		return err
 	}
-	if err := c.Initialized(&lsp.InitializedParams{}); err != nil {
-		return err
+	if *debugFlag {
+		name, version := c.ServerInfo()
+		log.Printf("server: %s %s", name, version)
 	}
 	return nil
 }